@@ -0,0 +1,104 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AssumeRoleProvider provides the credentials of an assumed role. The keys
+// are cached until shortly before the Expiration returned by STS, so roles
+// requiring MFA only prompt for a code when the session is renewed.
+type AssumeRoleProvider struct {
+	// Credentials are the credentials assuming the role.
+	Credentials Credentials
+
+	// RoleARN is the role to assume.
+	RoleARN string
+
+	// SessionName identifies the session, it defaults to
+	// AWS_ROLE_SESSION_NAME or to a generated name.
+	SessionName string
+
+	// ExternalID is the external ID required by the role, if any.
+	ExternalID string
+
+	// SerialNumber is the identifier of the MFA device of roles requiring
+	// MFA, TokenProvider is then called on every refresh to obtain the
+	// one-time code of the device.
+	SerialNumber  string
+	TokenProvider func() (string, error)
+
+	// Duration is how long the credentials are valid, STS defaults to one
+	// hour.
+	Duration time.Duration
+
+	// Endpoint is the STS endpoint, it defaults to the regional endpoint of
+	// AWS_REGION or to DefaultSTSEndpoint.
+	Endpoint string
+
+	// Client is the client used to reach STS, requests are signed with
+	// Credentials on top of its transport. It defaults to http.DefaultClient.
+	Client *http.Client
+
+	cache keyCache
+}
+
+// Retrieve implements the Credentials interface.
+func (p *AssumeRoleProvider) Retrieve(ctx context.Context) (Keys, error) {
+	return p.cache.retrieve(ctx, func(keys Keys) bool {
+		return expired(keys, nil, 0)
+	}, p.fetch)
+}
+
+// Invalidate drops the cached keys, the role is assumed again on next use.
+func (p *AssumeRoleProvider) Invalidate() {
+	p.cache.invalidate()
+}
+
+func (p *AssumeRoleProvider) fetch(ctx context.Context) (Keys, error) {
+	if p.Credentials == nil {
+		return Keys{}, fmt.Errorf("aws: no credentials to assume role %s", p.RoleARN)
+	}
+	params := url.Values{
+		"RoleArn":         {p.RoleARN},
+		"RoleSessionName": {sessionName(p.SessionName)},
+	}
+	if p.ExternalID != "" {
+		params.Set("ExternalId", p.ExternalID)
+	}
+	if p.Duration > 0 {
+		params.Set("DurationSeconds", strconv.Itoa(int(p.Duration/time.Second)))
+	}
+	if p.SerialNumber != "" {
+		if p.TokenProvider == nil {
+			return Keys{}, fmt.Errorf("aws: no TokenProvider for the MFA device %s", p.SerialNumber)
+		}
+		code, err := p.TokenProvider()
+		if err != nil {
+			return Keys{}, err
+		}
+		params.Set("SerialNumber", p.SerialNumber)
+		params.Set("TokenCode", code)
+	}
+
+	c := p.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	signed := &http.Client{
+		Timeout: c.Timeout,
+		Transport: &Transport{
+			Signer: &V4Signer{
+				Region:      "us-east-1",
+				Service:     "sts",
+				Credentials: p.Credentials,
+			},
+			Transport: c.Transport,
+		},
+	}
+	return assumeRole(ctx, signed, p.Endpoint, "AssumeRole", params)
+}
@@ -0,0 +1,127 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+// States of a CircuitBreaker.
+const (
+	// CircuitClosed lets requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects requests until the cooldown elapses.
+	CircuitOpen
+	// CircuitHalfOpen lets a single trial request through, its outcome
+	// closes or opens the circuit again.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitOpenError is returned for requests rejected by an open
+// CircuitBreaker.
+type CircuitOpenError struct {
+	// Until is when the circuit half-opens.
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("aws: circuit open until %s", e.Until.Format(time.RFC3339))
+}
+
+// CircuitBreaker stops sending requests to an endpoint after consecutive
+// failures, either connection errors or 5xx responses.
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failures opening the
+	// circuit.
+	Threshold int
+
+	// Cooldown is how long the circuit stays open before letting a trial
+	// request through.
+	Cooldown time.Duration
+
+	Clock func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func (b *CircuitBreaker) now() time.Time {
+	if b.Clock != nil {
+		return b.Clock()
+	}
+	return time.Now()
+}
+
+// State returns the current state of the circuit.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current()
+}
+
+func (b *CircuitBreaker) current() CircuitState {
+	if b.state == CircuitOpen && !b.now().Before(b.openedAt.Add(b.Cooldown)) {
+		b.state = CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow reports whether a request can be sent.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.current() {
+	case CircuitOpen:
+		return &CircuitOpenError{Until: b.openedAt.Add(b.Cooldown)}
+	case CircuitHalfOpen:
+		if b.trial {
+			return &CircuitOpenError{Until: b.now()}
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// record records the outcome of a request.
+func (b *CircuitBreaker) record(resp *http.Response, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitHalfOpen {
+		b.trial = false
+	}
+	// Canceled requests don't tell anything about the endpoint.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	failed := err != nil || resp.StatusCode >= 500
+	if !failed {
+		b.state = CircuitClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.Threshold {
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
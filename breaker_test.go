@@ -0,0 +1,90 @@
+package aws
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := &CircuitBreaker{
+		Threshold: 2,
+		Cooldown:  time.Minute,
+		Clock:     func() time.Time { return now },
+	}
+	status, calls := 503, 0
+	transport := &Transport{
+		Signer: AnonymousSigner{},
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			return response(status), nil
+		}),
+		Breaker: breaker,
+	}
+	send := func() error {
+		req, _ := http.NewRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+		_, err := transport.RoundTrip(req)
+		return err
+	}
+	expect := func(state CircuitState) {
+		t.Helper()
+		if s := breaker.State(); s != state {
+			t.Fatalf("expected circuit to be %s, got %s", state, s)
+		}
+	}
+
+	// Consecutive failures open the circuit.
+	send()
+	expect(CircuitClosed)
+	send()
+	expect(CircuitOpen)
+	var open *CircuitOpenError
+	if err := send(); !errors.As(err, &open) || !open.Until.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected the request to be short-circuited, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 requests to be sent, got %d", calls)
+	}
+
+	// A failed trial opens the circuit again.
+	now = now.Add(time.Minute)
+	expect(CircuitHalfOpen)
+	send()
+	expect(CircuitOpen)
+
+	// A successful trial closes it.
+	now = now.Add(time.Minute)
+	expect(CircuitHalfOpen)
+	status = 200
+	if err := send(); err != nil {
+		t.Fatal(err)
+	}
+	expect(CircuitClosed)
+	if calls != 4 {
+		t.Errorf("expected 4 requests to be sent, got %d", calls)
+	}
+}
+
+func TestCircuitBreakerSkipsRetries(t *testing.T) {
+	calls := 0
+	transport := &Transport{
+		Signer: AnonymousSigner{},
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			return nil, errors.New("connection refused")
+		}),
+		RetryPolicy: &RetryPolicy{MaxAttempts: 5, MinBackoff: time.Millisecond},
+		Breaker:     &CircuitBreaker{Threshold: 2, Cooldown: time.Minute},
+	}
+	req, _ := http.NewRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	_, err := transport.RoundTrip(req)
+	var open *CircuitOpenError
+	if !errors.As(err, &open) {
+		t.Errorf("expected the circuit to open, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected retries to stop once the circuit is open, got %d requests", calls)
+	}
+}
@@ -0,0 +1,49 @@
+package aws
+
+import (
+	"net/url"
+	"strings"
+)
+
+// BucketCredentialResolver maps S3 buckets to the credentials signing the
+// requests sent to them.
+type BucketCredentialResolver interface {
+	// BucketCredentials returns the credentials of bucket, or nil if it has
+	// none.
+	BucketCredentials(bucket string) Credentials
+}
+
+// BucketCredentials maps bucket names to their credentials.
+type BucketCredentials map[string]Credentials
+
+// BucketCredentials implements the BucketCredentialResolver interface.
+func (m BucketCredentials) BucketCredentials(bucket string) Credentials {
+	return m[bucket]
+}
+
+// HostBucket returns the bucket of a virtual-hosted S3 host, such as
+// bucket.s3.us-west-2.amazonaws.com, empty for a path-style one. Bucket names
+// can contain .s3. themselves, the endpoint is last.
+func HostBucket(host string) string {
+	i := strings.LastIndex(host, ".s3.")
+	if j := strings.LastIndex(host, ".s3-"); j > i {
+		i = j
+	}
+	if i <= 0 {
+		return ""
+	}
+	return host[:i]
+}
+
+// bucketName returns the bucket of the S3 request at u, whether it uses
+// virtual-hosted or path-style addressing.
+func bucketName(u *url.URL) string {
+	if bucket := HostBucket(u.Host); bucket != "" {
+		return bucket
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
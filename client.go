@@ -0,0 +1,99 @@
+package aws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Default timeouts of clients created by NewClient.
+const (
+	DefaultDialTimeout           = 10 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultResponseHeaderTimeout = 30 * time.Second
+	DefaultExpectContinueTimeout = 1 * time.Second
+)
+
+// ClientOptions configures a client created by NewClient. Zero durations
+// use the defaults.
+type ClientOptions struct {
+	// Timeout limits the whole request, including reading the response
+	// body. There's no overall limit by default, as transferring big
+	// objects can take a long time.
+	Timeout time.Duration
+
+	// DialTimeout limits the time spent establishing a connection.
+	DialTimeout time.Duration
+
+	// TLSHandshakeTimeout limits the time spent in the TLS handshake.
+	TLSHandshakeTimeout time.Duration
+
+	// ResponseHeaderTimeout limits the time spent waiting for the response
+	// headers once the request has been sent.
+	ResponseHeaderTimeout time.Duration
+
+	// ExpectContinueTimeout limits the time spent waiting for a 100
+	// Continue response before sending the body of requests with an
+	// Expect: 100-continue header.
+	ExpectContinueTimeout time.Duration
+
+	// RetryPolicy, if set, retries failed requests.
+	RetryPolicy *RetryPolicy
+
+	// Collector, if set, observes every request sent.
+	Collector Collector
+
+	// UserAgent, if set, is appended to the User-Agent of every request.
+	UserAgent string
+
+	// RootCAs, if set, is the pool of certificate authorities servers are
+	// verified against instead of the system pool, e.g. for S3 compatible
+	// stores using a private CA.
+	RootCAs *x509.CertPool
+
+	// InsecureSkipVerify disables the verification of server certificates.
+	// It must only be used for development, as it allows man-in-the-middle
+	// attacks.
+	InsecureSkipVerify bool
+}
+
+// NewClient returns a http.Client signing requests with s.
+func NewClient(s Signer, opts *ClientOptions) *http.Client {
+	if opts == nil {
+		opts = &ClientOptions{}
+	}
+	dialer := &net.Dialer{
+		Timeout:   orDefault(opts.DialTimeout, DefaultDialTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = dialer.DialContext
+	t.TLSHandshakeTimeout = orDefault(opts.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout)
+	t.ResponseHeaderTimeout = orDefault(opts.ResponseHeaderTimeout, DefaultResponseHeaderTimeout)
+	t.ExpectContinueTimeout = orDefault(opts.ExpectContinueTimeout, DefaultExpectContinueTimeout)
+	if opts.RootCAs != nil || opts.InsecureSkipVerify {
+		t.TLSClientConfig = &tls.Config{
+			RootCAs:            opts.RootCAs,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+		}
+	}
+	return &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &Transport{
+			Signer:      s,
+			Transport:   t,
+			RetryPolicy: opts.RetryPolicy,
+			Collector:   opts.Collector,
+			UserAgent:   opts.UserAgent,
+		},
+	}
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
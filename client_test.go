@@ -0,0 +1,56 @@
+package aws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewClient(t *testing.T) {
+	c := NewClient(AnonymousSigner{}, &ClientOptions{
+		Timeout:               time.Minute,
+		TLSHandshakeTimeout:   3 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		ExpectContinueTimeout: 2 * time.Second,
+	})
+	if c.Timeout != time.Minute {
+		t.Errorf("unexpected timeout %s", c.Timeout)
+	}
+	transport := c.Transport.(*Transport).Transport.(*http.Transport)
+	if transport.TLSHandshakeTimeout != 3*time.Second {
+		t.Errorf("unexpected TLS handshake timeout %s", transport.TLSHandshakeTimeout)
+	}
+	if transport.ResponseHeaderTimeout != 5*time.Second {
+		t.Errorf("unexpected response header timeout %s", transport.ResponseHeaderTimeout)
+	}
+	if transport.ExpectContinueTimeout != 2*time.Second {
+		t.Errorf("unexpected expect continue timeout %s", transport.ExpectContinueTimeout)
+	}
+	if transport.DialContext == nil {
+		t.Error("expected a dialer to be set")
+	}
+
+	c = NewClient(AnonymousSigner{}, nil)
+	transport = c.Transport.(*Transport).Transport.(*http.Transport)
+	if transport.TLSHandshakeTimeout != DefaultTLSHandshakeTimeout || transport.ResponseHeaderTimeout != DefaultResponseHeaderTimeout || transport.ExpectContinueTimeout != DefaultExpectContinueTimeout {
+		t.Errorf("expected default timeouts, got %s, %s and %s", transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout, transport.ExpectContinueTimeout)
+	}
+}
+
+func TestNewClientRootCAs(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	pool := ts.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	if _, err := NewClient(AnonymousSigner{}, nil).Get(ts.URL); err == nil {
+		t.Error("expected the certificate to be rejected")
+	}
+	for _, opts := range []*ClientOptions{{RootCAs: pool}, {InsecureSkipVerify: true}} {
+		resp, err := NewClient(AnonymousSigner{}, opts).Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+}
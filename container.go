@@ -0,0 +1,169 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// containerHost is the host serving the credentials of ECS tasks.
+const containerHost = "http://169.254.170.2"
+
+// The addresses of the EKS Pod Identity agent.
+const (
+	eksPodIdentityHost     = "169.254.170.23"
+	eksPodIdentityHostIPv6 = "fd00:ec2::23"
+)
+
+// ContainerProvider provides the credentials of the role of an ECS task or
+// an EKS pod, served by the container credentials endpoint. The endpoint
+// rotates the keys hours before they expire, they are fetched again shortly
+// before their expiration.
+type ContainerProvider struct {
+	// URL is the URL of the endpoint, it defaults to the one described by
+	// the AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or
+	// AWS_CONTAINER_CREDENTIALS_FULL_URI environment variables. The full URI
+	// must use HTTPS or point to a loopback address or to the EKS Pod
+	// Identity agent, so the token is not sent to another host.
+	URL string
+
+	// AuthToken is sent as the Authorization header, it defaults to
+	// AWS_CONTAINER_AUTHORIZATION_TOKEN or to the content of the file at
+	// AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE.
+	AuthToken string
+
+	// Client is the client used to reach the endpoint, it defaults to
+	// http.DefaultClient.
+	Client *http.Client
+
+	cache keyCache
+}
+
+// Retrieve implements the Credentials interface.
+func (p *ContainerProvider) Retrieve(ctx context.Context) (Keys, error) {
+	return p.cache.retrieve(ctx, func(keys Keys) bool {
+		return expired(keys, nil, 0)
+	}, p.fetch)
+}
+
+func (p *ContainerProvider) fetch(ctx context.Context) (Keys, error) {
+	u := p.URL
+	if u == "" {
+		if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+			u = containerHost + rel
+		} else if u = os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); u != "" {
+			if err := checkContainerURL(u); err != nil {
+				return Keys{}, err
+			}
+		}
+	}
+	if u == "" {
+		return Keys{}, ErrNoCredentials
+	}
+	token, err := p.authToken()
+	if err != nil {
+		return Keys{}, err
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return Keys{}, err
+	}
+	req = req.WithContext(ctx)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	c := p.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return Keys{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return Keys{}, fmt.Errorf("aws: unexpected container credentials response: (%d)", resp.StatusCode)
+	}
+	return decodeKeys(resp.Body)
+}
+
+// checkContainerURL checks a full URI of the container credentials endpoint
+// is either served over HTTPS or by a local agent.
+func checkContainerURL(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "https" {
+		return nil
+	}
+	host := u.Hostname()
+	if host == "localhost" || host == eksPodIdentityHost || host == eksPodIdentityHostIPv6 {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("aws: container credentials endpoint %s is neither HTTPS nor local", u.Host)
+}
+
+func (p *ContainerProvider) authToken() (string, error) {
+	if p.AuthToken != "" {
+		return p.AuthToken, nil
+	}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		return token, nil
+	}
+	if name := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); name != "" {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return "", nil
+}
+
+// decodeKeys decodes keys in the JSON format shared by the credentials
+// endpoints and processes.
+func decodeKeys(r io.Reader) (Keys, error) {
+	var v struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		SessionToken    string
+		Expiration      string
+	}
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return Keys{}, fmt.Errorf("aws: malformed credentials: %v", err)
+	}
+	if v.AccessKeyID == "" || v.SecretAccessKey == "" {
+		return Keys{}, errors.New("aws: malformed credentials: missing keys")
+	}
+	keys := Keys{
+		AccessKey:     v.AccessKeyID,
+		SecretKey:     v.SecretAccessKey,
+		SecurityToken: v.Token,
+	}
+	if keys.SecurityToken == "" {
+		keys.SecurityToken = v.SessionToken
+	}
+	if v.Expiration != "" {
+		expires, err := time.Parse(time.RFC3339, v.Expiration)
+		if err != nil {
+			return Keys{}, fmt.Errorf("aws: malformed credentials expiration: %v", err)
+		}
+		keys.Expires = expires
+	}
+	return keys, nil
+}
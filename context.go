@@ -0,0 +1,48 @@
+package aws
+
+import "context"
+
+type (
+	operationKey struct{}
+	requestIDKey struct{}
+	signerKey    struct{}
+)
+
+// WithOperation returns a copy of ctx carrying the name of the API operation
+// a request belongs to, as reported to the Transport hooks.
+func WithOperation(ctx context.Context, op string) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+// Operation returns the name of the API operation carried by ctx, if any.
+func Operation(ctx context.Context) string {
+	op, _ := ctx.Value(operationKey{}).(string)
+	return op
+}
+
+// WithRequestID returns a copy of ctx carrying a caller supplied request id,
+// which is reported to the Transport hooks and logged along the request id
+// of AWS, to correlate application logs with server logs.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the caller supplied request id carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithSigner returns a copy of ctx carrying a signer which overrides the
+// Signer of the Transport for the requests using it, e.g. to sign the
+// requests of each tenant of a process with their own credentials through
+// a shared client.
+func WithSigner(ctx context.Context, s Signer) context.Context {
+	return context.WithValue(ctx, signerKey{}, s)
+}
+
+// contextSigner returns the signer carried by ctx, if any.
+func contextSigner(ctx context.Context) Signer {
+	s, _ := ctx.Value(signerKey{}).(Signer)
+	return s
+}
@@ -0,0 +1,234 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoCredentials is returned when no credentials are available.
+var ErrNoCredentials = errors.New("aws: no credentials found")
+
+// Keys are the keys signing requests.
+type Keys struct {
+	AccessKey     string
+	SecretKey     string
+	SecurityToken string
+
+	// Expires is when temporary keys expire, it is zero for long-term keys.
+	Expires time.Time
+}
+
+// Credentials provides the keys signing requests.
+type Credentials interface {
+	Retrieve(ctx context.Context) (Keys, error)
+}
+
+// StaticProvider provides fixed keys.
+type StaticProvider Keys
+
+// Retrieve implements the Credentials interface.
+func (p StaticProvider) Retrieve(context.Context) (Keys, error) {
+	if p.AccessKey == "" || p.SecretKey == "" {
+		return Keys{}, ErrNoCredentials
+	}
+	return Keys(p), nil
+}
+
+// EnvProvider provides the keys set in the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+type EnvProvider struct{}
+
+// Retrieve implements the Credentials interface.
+func (EnvProvider) Retrieve(ctx context.Context) (Keys, error) {
+	token := os.Getenv("AWS_SESSION_TOKEN")
+	if token == "" {
+		token = os.Getenv("AWS_SECURITY_TOKEN")
+	}
+	return StaticProvider{
+		AccessKey:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:     os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SecurityToken: token,
+	}.Retrieve(ctx)
+}
+
+// ChainProvider provides the keys of the first of its providers that
+// succeeds. The provider is remembered and used until it fails, then the
+// chain is tried again.
+type ChainProvider struct {
+	Providers []Credentials
+
+	mu     sync.Mutex
+	winner Credentials
+}
+
+// Retrieve implements the Credentials interface.
+func (p *ChainProvider) Retrieve(ctx context.Context) (Keys, error) {
+	p.mu.Lock()
+	winner := p.winner
+	p.mu.Unlock()
+	if winner != nil {
+		if keys, err := winner.Retrieve(ctx); err == nil {
+			return keys, nil
+		}
+	}
+
+	var errs []error
+	for _, c := range p.Providers {
+		keys, err := c.Retrieve(ctx)
+		if err == nil {
+			p.mu.Lock()
+			p.winner = c
+			p.mu.Unlock()
+			return keys, nil
+		}
+		errs = append(errs, err)
+	}
+	p.mu.Lock()
+	p.winner = nil
+	p.mu.Unlock()
+	if len(errs) == 0 {
+		return Keys{}, ErrNoCredentials
+	}
+	return Keys{}, &ChainError{Errors: errs}
+}
+
+// NewDefaultCredentials returns the chain of providers looked up by the AWS
+// SDKs and CLI by default: the environment variables, the shared
+// credentials file, the container credentials endpoint and the instance
+// metadata service.
+func NewDefaultCredentials() *ChainProvider {
+	return &ChainProvider{
+		Providers: []Credentials{
+			EnvProvider{},
+			&SharedCredentialsProvider{},
+			&ContainerProvider{},
+			&IMDSProvider{},
+		},
+	}
+}
+
+// ChainError is returned when all the providers of a ChainProvider failed.
+type ChainError struct {
+	// Errors are the errors of each provider.
+	Errors []error
+}
+
+func (e *ChainError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "aws: no credentials found: " + strings.Join(msgs, "; ")
+}
+
+// Is reports ChainError as ErrNoCredentials.
+func (e *ChainError) Is(target error) bool {
+	return target == ErrNoCredentials
+}
+
+// DefaultExpiryWindow is how long before they expire keys cached by a
+// CachedProvider are refreshed.
+const DefaultExpiryWindow = 5 * time.Minute
+
+// CachedProvider caches the keys of a provider of temporary credentials, and
+// refreshes them shortly before they expire. Concurrent callers share a
+// single refresh.
+type CachedProvider struct {
+	Provider Credentials
+
+	// ExpiryWindow is how long before they expire keys are refreshed, it
+	// defaults to DefaultExpiryWindow.
+	ExpiryWindow time.Duration
+
+	// Clock returns the current time against which the expiry of the keys
+	// is checked, it defaults to time.Now.
+	Clock func() time.Time
+
+	cache keyCache
+}
+
+// Retrieve implements the Credentials interface.
+func (p *CachedProvider) Retrieve(ctx context.Context) (Keys, error) {
+	return p.cache.retrieve(ctx, func(keys Keys) bool {
+		return expired(keys, p.Clock, p.ExpiryWindow)
+	}, p.Provider.Retrieve)
+}
+
+// Invalidate drops the cached keys, they are retrieved again on next use.
+func (p *CachedProvider) Invalidate() {
+	p.cache.invalidate()
+}
+
+// expired reports whether keys expire within window of the time returned by
+// clock, the window defaults to DefaultExpiryWindow and the clock to
+// time.Now.
+func expired(keys Keys, clock func() time.Time, window time.Duration) bool {
+	if keys.Expires.IsZero() {
+		return false
+	}
+	if clock == nil {
+		clock = time.Now
+	}
+	if window == 0 {
+		window = DefaultExpiryWindow
+	}
+	return !clock().Before(keys.Expires.Add(-window))
+}
+
+// keyCache caches the keys of a provider of temporary credentials. The keys
+// are fetched without holding the lock, callers arriving during a refresh
+// wait for its result instead of starting their own.
+type keyCache struct {
+	mu      sync.Mutex
+	keys    *Keys
+	pending *refresh
+}
+
+// refresh is a fetch of keys in progress, done is closed once keys and err
+// are set.
+type refresh struct {
+	done chan struct{}
+	keys Keys
+	err  error
+}
+
+func (c *keyCache) retrieve(ctx context.Context, expired func(Keys) bool, fetch func(context.Context) (Keys, error)) (Keys, error) {
+	c.mu.Lock()
+	if c.keys != nil && !expired(*c.keys) {
+		keys := *c.keys
+		c.mu.Unlock()
+		return keys, nil
+	}
+	if r := c.pending; r != nil {
+		c.mu.Unlock()
+		select {
+		case <-r.done:
+			return r.keys, r.err
+		case <-ctx.Done():
+			return Keys{}, ctx.Err()
+		}
+	}
+	r := &refresh{done: make(chan struct{})}
+	c.pending = r
+	c.mu.Unlock()
+
+	r.keys, r.err = fetch(ctx)
+	c.mu.Lock()
+	if r.err == nil {
+		c.keys = &r.keys
+	}
+	c.pending = nil
+	c.mu.Unlock()
+	close(r.done)
+	return r.keys, r.err
+}
+
+func (c *keyCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = nil
+}
@@ -0,0 +1,115 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// imdsEndpoint is the endpoint of the EC2 instance metadata service.
+const imdsEndpoint = "http://169.254.169.254"
+
+// imdsClient is the client reaching the instance metadata service by
+// default, it gives up quickly as the service is local, and absent outside
+// of EC2.
+var imdsClient = &http.Client{Timeout: time.Second}
+
+// IMDSProvider provides the credentials of the role of an EC2 instance,
+// served by the instance metadata service with IMDSv2 session tokens. The
+// service rotates the keys well before they expire, they are fetched again
+// shortly before their expiration.
+type IMDSProvider struct {
+	// Endpoint is the endpoint of the metadata service, it defaults to
+	// AWS_EC2_METADATA_SERVICE_ENDPOINT or to http://169.254.169.254.
+	Endpoint string
+
+	// Client is the client used to reach the service, it defaults to a
+	// client timing out after a second.
+	Client *http.Client
+
+	cache keyCache
+}
+
+// Retrieve implements the Credentials interface. It returns ErrNoCredentials
+// when AWS_EC2_METADATA_DISABLED is true or the instance has no role.
+func (p *IMDSProvider) Retrieve(ctx context.Context) (Keys, error) {
+	return p.cache.retrieve(ctx, func(keys Keys) bool {
+		return expired(keys, nil, 0)
+	}, p.fetch)
+}
+
+func (p *IMDSProvider) fetch(ctx context.Context) (Keys, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return Keys{}, ErrNoCredentials
+	}
+	endpoint := strings.TrimSuffix(orEnv(p.Endpoint, "AWS_EC2_METADATA_SERVICE_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = imdsEndpoint
+	}
+	c := p.Client
+	if c == nil {
+		c = imdsClient
+	}
+
+	req, err := http.NewRequest("PUT", endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return Keys{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+	token, err := imdsDo(ctx, c, req)
+	if err != nil {
+		return Keys{}, err
+	}
+
+	const path = "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequest("GET", endpoint+path, nil)
+	if err != nil {
+		return Keys{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", string(token))
+	role, err := imdsDo(ctx, c, req)
+	if err != nil {
+		return Keys{}, err
+	}
+	// The instance has a single role, listed on the first line.
+	name := strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0])
+	if name == "" {
+		return Keys{}, ErrNoCredentials
+	}
+
+	req, err = http.NewRequest("GET", endpoint+path+name, nil)
+	if err != nil {
+		return Keys{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", string(token))
+	b, err := imdsDo(ctx, c, req)
+	if err != nil {
+		return Keys{}, err
+	}
+	return decodeKeys(bytes.NewReader(b))
+}
+
+// imdsDo sends a request to the instance metadata service and returns the
+// body of its response.
+func imdsDo(ctx context.Context, c *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case 200:
+		return ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	case 404:
+		// The instance has no role.
+		return nil, ErrNoCredentials
+	default:
+		return nil, fmt.Errorf("aws: unexpected instance metadata response: (%d)", resp.StatusCode)
+	}
+}
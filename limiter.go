@@ -0,0 +1,90 @@
+package aws
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Limiter caps the number of requests in flight, it can be shared by
+// several Transports to throttle a whole process.
+type Limiter struct {
+	sem chan struct{}
+}
+
+// NewLimiter returns a Limiter allowing n requests in flight.
+func NewLimiter(n int) *Limiter {
+	if n < 1 {
+		n = 1
+	}
+	return &Limiter{sem: make(chan struct{}, n)}
+}
+
+func (l *Limiter) acquire(ctx context.Context) error {
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) release() {
+	<-l.sem
+}
+
+// slots are the slots requests hold while in flight, Limiter and Ramp hand
+// them out.
+type slots interface {
+	acquire(ctx context.Context) error
+	release()
+}
+
+// holdSlot sends r with send while holding a slot of s, which is released
+// once the response body is closed.
+func holdSlot(s slots, r *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if err := s.acquire(r.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := send(r)
+	if err != nil {
+		s.release()
+		return nil, err
+	}
+	resp.Body = &releaser{ReadCloser: resp.Body, release: s.release}
+	return resp, nil
+}
+
+// releaser releases its slot of the limiter once the response body is
+// closed, since the request is in flight until then.
+type releaser struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaser) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// RoundTripper returns an http.RoundTripper sending requests with rt while
+// holding a slot of l, it allows to cap the requests of a single operation
+// below the limit of the shared Transport.
+func (l *Limiter) RoundTripper(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &limitedTransport{limiter: l, transport: rt}
+}
+
+type limitedTransport struct {
+	limiter   *Limiter
+	transport http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return holdSlot(t.limiter, r, t.transport.RoundTrip)
+}
@@ -0,0 +1,69 @@
+package aws
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type closeFunc func() error
+
+func (f closeFunc) Close() error { return f() }
+
+func TestLimiter(t *testing.T) {
+	const limit = 3
+	var inflight, max int32
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		resp := response(200)
+		resp.Body = struct {
+			*strings.Reader
+			closeFunc
+		}{strings.NewReader("ok"), func() error {
+			atomic.AddInt32(&inflight, -1)
+			return nil
+		}}
+		return resp, nil
+	})
+	// Transports sharing a limiter are throttled together.
+	l := NewLimiter(limit)
+	transports := []*Transport{
+		{Signer: AnonymousSigner{}, Transport: rt, Limiter: l},
+		{Signer: AnonymousSigner{}, Transport: rt, Limiter: l},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(transport *Transport) {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ioutil.ReadAll(resp.Body)
+			time.Sleep(time.Millisecond)
+			resp.Body.Close()
+		}(transports[i%2])
+	}
+	wg.Wait()
+	if max > limit {
+		t.Errorf("expected at most %d requests in flight, got %d", limit, max)
+	}
+	if max == 0 {
+		t.Error("expected requests to be sent")
+	}
+}
@@ -0,0 +1,82 @@
+package aws
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+var signatureRegexp = regexp.MustCompile(`Signature=[0-9a-f]+`)
+
+// WithLogging returns a RoundTripper logging the method, URL, status and
+// latency of each request made through inner. Signatures and security
+// tokens are redacted, request ids are logged when known. Set it as the
+// inner Transport field of a *Transport to log requests once signed.
+func WithLogging(inner http.RoundTripper, logger *log.Logger) http.RoundTripper {
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+	if logger == nil {
+		logger = log.New(log.Writer(), "", log.LstdFlags)
+	}
+	return &loggingTransport{inner: inner, logger: logger}
+}
+
+type loggingTransport struct {
+	inner  http.RoundTripper
+	logger *log.Logger
+}
+
+func (t *loggingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.inner.RoundTrip(r)
+	latency := time.Since(start)
+
+	extra := ""
+	if id := RequestID(r.Context()); id != "" {
+		extra = " request_id=" + strconv.Quote(id)
+	}
+	if a := r.Header.Get("Authorization"); a != "" {
+		extra += " authorization=" + redactAuthorization(a)
+	}
+	if err != nil {
+		t.logger.Printf("%s %s error=%q latency=%s%s", r.Method, redactURL(r.URL), err, latency, extra)
+		return resp, err
+	}
+	if id := amzRequestID(resp.Header); id != "" {
+		extra = " amz_request_id=" + strconv.Quote(id) + extra
+	}
+	t.logger.Printf("%s %s status=%d latency=%s%s", r.Method, redactURL(r.URL), resp.StatusCode, latency, extra)
+	return resp, err
+}
+
+// redactAuthorization keeps the credential scope and the signed headers of
+// an Authorization header as they help debugging signatures.
+func redactAuthorization(v string) string {
+	if !signatureRegexp.MatchString(v) {
+		return `"` + redacted + `"`
+	}
+	return `"` + signatureRegexp.ReplaceAllString(v, "Signature="+redacted) + `"`
+}
+
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	secret := false
+	for _, k := range []string{"X-Amz-Signature", "X-Amz-Security-Token"} {
+		if _, ok := q[k]; ok {
+			q.Set(k, redacted)
+			secret = true
+		}
+	}
+	if !secret {
+		return u.String()
+	}
+	c := *u
+	c.RawQuery = q.Encode()
+	return c.String()
+}
@@ -0,0 +1,38 @@
+package aws
+
+import "time"
+
+// Collector collects metrics about the requests sent by a Transport, such as
+// request rate, error rate and latency.
+//
+// It allows plugging in any metrics system, an adapter to Prometheus would
+// look like:
+//
+//	type prometheusCollector struct {
+//	    requests *prometheus.CounterVec
+//	    duration *prometheus.HistogramVec
+//	    bytes    *prometheus.CounterVec
+//	}
+//
+//	func newPrometheusCollector(r prometheus.Registerer) *prometheusCollector {
+//	    c := &prometheusCollector{
+//	        requests: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "aws_requests_total"}, []string{"op", "status"}),
+//	        duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "aws_request_duration_seconds"}, []string{"op"}),
+//	        bytes:    prometheus.NewCounterVec(prometheus.CounterOpts{Name: "aws_transferred_bytes_total"}, []string{"op"}),
+//	    }
+//	    r.MustRegister(c.requests, c.duration, c.bytes)
+//	    return c
+//	}
+//
+//	func (c *prometheusCollector) ObserveRequest(op string, status int, dur time.Duration, bytes int64) {
+//	    c.requests.WithLabelValues(op, strconv.Itoa(status)).Inc()
+//	    c.duration.WithLabelValues(op).Observe(dur.Seconds())
+//	    c.bytes.WithLabelValues(op).Add(float64(bytes))
+//	}
+type Collector interface {
+	// ObserveRequest is called after each request with the API operation,
+	// as set by WithOperation, the status code of the response, 0 if the
+	// request failed, the time spent until the response headers were
+	// received and the number of bytes exchanged.
+	ObserveRequest(op string, status int, dur time.Duration, bytes int64)
+}
@@ -0,0 +1,64 @@
+package aws
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type observation struct {
+	op     string
+	status int
+	dur    time.Duration
+	bytes  int64
+}
+
+type fakeCollector struct {
+	observations []observation
+}
+
+func (c *fakeCollector) ObserveRequest(op string, status int, dur time.Duration, bytes int64) {
+	c.observations = append(c.observations, observation{op, status, dur, bytes})
+}
+
+func TestTransportCollector(t *testing.T) {
+	c := &fakeCollector{}
+	var attempts int
+	transport := &Transport{
+		Signer: AnonymousSigner{},
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			attempts++
+			time.Sleep(time.Millisecond)
+			switch attempts {
+			case 1:
+				return nil, errors.New("connection reset")
+			case 2:
+				return response(503), nil
+			}
+			resp := response(200)
+			resp.ContentLength = 42
+			return resp, nil
+		}),
+		RetryPolicy: &RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		Collector:   c,
+	}
+	req, _ := http.NewRequest("PUT", "https://examplebucket.s3.amazonaws.com/test.txt", strings.NewReader("payload"))
+	req = req.WithContext(WithOperation(req.Context(), "PutObject"))
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.observations) != 3 {
+		t.Fatalf("expected every attempt to be observed, got %v", c.observations)
+	}
+	for i, status := range []int{0, 503, 200} {
+		o := c.observations[i]
+		if o.op != "PutObject" || o.status != status || o.dur < time.Millisecond {
+			t.Errorf("(%d) unexpected observation %+v", i, o)
+		}
+	}
+	if o := c.observations[2]; o.bytes != 49 {
+		t.Errorf("expected 49 bytes exchanged, got %d", o.bytes)
+	}
+}
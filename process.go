@@ -0,0 +1,95 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ProcessProvider provides the credentials printed by an external command,
+// as configured by credential_process in the shared config file. The
+// command is only run again shortly before the Expiration it printed, keys
+// printed without one are kept for the life of the provider.
+type ProcessProvider struct {
+	// Command is the command to run, it defaults to the credential_process
+	// of Profile.
+	Command string
+
+	// Profile is the profile of the shared config file, it defaults to
+	// AWS_PROFILE or to default.
+	Profile string
+
+	// ConfigFile is the shared config file, it defaults to AWS_CONFIG_FILE
+	// or to ~/.aws/config.
+	ConfigFile string
+
+	cache keyCache
+}
+
+// Retrieve implements the Credentials interface.
+func (p *ProcessProvider) Retrieve(ctx context.Context) (Keys, error) {
+	return p.cache.retrieve(ctx, func(keys Keys) bool {
+		return expired(keys, nil, 0)
+	}, p.fetch)
+}
+
+func (p *ProcessProvider) fetch(ctx context.Context) (Keys, error) {
+	command := p.Command
+	if command == "" {
+		profile, err := loadProfile(p.ConfigFile, p.Profile)
+		if err != nil {
+			return Keys{}, err
+		}
+		if command = profile["credential_process"]; command == "" {
+			return Keys{}, ErrNoCredentials
+		}
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd.exe", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Keys{}, fmt.Errorf("aws: credential process failed: %v: %s", err, msg)
+		}
+		return Keys{}, fmt.Errorf("aws: credential process failed: %v", err)
+	}
+
+	var v struct {
+		Version         int
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		SessionToken    string
+		Expiration      *time.Time
+	}
+	if err := json.Unmarshal(out, &v); err != nil {
+		return Keys{}, fmt.Errorf("aws: malformed credential process output: %v", err)
+	}
+	if v.Version != 1 {
+		return Keys{}, fmt.Errorf("aws: unsupported credential process output version %d", v.Version)
+	}
+	if v.AccessKeyID == "" || v.SecretAccessKey == "" {
+		return Keys{}, errors.New("aws: malformed credential process output: missing keys")
+	}
+	keys := Keys{
+		AccessKey:     v.AccessKeyID,
+		SecretKey:     v.SecretAccessKey,
+		SecurityToken: v.SessionToken,
+	}
+	if v.Expiration != nil {
+		keys.Expires = *v.Expiration
+	}
+	return keys, nil
+}
@@ -0,0 +1,119 @@
+package aws
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configFile returns the path of the shared config file, AWS_CONFIG_FILE or
+// ~/.aws/config.
+func configFile(name string) string {
+	if name = orEnv(name, "AWS_CONFIG_FILE"); name != "" {
+		return name
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".aws", "config")
+}
+
+// profileName returns the name of the profile, AWS_PROFILE or default.
+func profileName(name string) string {
+	if name = orEnv(name, "AWS_PROFILE"); name != "" {
+		return name
+	}
+	return "default"
+}
+
+// loadSection returns the keys of the given section of an INI file, such
+// as the shared config file.
+func loadSection(file, section string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		current string
+		found   bool
+		keys    = make(map[string]string)
+		s       = bufio.NewScanner(f)
+	)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			current = strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			found = found || current == section
+		case current == section:
+			if i := strings.Index(line, "="); i > 0 {
+				keys[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("aws: no section %q in %s", section, file)
+	}
+	return keys, nil
+}
+
+// loadProfile returns the keys of the given profile of the shared config
+// file.
+func loadProfile(file, name string) (map[string]string, error) {
+	name = profileName(name)
+	section := "profile " + name
+	if name == "default" {
+		section = name
+	}
+	return loadSection(configFile(file), section)
+}
+
+// credentialsFile returns the path of the shared credentials file,
+// AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials.
+func credentialsFile(name string) string {
+	if name = orEnv(name, "AWS_SHARED_CREDENTIALS_FILE"); name != "" {
+		return name
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".aws", "credentials")
+}
+
+// SharedCredentialsProvider provides the keys of a profile of the shared
+// credentials file, as written by aws configure.
+type SharedCredentialsProvider struct {
+	// Profile is the name of the profile, it defaults to AWS_PROFILE or
+	// default.
+	Profile string
+
+	// File is the path of the shared credentials file, it defaults to
+	// AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials.
+	File string
+}
+
+// Retrieve implements the Credentials interface.
+func (p *SharedCredentialsProvider) Retrieve(context.Context) (Keys, error) {
+	// Unlike the config file, sections are not prefixed with profile.
+	keys, err := loadSection(credentialsFile(p.File), profileName(p.Profile))
+	if errors.Is(err, os.ErrNotExist) {
+		return Keys{}, ErrNoCredentials
+	}
+	if err != nil {
+		return Keys{}, err
+	}
+	if keys["aws_access_key_id"] == "" || keys["aws_secret_access_key"] == "" {
+		return Keys{}, fmt.Errorf("aws: no keys in profile %s of %s", profileName(p.Profile), credentialsFile(p.File))
+	}
+	return Keys{
+		AccessKey:     keys["aws_access_key_id"],
+		SecretKey:     keys["aws_secret_access_key"],
+		SecurityToken: keys["aws_session_token"],
+	}, nil
+}
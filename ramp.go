@@ -0,0 +1,120 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Ramp caps the number of requests in flight like a Limiter, but its limit
+// starts low and doubles as requests succeed, so a burst of requests to a
+// new S3 prefix doesn't get throttled while S3 scales up. The limit is
+// halved every time a request is throttled.
+type Ramp struct {
+	mu       sync.Mutex
+	limit    int
+	max      int
+	inflight int
+	// succeeded counts the requests which succeeded since the limit last
+	// changed, the limit doubles once as many requests as the limit have
+	// succeeded.
+	succeeded int
+	// changed is closed when a slot may have been freed.
+	changed chan struct{}
+}
+
+// NewRamp returns a Ramp allowing initial requests in flight at first, up
+// to max, or without maximum if max is 0.
+func NewRamp(initial, max int) *Ramp {
+	if initial < 1 {
+		initial = 1
+	}
+	if max > 0 && initial > max {
+		initial = max
+	}
+	return &Ramp{limit: initial, max: max, changed: make(chan struct{})}
+}
+
+// Limit returns the current number of requests allowed in flight.
+func (r *Ramp) Limit() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.limit
+}
+
+func (r *Ramp) acquire(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		if r.inflight < r.limit {
+			r.inflight++
+			r.mu.Unlock()
+			return nil
+		}
+		changed := r.changed
+		r.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *Ramp) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inflight--
+	r.notify()
+}
+
+// record adjusts the limit after the response of a request.
+func (r *Ramp) record(resp *http.Response, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case resp != nil && (resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests):
+		r.limit /= 2
+		if r.limit < 1 {
+			r.limit = 1
+		}
+		r.succeeded = 0
+	case err == nil && resp.StatusCode < 500:
+		r.succeeded++
+		if r.succeeded >= r.limit && (r.max <= 0 || r.limit < r.max) {
+			r.limit *= 2
+			if r.max > 0 && r.limit > r.max {
+				r.limit = r.max
+			}
+			r.succeeded = 0
+			r.notify()
+		}
+	}
+}
+
+// notify wakes up the requests waiting for a slot, r.mu must be held.
+func (r *Ramp) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// RoundTripper returns an http.RoundTripper sending requests with rt while
+// holding a slot of r until their response body is closed.
+func (r *Ramp) RoundTripper(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &rampTransport{ramp: r, transport: rt}
+}
+
+type rampTransport struct {
+	ramp      *Ramp
+	transport http.RoundTripper
+}
+
+func (t *rampTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return holdSlot(t.ramp, r, func(r *http.Request) (*http.Response, error) {
+		resp, err := t.transport.RoundTrip(r)
+		t.ramp.record(resp, err)
+		return resp, err
+	})
+}
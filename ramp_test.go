@@ -0,0 +1,108 @@
+package aws
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRamp(t *testing.T) {
+	var status int32 = 200
+	r := NewRamp(1, 8)
+	rt := r.RoundTripper(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return response(int(atomic.LoadInt32(&status))), nil
+	}))
+	send := func() {
+		req, _ := http.NewRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// The limit doubles once as many requests as the limit succeeded.
+	var limits []int
+	for i := 0; i < 15; i++ {
+		send()
+		limits = append(limits, r.Limit())
+	}
+	expected := []int{2, 2, 4, 4, 4, 4, 8, 8, 8, 8, 8, 8, 8, 8, 8}
+	for i := range expected {
+		if limits[i] != expected[i] {
+			t.Fatalf("expected limits %v, got %v", expected, limits)
+		}
+	}
+
+	// Throttled requests halve it.
+	atomic.StoreInt32(&status, 503)
+	for _, expected := range []int{4, 2, 1, 1} {
+		send()
+		if l := r.Limit(); l != expected {
+			t.Errorf("expected a limit of %d, got %d", expected, l)
+		}
+	}
+	atomic.StoreInt32(&status, 200)
+	send()
+	if l := r.Limit(); l != 2 {
+		t.Errorf("expected the limit to ramp up again, got %d", l)
+	}
+}
+
+func TestRampInflight(t *testing.T) {
+	var inflight, max int32
+	r := NewRamp(1, 0)
+	rt := r.RoundTripper(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+		return response(200), nil
+	}))
+
+	// The first requests are sent one at a time.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	if max > 2 {
+		t.Errorf("expected at most 2 requests in flight, got %d", max)
+	}
+
+	// Up to the ramped limit.
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	if max <= 2 {
+		t.Errorf("expected the concurrency to ramp up, got %d requests in flight at most", max)
+	}
+}
@@ -0,0 +1,111 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRetryPolicy is the RetryPolicy used when none is given.
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  20 * time.Second,
+}
+
+// RetryPolicy describes how failed requests are retried.
+//
+// Requests failing with a network error, a 5xx or a 429 status code are
+// retried with an exponential backoff, following Amazon recommendations.
+// https://docs.aws.amazon.com/general/latest/gr/api-retries.html
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts made, including the
+	// first one. Values lower than 1 are treated as 1.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry, it doubles on
+	// subsequent retries.
+	MinBackoff time.Duration
+
+	// MaxBackoff caps the delay between two attempts, Retry-After
+	// included. The delay isn't capped if it's zero.
+	MaxBackoff time.Duration
+
+	// RetryableFunc, if set, extends the default classification: requests
+	// that wouldn't be retried by default are retried when it returns true.
+	// It allows retrying the idiosyncratic errors of S3 compatible stores.
+	RetryableFunc func(resp *http.Response, err error) bool
+}
+
+// Retryable reports whether a request that resulted in the given response
+// or error should be retried.
+func (p *RetryPolicy) Retryable(resp *http.Response, err error) bool {
+	if retryable(resp, err) {
+		return true
+	}
+	return p.RetryableFunc != nil && p.RetryableFunc(resp, err)
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// Attempts returns the maximum number of attempts allowed by the policy.
+func (p *RetryPolicy) Attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// Backoff returns the delay to observe before the given retry, starting at
+// 1. A Retry-After header in resp takes precedence over the computed backoff,
+// both are capped by MaxBackoff if set.
+func (p *RetryPolicy) Backoff(retry int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			if p.MaxBackoff > 0 && d > p.MaxBackoff {
+				d = p.MaxBackoff
+			}
+			return d
+		}
+	}
+	d := p.MinBackoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		if d > math.MaxInt64/2 {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// Add jitter to avoid retrying in lockstep.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,117 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	var tests = []struct {
+		Response  *http.Response
+		Error     error
+		Retryable bool
+	}{
+		{Error: errors.New("connection reset"), Retryable: true},
+		{Error: context.Canceled},
+		{Response: &http.Response{StatusCode: 500}, Retryable: true},
+		{Response: &http.Response{StatusCode: 503}, Retryable: true},
+		{Response: &http.Response{StatusCode: 429}, Retryable: true},
+		{Response: &http.Response{StatusCode: 404}},
+		{Response: &http.Response{StatusCode: 200}},
+	}
+	for i, test := range tests {
+		if r := DefaultRetryPolicy.Retryable(test.Response, test.Error); r != test.Retryable {
+			t.Errorf("(%d) expected retryable to be %t", i, test.Retryable)
+		}
+	}
+}
+
+func TestRetryableFunc(t *testing.T) {
+	// 409 OperationAborted reports a conflicting operation in progress,
+	// which is worth retrying.
+	p := &RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		RetryableFunc: func(resp *http.Response, err error) bool {
+			return resp != nil && resp.StatusCode == 409 && resp.Header.Get("X-Error-Code") == "OperationAborted"
+		},
+	}
+	var tests = []struct {
+		Response  *http.Response
+		Retryable bool
+	}{
+		{&http.Response{StatusCode: 409, Header: http.Header{"X-Error-Code": {"OperationAborted"}}}, true},
+		{&http.Response{StatusCode: 409, Header: http.Header{}}, false},
+		{&http.Response{StatusCode: 520, Header: http.Header{}}, true},
+		{&http.Response{StatusCode: 404, Header: http.Header{}}, false},
+	}
+	for i, test := range tests {
+		if r := p.Retryable(test.Response, nil); r != test.Retryable {
+			t.Errorf("(%d) expected retryable to be %t", i, test.Retryable)
+		}
+	}
+
+	var attempts int
+	transport := &Transport{
+		Signer: testSigner,
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			attempts++
+			if attempts == 1 {
+				resp := response(409)
+				resp.Header.Set("X-Error-Code", "OperationAborted")
+				return resp, nil
+			}
+			return response(200), nil
+		}),
+		RetryPolicy: p,
+	}
+	req, _ := http.NewRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || attempts != 2 {
+		t.Errorf("expected a retry, got %d after %d attempts", resp.StatusCode, attempts)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := &RetryPolicy{
+		MinBackoff: time.Second,
+		MaxBackoff: 4 * time.Second,
+	}
+	var tests = []struct {
+		Retry int
+		Max   time.Duration
+	}{
+		{Retry: 1, Max: time.Second},
+		{Retry: 2, Max: 2 * time.Second},
+		{Retry: 3, Max: 4 * time.Second},
+		{Retry: 10, Max: 4 * time.Second},
+	}
+	for _, test := range tests {
+		if d := p.Backoff(test.Retry, nil); d < test.Max/2 || d > test.Max {
+			t.Errorf("(%d) unexpected backoff %s", test.Retry, d)
+		}
+	}
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3"}}}
+	if d := p.Backoff(1, resp); d != 3*time.Second {
+		t.Errorf("expected Retry-After to be honored, got %s", d)
+	}
+	resp.Header.Set("Retry-After", "3600")
+	if d := p.Backoff(1, resp); d != 4*time.Second {
+		t.Errorf("expected Retry-After to be capped, got %s", d)
+	}
+
+	// Without MaxBackoff the delay keeps growing.
+	p.MaxBackoff = 0
+	if d := p.Backoff(4, nil); d < 4*time.Second || d > 8*time.Second {
+		t.Errorf("expected the backoff to grow, got %s", d)
+	}
+	if d := p.Backoff(100, nil); d <= 0 {
+		t.Errorf("expected the backoff not to overflow, got %s", d)
+	}
+}
@@ -0,0 +1,174 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogEntry is a line of the server access logs of a bucket. Fields logged
+// as "-" are left empty.
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/LogFormat.html
+type LogEntry struct {
+	BucketOwner    string
+	Bucket         string
+	Time           time.Time
+	RemoteIP       string
+	Requester      string
+	RequestID      string
+	Operation      string
+	Key            string
+	RequestURI     string
+	HTTPStatus     int
+	ErrorCode      string
+	BytesSent      int64
+	ObjectSize     int64
+	TotalTime      time.Duration
+	TurnAroundTime time.Duration
+	Referer        string
+	UserAgent      string
+	VersionID      string
+
+	// The following fields are missing from older logs.
+	HostID             string
+	SignatureVersion   string
+	CipherSuite        string
+	AuthenticationType string
+	HostHeader         string
+	TLSVersion         string
+	AccessPointARN     string
+	ACLRequired        bool
+}
+
+// logTimeLayout is the layout of the time of access log lines.
+const logTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// minLogFields is the number of fields of the oldest access log lines, up
+// to the version ID, and logFields the number of fields of LogEntry.
+const (
+	minLogFields = 18
+	logFields    = 26
+)
+
+// ParseLogEntry parses a line of the server access logs of a bucket, as
+// downloaded with e.g. Lines. Fields added to the format after the ones
+// of LogEntry are ignored.
+func ParseLogEntry(line string) (*LogEntry, error) {
+	fields, err := splitLogLine(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < minLogFields {
+		return nil, fmt.Errorf("s3: access log line has %d fields, expected at least %d", len(fields), minLogFields)
+	}
+	for len(fields) < logFields {
+		fields = append(fields, "")
+	}
+
+	e := &LogEntry{
+		BucketOwner:        fields[0],
+		Bucket:             fields[1],
+		RemoteIP:           fields[3],
+		Requester:          fields[4],
+		RequestID:          fields[5],
+		Operation:          fields[6],
+		Key:                fields[7],
+		RequestURI:         fields[8],
+		ErrorCode:          fields[10],
+		Referer:            fields[15],
+		UserAgent:          fields[16],
+		VersionID:          fields[17],
+		HostID:             fields[18],
+		SignatureVersion:   fields[19],
+		CipherSuite:        fields[20],
+		AuthenticationType: fields[21],
+		HostHeader:         fields[22],
+		TLSVersion:         fields[23],
+		AccessPointARN:     fields[24],
+		ACLRequired:        fields[25] == "Yes",
+	}
+	if e.Time, err = time.Parse(logTimeLayout, fields[2]); err != nil {
+		return nil, fmt.Errorf("s3: cannot parse access log time: %w", err)
+	}
+	if fields[9] != "" {
+		if e.HTTPStatus, err = strconv.Atoi(fields[9]); err != nil {
+			return nil, fmt.Errorf("s3: cannot parse access log status: %w", err)
+		}
+	}
+	for _, f := range []struct {
+		s string
+		v *int64
+	}{
+		{fields[11], &e.BytesSent},
+		{fields[12], &e.ObjectSize},
+	} {
+		if f.s == "" {
+			continue
+		}
+		if *f.v, err = strconv.ParseInt(f.s, 10, 64); err != nil {
+			return nil, fmt.Errorf("s3: cannot parse access log size: %w", err)
+		}
+	}
+	for _, f := range []struct {
+		s string
+		v *time.Duration
+	}{
+		{fields[13], &e.TotalTime},
+		{fields[14], &e.TurnAroundTime},
+	} {
+		if f.s == "" {
+			continue
+		}
+		ms, err := strconv.ParseInt(f.s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("s3: cannot parse access log time: %w", err)
+		}
+		*f.v = time.Duration(ms) * time.Millisecond
+	}
+	return e, nil
+}
+
+// splitLogLine splits an access log line into its fields, without the
+// brackets or quotes around them. Fields are separated by spaces, the time
+// is between brackets and fields which can hold spaces, such as the request
+// URI or the user agent, between quotes. Fields logged as "-" are returned
+// empty.
+func splitLogLine(line string) ([]string, error) {
+	var fields []string
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimLeft(line, " ") {
+		var field string
+		switch line[0] {
+		case '[':
+			i := strings.IndexByte(line, ']')
+			if i < 0 {
+				return nil, errors.New("s3: unterminated bracket in access log line")
+			}
+			field, line = line[1:i], line[i+1:]
+		case '"':
+			// A quoted field ends at a quote followed by a space or the end
+			// of the line.
+			i := strings.Index(line[1:], "\" ")
+			switch {
+			case i >= 0:
+				field, line = line[1:i+1], line[i+2:]
+			case len(line) > 1 && line[len(line)-1] == '"':
+				field, line = line[1:len(line)-1], ""
+			default:
+				return nil, errors.New("s3: unterminated quote in access log line")
+			}
+		default:
+			i := strings.IndexByte(line, ' ')
+			if i < 0 {
+				i = len(line)
+			}
+			field, line = line[:i], line[i:]
+		}
+		if field == "-" {
+			field = ""
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
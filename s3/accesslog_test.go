@@ -0,0 +1,111 @@
+package s3
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLogEntry(t *testing.T) {
+	var tests = []struct {
+		line  string
+		entry *LogEntry
+	}{
+		{
+			`79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be awsexamplebucket1 [06/Feb/2019:00:00:38 +0000] 192.0.2.3 79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be 3E57427F3EXAMPLE REST.GET.VERSIONING - "GET /awsexamplebucket1?versioning HTTP/1.1" 200 - 113 - 7 - "-" "S3Console/0.4" - s9lzHYrFp76ZVxRcpX9+5cjAnEH2ROuNkd2BHfIa6UkFVdtjf5mKR3/eTPFvsiP/XV/VLi31234= SigV4 ECDHE-RSA-AES128-GCM-SHA256 AuthHeader awsexamplebucket1.s3.us-west-1.amazonaws.com TLSV1.2 arn:aws:s3:us-west-1:123456789012:accesspoint/example-AP Yes`,
+			&LogEntry{
+				BucketOwner:        "79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be",
+				Bucket:             "awsexamplebucket1",
+				Time:               time.Date(2019, 2, 6, 0, 0, 38, 0, time.UTC),
+				RemoteIP:           "192.0.2.3",
+				Requester:          "79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be",
+				RequestID:          "3E57427F3EXAMPLE",
+				Operation:          "REST.GET.VERSIONING",
+				RequestURI:         "GET /awsexamplebucket1?versioning HTTP/1.1",
+				HTTPStatus:         200,
+				BytesSent:          113,
+				TotalTime:          7 * time.Millisecond,
+				UserAgent:          "S3Console/0.4",
+				HostID:             "s9lzHYrFp76ZVxRcpX9+5cjAnEH2ROuNkd2BHfIa6UkFVdtjf5mKR3/eTPFvsiP/XV/VLi31234=",
+				SignatureVersion:   "SigV4",
+				CipherSuite:        "ECDHE-RSA-AES128-GCM-SHA256",
+				AuthenticationType: "AuthHeader",
+				HostHeader:         "awsexamplebucket1.s3.us-west-1.amazonaws.com",
+				TLSVersion:         "TLSV1.2",
+				AccessPointARN:     "arn:aws:s3:us-west-1:123456789012:accesspoint/example-AP",
+				ACLRequired:        true,
+			},
+		},
+		{
+			`79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be awsexamplebucket1 [06/Feb/2019:00:00:38 +0000] 192.0.2.3 arn:aws:iam::123456789012:user/alice 891CE47D2EXAMPLE REST.PUT.OBJECT photos/2019/08/puppy.jpg "PUT /awsexamplebucket1/photos/2019/08/puppy.jpg?x-foo=bar HTTP/1.1" 403 AccessDenied 243 4096 26 - "https://example.com/upload" "Mozilla/5.0 (X11; Linux x86_64) Gecko/20100101 Firefox/68.0" 3HL4kqtJvjVBH40Nrjfkd - SigV4 - QueryString - - - -`,
+			&LogEntry{
+				BucketOwner:        "79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be",
+				Bucket:             "awsexamplebucket1",
+				Time:               time.Date(2019, 2, 6, 0, 0, 38, 0, time.UTC),
+				RemoteIP:           "192.0.2.3",
+				Requester:          "arn:aws:iam::123456789012:user/alice",
+				RequestID:          "891CE47D2EXAMPLE",
+				Operation:          "REST.PUT.OBJECT",
+				Key:                "photos/2019/08/puppy.jpg",
+				RequestURI:         "PUT /awsexamplebucket1/photos/2019/08/puppy.jpg?x-foo=bar HTTP/1.1",
+				HTTPStatus:         403,
+				ErrorCode:          "AccessDenied",
+				BytesSent:          243,
+				ObjectSize:         4096,
+				TotalTime:          26 * time.Millisecond,
+				Referer:            "https://example.com/upload",
+				UserAgent:          "Mozilla/5.0 (X11; Linux x86_64) Gecko/20100101 Firefox/68.0",
+				VersionID:          "3HL4kqtJvjVBH40Nrjfkd",
+				SignatureVersion:   "SigV4",
+				AuthenticationType: "QueryString",
+			},
+		},
+		{
+			// Older logs end at the version ID.
+			`79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be awsexamplebucket1 [06/Feb/2019:00:00:38 +0000] - - 3E57427F3EXAMPLE REST.GET.OBJECT index.html "GET /index.html HTTP/1.1" 304 - - 1024 10 9 "-" "curl/7.64.1" -`,
+			&LogEntry{
+				BucketOwner:    "79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be",
+				Bucket:         "awsexamplebucket1",
+				Time:           time.Date(2019, 2, 6, 0, 0, 38, 0, time.UTC),
+				RequestID:      "3E57427F3EXAMPLE",
+				Operation:      "REST.GET.OBJECT",
+				Key:            "index.html",
+				RequestURI:     "GET /index.html HTTP/1.1",
+				HTTPStatus:     304,
+				ObjectSize:     1024,
+				TotalTime:      10 * time.Millisecond,
+				TurnAroundTime: 9 * time.Millisecond,
+				UserAgent:      "curl/7.64.1",
+			},
+		},
+	}
+	for i, test := range tests {
+		e, err := ParseLogEntry(test.line)
+		if err != nil {
+			t.Errorf("(%d) %v", i, err)
+			continue
+		}
+		if !e.Time.Equal(test.entry.Time) {
+			t.Errorf("(%d) unexpected time %v", i, e.Time)
+		}
+		e.Time = test.entry.Time
+		if !reflect.DeepEqual(e, test.entry) {
+			t.Errorf("(%d) unexpected entry %+v", i, e)
+		}
+	}
+}
+
+func TestParseLogEntryInvalid(t *testing.T) {
+	for _, line := range []string{
+		"",
+		`owner bucket [06/Feb/2019:00:00:38 +0000 192.0.2.3`,
+		`owner bucket [06/Feb/2019:00:00:38 +0000] 192.0.2.3 - id REST.GET.OBJECT key "GET /key HTTP/1.1`,
+		`owner bucket [06/Feb/2019:00:00:38 +0000] 192.0.2.3 - id REST.GET.OBJECT key "GET /key HTTP/1.1" 200`,
+		`owner bucket [yesterday] 192.0.2.3 - id REST.GET.OBJECT key "GET /key HTTP/1.1" 200 - 1 1 1 1 "-" "curl" -`,
+		`owner bucket [06/Feb/2019:00:00:38 +0000] 192.0.2.3 - id REST.GET.OBJECT key "GET /key HTTP/1.1" OK - 1 1 1 1 "-" "curl" -`,
+	} {
+		if _, err := ParseLogEntry(line); err == nil {
+			t.Errorf("expected %q to be invalid", line)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// assembly is the pre-sized buffer of a buffered download, chunks are
+// written at their offset as they complete, in any order.
+type assembly []byte
+
+func (a assembly) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(len(a)) {
+		return 0, io.ErrShortWrite
+	}
+	n := copy(a[off:], p)
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+// offsetWriter writes to w from off onwards.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
+
+// assemble downloads the object at uri of size s into memory, with
+// concurrency requests at once. Unlike chunks read through a MultiReader, a
+// slow chunk doesn't hold back the download of the following ones. The
+// first chunk, if already downloaded, isn't requested again.
+func assemble(g *getter, uri string, s int64, first *chunk) ([]byte, error) {
+	buf := make(assembly, s)
+	var start int64
+	if first != nil {
+		start = int64(copy(buf, first.buf.Bytes()))
+	}
+
+	ctx, cancel := context.WithCancel(g.ctx)
+	defer cancel()
+	gc := *g
+	gc.ctx = ctx
+
+	ranges := make(chan [2]int64)
+	go func() {
+		defer close(ranges)
+		for i := start; i < s; i += minPartSize {
+			select {
+			case ranges <- [2]int64{i, min64(i+minPartSize, s) - 1}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		err  error
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range ranges {
+				if e := fetchAt(&gc, uri, buf, r[0], r[1]); e != nil {
+					once.Do(func() {
+						err = e
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// fetchAt downloads the bytes from start to end of the object at uri to w,
+// at their offset. If reading the response fails midway the download is
+// resumed from the last byte received.
+func fetchAt(g *getter, uri string, w io.WriterAt, start, end int64) error {
+	ow := &offsetWriter{w: w, off: start}
+	for attempt := 1; ; attempt++ {
+		err := fetchRange(g, uri, ow, end)
+		if _, ok := err.(*APIError); ok || err == nil || attempt >= retries {
+			return err
+		}
+	}
+}
+
+func fetchRange(g *getter, uri string, w *offsetWriter, end int64) error {
+	h := make(http.Header)
+	h.Set("Range", fmt.Sprintf("bytes=%d-%d", w.off, end))
+	resp, err := g.hedge("GetObject", "GET", uri, h)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 206 {
+		return newResponseError(resp)
+	}
+	if _, err := io.Copy(w, io.LimitReader(resp.Body, end-w.off+1)); err != nil {
+		return err
+	}
+	if w.off <= end {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ObjectAttributes describes an object, as returned by GetObjectAttributes.
+type ObjectAttributes struct {
+	ETag string `xml:"ETag"`
+
+	// ChecksumCRC32C and ChecksumSHA256 are the checksums of the object,
+	// the checksums of multipart objects are the checksum of the checksums
+	// of their parts.
+	ChecksumCRC32C string `xml:"Checksum>ChecksumCRC32C"`
+	ChecksumSHA256 string `xml:"Checksum>ChecksumSHA256"`
+
+	// PartCount is the number of parts of multipart objects.
+	PartCount int `xml:"ObjectParts>TotalPartsCount"`
+
+	Size int64 `xml:"ObjectSize"`
+}
+
+// GetObjectAttributes returns the attributes of the object at uri.
+func GetObjectAttributes(uri string, c *http.Client) (*ObjectAttributes, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "https"
+	u.RawQuery = "attributes"
+
+	req, err := newRequest("GetObjectAttributes", "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Amz-Object-Attributes", "ETag,Checksum,ObjectParts,ObjectSize")
+	resp, err := retry(retryNoBody(c, req), retries)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, newResponseError(resp)
+	}
+	var a ObjectAttributes
+	if err := xml.NewDecoder(resp.Body).Decode(&a); err != nil {
+		return nil, err
+	}
+	a.ETag = strings.Trim(a.ETag, `"`)
+	return &a, nil
+}
+
+// compositeChecksum returns the checksum of a multipart object, computed
+// from the base64 encoded checksums of its parts.
+func compositeChecksum(algorithm string, parts []string) (string, error) {
+	h := newHash(algorithm)
+	for _, p := range parts {
+		b, err := base64.StdEncoding.DecodeString(p)
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)) + "-" + strconv.Itoa(len(parts)), nil
+}
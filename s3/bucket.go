@@ -0,0 +1,50 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GetBucketLocation returns the region of the bucket at bucketURL.
+func GetBucketLocation(bucketURL string, c *http.Client) (string, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = "https"
+	u.RawQuery = "location"
+
+	req, err := newRequest("GetBucketLocation", "GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := retry(retryNoBody(c, req), retries)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", newResponseError(resp)
+	}
+	var l struct {
+		Location string `xml:",chardata"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return "", err
+	}
+	switch location := strings.TrimSpace(l.Location); location {
+	case "":
+		// Buckets in us-east-1 have an empty location constraint.
+		return "us-east-1", nil
+	case "EU":
+		return "eu-west-1", nil
+	default:
+		return location, nil
+	}
+}
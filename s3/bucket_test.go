@@ -0,0 +1,43 @@
+package s3
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetBucketLocation(t *testing.T) {
+	var tests = []struct {
+		Body     string
+		Location string
+	}{
+		{
+			Body:     `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/"/>`,
+			Location: "us-east-1",
+		},
+		{
+			Body:     `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">eu-west-3</LocationConstraint>`,
+			Location: "eu-west-3",
+		},
+		{
+			Body:     `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">EU</LocationConstraint>`,
+			Location: "eu-west-1",
+		},
+	}
+	for _, test := range tests {
+		f, ts := newFakeS3(t)
+		f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + test.Body))
+			return true
+		}
+		location, err := GetBucketLocation(uri(ts, "/bucket"), ts.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location != test.Location {
+			t.Errorf("expected %s, got %s", test.Location, location)
+		}
+		if u := f.recorded()[0].URL; u != "/bucket?location" {
+			t.Errorf("unexpected url %q", u)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package s3
+
+import "sync"
+
+// budget caps the bytes buffered by the downloads sharing it.
+type budget struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	max  int64
+	used int64
+	// peak is the most bytes reserved at once.
+	peak int64
+}
+
+func newBudget(max int64) *budget {
+	b := &budget{max: max}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire waits for n bytes to be available and reserves them, unless done
+// is closed first in which case it returns false. A reservation bigger than
+// the budget is granted once nothing else is reserved.
+func (b *budget) acquire(n int64, done <-chan struct{}) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var waiting chan struct{}
+	defer func() {
+		if waiting != nil {
+			close(waiting)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return false
+		default:
+		}
+		if b.used == 0 || b.used+n <= b.max {
+			break
+		}
+		if waiting == nil && done != nil {
+			// Nothing else wakes the reservation up once done.
+			waiting = make(chan struct{})
+			go func() {
+				select {
+				case <-done:
+					b.wake()
+				case <-waiting:
+				}
+			}()
+		}
+		b.cond.Wait()
+	}
+	b.used += n
+	if b.used > b.peak {
+		b.peak = b.used
+	}
+	return true
+}
+
+func (b *budget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.cond.Broadcast()
+}
+
+// wake wakes up the reservations waiting, so they notice they're done.
+func (b *budget) wake() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cond.Broadcast()
+}
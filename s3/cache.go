@@ -0,0 +1,230 @@
+package s3
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachingClient opens objects through a read-through cache of their content
+// on local disk. Cached objects are validated with a HEAD request and
+// downloaded again when their ETag changed.
+type CachingClient struct {
+	// Dir is the directory holding the cached objects, it must exist and
+	// shouldn't be shared with anything else.
+	Dir string
+
+	// MaxSize, if positive, caps the total size of the cached objects in
+	// bytes, the least recently used ones are evicted first.
+	MaxSize int64
+
+	// Client is the client used for requests, DefaultClient if nil.
+	Client *http.Client
+
+	once  sync.Once
+	err   error
+	mu    sync.Mutex
+	index map[string]*list.Element
+	lru   *list.List
+	size  int64
+}
+
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+// Open opens the object at uri, from the cache if its content is cached
+// with its current ETag. Otherwise the object is downloaded, and cached
+// once read entirely.
+func (c *CachingClient) Open(uri string) (io.ReadCloser, http.Header, error) {
+	client := c.Client
+	if client == nil {
+		client = DefaultClient
+	}
+	if err := c.load(); err != nil {
+		return nil, nil, err
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.Scheme = "https"
+
+	g := &getter{client: client, ctx: context.Background()}
+	h, _, err := head(g, u.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	if f, ok := c.get(cacheName(u, h.Get("ETag"))); ok {
+		return f, h, nil
+	}
+	c.invalidate(u)
+
+	tmp, err := ioutil.TempFile(c.Dir, ".download-")
+	if err != nil {
+		return nil, nil, err
+	}
+	r, h, err := OpenWithOptions(u.String(), &DownloadOptions{SkipHead: true, TeeTo: tmp}, client)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, nil, err
+	}
+	return &cacheFiller{ReadCloser: r, cache: c, tmp: tmp, name: cacheName(u, h.Get("ETag"))}, h, nil
+}
+
+// Invalidate removes the object at uri from the cache.
+func (c *CachingClient) Invalidate(uri string) error {
+	if err := c.load(); err != nil {
+		return err
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	c.invalidate(u)
+	return nil
+}
+
+// cacheName returns the name of the file caching the content of the object
+// at u with the given ETag, it starts with the name of the object.
+func cacheName(u *url.URL, etag string) string {
+	key := sha256.Sum256([]byte(u.Host + u.Path))
+	tag := sha256.Sum256([]byte(strings.Trim(etag, `"`)))
+	return hex.EncodeToString(key[:]) + "-" + hex.EncodeToString(tag[:8])
+}
+
+// load indexes the objects of the cache directory, ordered by their last
+// access.
+func (c *CachingClient) load() error {
+	c.once.Do(func() {
+		c.index = make(map[string]*list.Element)
+		c.lru = list.New()
+		var files []os.FileInfo
+		if files, c.err = ioutil.ReadDir(c.Dir); c.err != nil {
+			return
+		}
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].ModTime().Before(files[j].ModTime())
+		})
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+			c.index[f.Name()] = c.lru.PushFront(&cacheEntry{name: f.Name(), size: f.Size()})
+			c.size += f.Size()
+		}
+	})
+	return c.err
+}
+
+// get opens a cached object and marks it as recently used.
+func (c *CachingClient) get(name string) (*os.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.index[name]
+	if !ok {
+		return nil, false
+	}
+	path := filepath.Join(c.Dir, name)
+	f, err := os.Open(path)
+	if err != nil {
+		c.remove(e)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	// The modification time persists the order across processes.
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return f, true
+}
+
+// add adds a downloaded object to the cache, evicting the least recently
+// used objects if needed.
+func (c *CachingClient) add(tmp, name string, size int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.Rename(tmp, filepath.Join(c.Dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if e, ok := c.index[name]; ok {
+		// Downloaded concurrently.
+		c.size -= e.Value.(*cacheEntry).size
+		c.lru.Remove(e)
+	}
+	c.index[name] = c.lru.PushFront(&cacheEntry{name: name, size: size})
+	c.size += size
+	for c.MaxSize > 0 && c.size > c.MaxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+func (c *CachingClient) invalidate(u *url.URL) {
+	prefix := cacheName(u, "")
+	prefix = prefix[:strings.Index(prefix, "-")+1]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, e := range c.index {
+		if strings.HasPrefix(name, prefix) {
+			c.remove(e)
+		}
+	}
+}
+
+func (c *CachingClient) remove(e *list.Element) {
+	entry := e.Value.(*cacheEntry)
+	os.Remove(filepath.Join(c.Dir, entry.name))
+	delete(c.index, entry.name)
+	c.lru.Remove(e)
+	c.size -= entry.size
+}
+
+// cacheFiller caches a downloaded object once it has been read entirely.
+type cacheFiller struct {
+	io.ReadCloser
+	cache  *CachingClient
+	tmp    *os.File
+	name   string
+	size   int64
+	eof    bool
+	closed bool
+}
+
+func (f *cacheFiller) Read(p []byte) (int, error) {
+	n, err := f.ReadCloser.Read(p)
+	f.size += int64(n)
+	if err == io.EOF {
+		f.eof = true
+	}
+	return n, err
+}
+
+func (f *cacheFiller) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	err := f.ReadCloser.Close()
+	if cerr := f.tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || !f.eof {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	return f.cache.add(f.tmp.Name(), f.name, f.size)
+}
@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCachingClient(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/file.txt", []byte("hello"))
+	c := &CachingClient{Dir: t.TempDir(), Client: ts.Client()}
+	read := func(uri string) string {
+		r, _, err := c.Open(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	gets := func() (n int) {
+		for _, r := range f.recorded() {
+			if r.Method == http.MethodGet {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Miss.
+	if s := read(uri(ts, "/bucket/file.txt")); s != "hello" {
+		t.Errorf("unexpected content %q", s)
+	}
+	if n := gets(); n != 1 {
+		t.Errorf("expected the object to be downloaded, got %d requests", n)
+	}
+
+	// Hit.
+	if s := read(uri(ts, "/bucket/file.txt")); s != "hello" {
+		t.Errorf("unexpected content %q", s)
+	}
+	if n := gets(); n != 1 {
+		t.Errorf("expected the object to be cached, got %d requests", n)
+	}
+
+	// The ETag changes with the content.
+	f.put("/bucket/file.txt", []byte("updated"))
+	if s := read(uri(ts, "/bucket/file.txt")); s != "updated" {
+		t.Errorf("unexpected content %q", s)
+	}
+	if n := gets(); n != 2 {
+		t.Errorf("expected the object to be downloaded again, got %d requests", n)
+	}
+	if files, _ := ioutil.ReadDir(c.Dir); len(files) != 1 {
+		t.Errorf("expected the stale object to be removed, got %d files", len(files))
+	}
+
+	if err := c.Invalidate(uri(ts, "/bucket/file.txt")); err != nil {
+		t.Fatal(err)
+	}
+	read(uri(ts, "/bucket/file.txt"))
+	if n := gets(); n != 3 {
+		t.Errorf("expected the object to be invalidated, got %d requests", n)
+	}
+
+	// A new client reuses the cache.
+	c = &CachingClient{Dir: c.Dir, Client: ts.Client()}
+	read(uri(ts, "/bucket/file.txt"))
+	if n := gets(); n != 3 {
+		t.Errorf("expected the cache to be reused, got %d requests", n)
+	}
+}
+
+func TestCachingClientEviction(t *testing.T) {
+	f, ts := newFakeS3(t)
+	for _, k := range []string{"a", "b", "c"} {
+		f.put("/bucket/"+k, []byte(strings.Repeat(k, 10)))
+	}
+	c := &CachingClient{Dir: t.TempDir(), MaxSize: 25, Client: ts.Client()}
+	open := func(k string, all bool) {
+		r, _, err := c.Open(uri(ts, "/bucket/"+k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if all {
+			ioutil.ReadAll(r)
+		} else {
+			r.Read(make([]byte, 1))
+		}
+		r.Close()
+	}
+	open("a", true)
+	open("b", true)
+	open("a", true)
+	open("c", true)
+	// Partially read objects aren't cached.
+	open("b", false)
+
+	files, _ := ioutil.ReadDir(c.Dir)
+	if len(files) != 2 || c.size != 20 {
+		t.Errorf("expected 2 cached objects, got %d of %d bytes", len(files), c.size)
+	}
+	var requested []string
+	for _, r := range f.recorded() {
+		if r.Method == http.MethodGet {
+			requested = append(requested, r.URL)
+		}
+	}
+	if strings.Join(requested, ",") != "/bucket/a,/bucket/b,/bucket/c,/bucket/b" {
+		t.Errorf("expected b to be evicted, got %v", requested)
+	}
+}
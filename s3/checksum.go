@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"github.com/cyberdelia/aws"
+)
+
+// ErrCompositeChecksum is returned by ChecksumReader.Verify for the composite
+// checksums of multipart uploads, which are checksums of the checksums of
+// each part rather than of the content. Scrub validates them.
+var ErrCompositeChecksum = errors.New("s3: composite checksums can't be verified against the content")
+
+// ChecksumReader computes the checksum of the bytes read through it, which
+// allows checking the integrity of a download without a second pass over the
+// data.
+type ChecksumReader struct {
+	r   io.Reader
+	h   hash.Hash
+	eof bool
+}
+
+// NewChecksumReader returns a ChecksumReader reading from r, algorithm is
+// either aws.ChecksumCRC32C or aws.ChecksumSHA256.
+func NewChecksumReader(r io.Reader, algorithm string) (*ChecksumReader, error) {
+	h := newHash(algorithm)
+	if h == nil {
+		return nil, errors.New("s3: unsupported checksum algorithm " + algorithm)
+	}
+	return &ChecksumReader{r: r, h: h}, nil
+}
+
+func (r *ChecksumReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+// Checksum returns the checksum of the bytes read, base64 encoded like the
+// x-amz-checksum-* headers. It fails until the underlying reader reached EOF.
+func (r *ChecksumReader) Checksum() (string, error) {
+	if !r.eof {
+		return "", errors.New("s3: checksum read before EOF")
+	}
+	return base64.StdEncoding.EncodeToString(r.h.Sum(nil)), nil
+}
+
+// Verify returns a *ChecksumMismatchError if the checksum of the bytes read
+// isn't expected, e.g. the x-amz-checksum-* header of the object returned
+// by a HEAD request with the x-amz-checksum-mode: ENABLED header. Objects
+// uploaded in several parts report a composite checksum, suffixed by their
+// number of parts, for which ErrCompositeChecksum is returned.
+func (r *ChecksumReader) Verify(expected string) error {
+	if strings.Contains(expected, "-") {
+		return ErrCompositeChecksum
+	}
+	sum, err := r.Checksum()
+	if err != nil {
+		return err
+	}
+	if sum != expected {
+		return &ChecksumMismatchError{Expected: expected, Actual: sum}
+	}
+	return nil
+}
+
+// newHash returns the hash of the given checksum algorithm, nil if it isn't
+// supported.
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case aws.ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case aws.ChecksumSHA256:
+		return sha256.New()
+	default:
+		return nil
+	}
+}
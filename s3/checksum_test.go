@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/cyberdelia/aws"
+)
+
+func TestChecksumReader(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/hello.txt", []byte("hello world"))
+	var tests = []struct {
+		Algorithm string
+		Checksum  string
+	}{
+		{aws.ChecksumCRC32C, "yZRlqg=="},
+		{aws.ChecksumSHA256, "uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek="},
+	}
+	for _, test := range tests {
+		r, _, err := Open(uri(ts, "/bucket/hello.txt"), ts.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := NewChecksumReader(r, test.Algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Checksum(); err == nil {
+			t.Errorf("%s: expected checksum to be unavailable before EOF", test.Algorithm)
+		}
+		if b, _ := ioutil.ReadAll(c); string(b) != "hello world" {
+			t.Errorf("%s: unexpected content %q", test.Algorithm, b)
+		}
+		r.Close()
+		if sum, err := c.Checksum(); err != nil || sum != test.Checksum {
+			t.Errorf("%s: expected %s, got %s (%v)", test.Algorithm, test.Checksum, sum, err)
+		}
+		if err := c.Verify(test.Checksum); err != nil {
+			t.Errorf("%s: %v", test.Algorithm, err)
+		}
+		var e *ChecksumMismatchError
+		if err := c.Verify("AAAAAA=="); !errors.As(err, &e) {
+			t.Errorf("%s: expected a mismatch, got %v", test.Algorithm, err)
+		}
+		if err := c.Verify(test.Checksum + "-2"); err != ErrCompositeChecksum {
+			t.Errorf("%s: expected composite checksums to be rejected, got %v", test.Algorithm, err)
+		}
+	}
+
+	// Objects spanning several chunks.
+	payload := make([]byte, 2*minPartSize+1024)
+	rand.New(rand.NewSource(1)).Read(payload)
+	f.put("/bucket/file.bin", payload)
+	r, _, err := Open(uri(ts, "/bucket/file.bin"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	c, _ := NewChecksumReader(r, aws.ChecksumSHA256)
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, c); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(payload)
+	if err := c.Verify(base64.StdEncoding.EncodeToString(sum[:])); err != nil || !bytes.Equal(buf.Bytes(), payload) {
+		t.Errorf("unexpected checksum or content: %v", err)
+	}
+
+	if _, err := NewChecksumReader(strings.NewReader(""), "MD5"); err == nil {
+		t.Error("expected an unsupported algorithm error")
+	}
+}
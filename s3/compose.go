@@ -0,0 +1,125 @@
+package s3
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cyberdelia/aws"
+)
+
+// ComposeObjects concatenates the objects at sources into a new object at
+// dstURI. The objects are copied server side as the parts of a multipart
+// upload, so every source but the last must be at least 5MiB.
+func ComposeObjects(dstURI string, sources []string, c *http.Client) error {
+	return ComposeObjectsWithOptions(dstURI, sources, nil, c)
+}
+
+// ComposeObjectsWithOptions is like ComposeObjects but allows setting the
+// options of the multipart upload. The checksums of the copied parts are
+// computed by S3 when opts.ChecksumAlgorithm is set.
+func ComposeObjectsWithOptions(dstURI string, sources []string, opts *UploadOptions, c *http.Client) error {
+	if c == nil {
+		c = DefaultClient
+	}
+	if len(sources) == 0 {
+		return errors.New("s3: no objects to compose")
+	}
+	if len(sources) > maxParts {
+		return fmt.Errorf("s3: can't compose more than %d objects", maxParts)
+	}
+	for i, src := range sources {
+		info, err := Stat(src, c)
+		if err != nil {
+			return err
+		}
+		if info.Size > maxPartSize {
+			return fmt.Errorf("s3: %s is bigger than %d bytes", src, int64(maxPartSize))
+		}
+		if i < len(sources)-1 && info.Size < minPartSize {
+			return fmt.Errorf("s3: %s is smaller than %d bytes, only the last object can be", src, minPartSize)
+		}
+	}
+
+	up, skipped, err := initiate(dstURI, opts, c)
+	if err != nil || skipped != nil {
+		return err
+	}
+	for _, src := range sources {
+		p := &part{
+			PartNumber: len(up.Parts) + 1,
+			url:        up.url,
+			client:     up.client,
+			header:     up.header,
+			uploadID:   up.uploadID,
+			checksum:   up.checksum,
+		}
+		if err := p.copy(src); err != nil {
+			up.abort()
+			return err
+		}
+		up.Parts = append(up.Parts, p)
+	}
+	if _, err := up.complete(); err != nil {
+		up.abort()
+		return err
+	}
+	return nil
+}
+
+// copy copies the object at src as the content of the part.
+func (p *part) copy(src string) error {
+	u, err := url.Parse(src)
+	if err != nil {
+		return err
+	}
+	v := url.Values{
+		"partNumber": []string{strconv.Itoa(p.PartNumber)},
+		"uploadId":   []string{p.uploadID},
+	}
+	req, err := newRequest("UploadPartCopy", "PUT", p.url+"?"+v.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	copyHeader(req.Header, p.header)
+	req.Header.Set("X-Amz-Copy-Source", copySource(u))
+	resp, err := retry(retryNoBody(p.client, req), retries)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return newResponseError(resp)
+	}
+	// Errors can be reported in a 200 OK response.
+	var result struct {
+		XMLName        xml.Name
+		ETag           string `xml:"ETag"`
+		ChecksumCRC32C string `xml:"ChecksumCRC32C"`
+		ChecksumSHA256 string `xml:"ChecksumSHA256"`
+		Code           string `xml:"Code"`
+		Message        string `xml:"Message"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if result.XMLName.Local == "Error" {
+		return &APIError{StatusCode: resp.StatusCode, Code: result.Code, Message: result.Message, Header: resp.Header}
+	}
+	p.ETag = strings.Trim(result.ETag, `"`)
+	if p.md5, err = hex.DecodeString(p.ETag); err != nil {
+		return fmt.Errorf("s3: received invalid checksum: %q", result.ETag)
+	}
+	switch p.checksum {
+	case aws.ChecksumCRC32C:
+		p.ChecksumCRC32C = result.ChecksumCRC32C
+	case aws.ChecksumSHA256:
+		p.ChecksumSHA256 = result.ChecksumSHA256
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cyberdelia/aws"
+)
+
+func TestComposeObjects(t *testing.T) {
+	f, ts := newFakeS3(t)
+	a := bytes.Repeat([]byte("a"), minPartSize)
+	b := bytes.Repeat([]byte("b"), minPartSize+1)
+	tail := []byte("tail")
+	f.put("/bucket/a.bin", a)
+	f.put("/bucket/b.bin", b)
+	f.put("/bucket/tail.bin", tail)
+
+	sources := []string{uri(ts, "/bucket/a.bin"), uri(ts, "/bucket/b.bin"), uri(ts, "/bucket/tail.bin")}
+	if err := ComposeObjects(uri(ts, "/bucket/all.bin"), sources, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := f.get("/bucket/all.bin")
+	if !bytes.Equal(content, append(append(append([]byte(nil), a...), b...), tail...)) {
+		t.Error("unexpected content")
+	}
+
+	var sequence, copied []string
+	for _, r := range f.recorded() {
+		switch {
+		case r.Method == "HEAD":
+			continue
+		case r.Header.Get("X-Amz-Copy-Source") != "":
+			copied = append(copied, r.Header.Get("X-Amz-Copy-Source"))
+			if !strings.Contains(r.URL, "partNumber=") {
+				t.Errorf("expected a part copy, got %s", r.URL)
+			}
+		}
+		sequence = append(sequence, r.Method)
+	}
+	if expected := []string{"POST", "PUT", "PUT", "PUT", "POST"}; !reflect.DeepEqual(sequence, expected) {
+		t.Errorf("expected requests %v, got %v", expected, sequence)
+	}
+	if expected := []string{"bucket/a.bin", "bucket/b.bin", "bucket/tail.bin"}; !reflect.DeepEqual(copied, expected) {
+		t.Errorf("expected copies of %v, got %v", expected, copied)
+	}
+}
+
+func TestComposeObjectsTooSmall(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/small.bin", []byte("small"))
+	f.put("/bucket/tail.bin", []byte("tail"))
+
+	sources := []string{uri(ts, "/bucket/small.bin"), uri(ts, "/bucket/tail.bin")}
+	err := ComposeObjects(uri(ts, "/bucket/all.bin"), sources, ts.Client())
+	if err == nil || !strings.Contains(err.Error(), "smaller than") {
+		t.Errorf("expected the first object to be too small, got %v", err)
+	}
+	for _, r := range f.recorded() {
+		if r.Method != http.MethodHead {
+			t.Errorf("expected no upload to be started, got %s %s", r.Method, r.URL)
+		}
+	}
+}
+
+func TestComposeObjectsVerifyChecksum(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/a.bin", bytes.Repeat([]byte("a"), minPartSize))
+	f.put("/bucket/tail.bin", []byte("tail"))
+
+	sources := []string{uri(ts, "/bucket/a.bin"), uri(ts, "/bucket/tail.bin")}
+	opts := &UploadOptions{ChecksumAlgorithm: aws.ChecksumSHA256, VerifyChecksum: true}
+	if err := ComposeObjectsWithOptions(uri(ts, "/bucket/all.bin"), sources, opts, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if _, ok := r.URL.Query()["attributes"]; !ok {
+			return false
+		}
+		fmt.Fprint(w, "<GetObjectAttributesResponse><Checksum><ChecksumSHA256>47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=-2</ChecksumSHA256></Checksum></GetObjectAttributesResponse>")
+		return true
+	}
+	err := ComposeObjectsWithOptions(uri(ts, "/bucket/all.bin"), sources, opts, ts.Client())
+	var e *ChecksumMismatchError
+	if !errors.As(err, &e) {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+}
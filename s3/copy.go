@@ -0,0 +1,278 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cyberdelia/aws"
+)
+
+// Directives tell whether a copy preserves or replaces the source
+// properties.
+const (
+	DirectiveCopy    = "COPY"
+	DirectiveReplace = "REPLACE"
+)
+
+// CopyOptions configures a server-side copy.
+type CopyOptions struct {
+	// MetadataDirective is either DirectiveCopy or DirectiveReplace, it
+	// defaults to DirectiveCopy.
+	MetadataDirective string
+
+	// ContentType and Metadata replace the ones of the source object, they
+	// require MetadataDirective to be DirectiveReplace.
+	ContentType string
+	Metadata    map[string]string
+
+	// TaggingDirective is either DirectiveCopy or DirectiveReplace, it
+	// defaults to DirectiveCopy.
+	TaggingDirective string
+
+	// Tags replace the tags of the source object, they require
+	// TaggingDirective to be DirectiveReplace.
+	Tags map[string]string
+
+	// Header holds additional headers sent with the copy request.
+	Header http.Header
+
+	// RequesterPays acknowledges that the requester pays for the requests
+	// made to the buckets.
+	RequesterPays bool
+}
+
+// CopyResult describes the object created by a copy.
+type CopyResult struct {
+	ETag         string
+	LastModified time.Time
+}
+
+// Copy copies the object at srcURI to dstURI without downloading it.
+// Objects bigger than 5GB can't be copied this way.
+func Copy(srcURI, dstURI string, opts *CopyOptions, c *http.Client) (*CopyResult, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+
+	src, err := url.Parse(srcURI)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := url.Parse(dstURI)
+	if err != nil {
+		return nil, err
+	}
+	dst.Scheme = "https"
+
+	h := opts.Header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	h.Set("X-Amz-Copy-Source", copySource(src))
+	if opts.RequesterPays {
+		setRequestPayer(h)
+	}
+	switch opts.MetadataDirective {
+	case "", DirectiveCopy:
+		if opts.ContentType != "" || len(opts.Metadata) > 0 {
+			return nil, errors.New("s3: replacing metadata requires the REPLACE directive")
+		}
+	case DirectiveReplace:
+		h.Set("X-Amz-Metadata-Directive", DirectiveReplace)
+		if opts.ContentType != "" {
+			h.Set("Content-Type", opts.ContentType)
+		}
+		for k, v := range opts.Metadata {
+			h.Set("X-Amz-Meta-"+k, v)
+		}
+		if err := encodeMetadata(h); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("s3: invalid metadata directive " + opts.MetadataDirective)
+	}
+	switch opts.TaggingDirective {
+	case "", DirectiveCopy:
+		if len(opts.Tags) > 0 {
+			return nil, errors.New("s3: replacing tags requires the REPLACE directive")
+		}
+	case DirectiveReplace:
+		h.Set("X-Amz-Tagging-Directive", DirectiveReplace)
+		tags, err := encodeTags(opts.Tags)
+		if err != nil {
+			return nil, err
+		}
+		h.Set("X-Amz-Tagging", tags)
+	default:
+		return nil, errors.New("s3: invalid tagging directive " + opts.TaggingDirective)
+	}
+
+	req, err := newRequest("CopyObject", "PUT", dst.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	copyHeader(req.Header, h)
+	resp, err := retry(retryNoBody(c, req), retries)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, newResponseError(resp)
+	}
+	// A copy can fail after the response status was sent, in which case the
+	// body holds an error.
+	// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CopyObject.html
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		XMLName      xml.Name
+		ETag         string
+		LastModified string
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if result.XMLName.Local == "Error" {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return nil, newResponseError(resp)
+	}
+	modTime, _ := time.Parse(time.RFC3339Nano, result.LastModified)
+	return &CopyResult{
+		ETag:         strings.Trim(result.ETag, `"`),
+		LastModified: modTime,
+	}, nil
+}
+
+// UpdateMetadata replaces the content headers and the metadata of the object
+// at uri with opts.Header, such as Content-Type, Cache-Control or
+// x-amz-meta-* headers, without uploading it again. Headers which aren't
+// set are removed from the object. Only Header and RequesterPays of opts
+// are used.
+func UpdateMetadata(uri string, opts *UploadOptions, c *http.Client) error {
+	if opts == nil || len(opts.Header) == 0 {
+		// S3 refuses to copy an object onto itself without changes.
+		return errors.New("s3: updating metadata requires at least one header")
+	}
+	_, err := Copy(uri, uri, &CopyOptions{
+		MetadataDirective: DirectiveReplace,
+		Header:            opts.Header,
+		RequesterPays:     opts.RequesterPays,
+	}, c)
+	return err
+}
+
+// contentHeaders are the headers of an object preserved by CopyThrough,
+// along its x-amz-meta-* headers.
+var contentHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Type",
+	"Expires",
+}
+
+// CopyThrough copies the object at srcURI to dstURI by streaming its content
+// from srcClient into a multipart upload sent with dstClient, for copies S3
+// can't do server side, e.g. across accounts or partitions. Nothing is
+// written to disk. The content headers and the metadata of the object are
+// preserved.
+func CopyThrough(srcURI, dstURI string, srcClient, dstClient *http.Client) error {
+	r, header, err := Open(srcURI, srcClient)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	h := make(http.Header)
+	for k, v := range header {
+		if strings.HasPrefix(k, metadataPrefix) {
+			h[k] = v
+		}
+	}
+	for _, k := range contentHeaders {
+		if v := header.Get(k); v != "" {
+			h.Set(k, v)
+		}
+	}
+	w, err := Create(dstURI, h, dstClient)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	_, err = w.Complete()
+	return err
+}
+
+// CopyWithFallback copies the object at srcURI to dstURI server side with
+// dstClient, unless S3 refuses to, in which case the object is copied with
+// CopyThrough. S3 refuses copies of objects the credentials of dstClient
+// can't read, in other partitions, or bigger than 5GB.
+func CopyWithFallback(srcURI, dstURI string, srcClient, dstClient *http.Client) error {
+	_, err := Copy(srcURI, dstURI, nil, dstClient)
+	var e *APIError
+	if !errors.As(err, &e) {
+		return err
+	}
+	switch {
+	case e.StatusCode == http.StatusForbidden, e.StatusCode == http.StatusMovedPermanently,
+		e.Code == "InvalidRequest", e.Code == "AuthorizationHeaderMalformed":
+		return CopyThrough(srcURI, dstURI, srcClient, dstClient)
+	default:
+		return err
+	}
+}
+
+// copySource returns the x-amz-copy-source value of the given object.
+func copySource(u *url.URL) string {
+	bucket, key := splitBucket(u)
+	return aws.EscapePath(bucket + "/" + key)
+}
+
+// splitBucket returns the bucket and the key of the object at u, whether it
+// uses virtual-hosted or path-style addressing.
+func splitBucket(u *url.URL) (bucket, key string) {
+	path := strings.TrimPrefix(u.Path, "/")
+	if bucket := aws.HostBucket(u.Host); bucket != "" {
+		return bucket, path
+	}
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// bucketPrefix returns the URL of the bucket of the prefix, or object, at u
+// and the prefix. Objects of the bucket are at its path followed by a slash
+// and their key.
+func bucketPrefix(u *url.URL) (*url.URL, string, error) {
+	bucket, key := splitBucket(u)
+	if bucket == "" {
+		return nil, "", errors.New("s3: URI without bucket")
+	}
+	b := *u
+	b.Scheme = "https"
+	b.RawPath = ""
+	b.RawQuery = ""
+	if aws.HostBucket(u.Host) != "" {
+		b.Path = ""
+	} else {
+		b.Path = "/" + bucket
+	}
+	return &b, key, nil
+}
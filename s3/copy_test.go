@@ -0,0 +1,269 @@
+package s3
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCopyPreservesMetadata(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/src.txt", []byte("hello"))
+	f.meta["/bucket/src.txt"] = http.Header{
+		"Content-Type":     {"text/plain"},
+		"X-Amz-Meta-Owner": {"alice"},
+	}
+
+	result, err := Copy(uri(ts, "/bucket/src.txt"), uri(ts, "/bucket/dst.txt"), nil, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ETag != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("unexpected etag %q", result.ETag)
+	}
+	if result.LastModified.IsZero() {
+		t.Error("expected a modification time")
+	}
+	r := f.recorded()[0]
+	if s := r.Header.Get("X-Amz-Copy-Source"); s != "bucket/src.txt" {
+		t.Errorf("unexpected copy source %q", s)
+	}
+	if d := r.Header.Get("X-Amz-Metadata-Directive"); d != "" {
+		t.Errorf("unexpected metadata directive %q", d)
+	}
+	info, err := Stat(uri(ts, "/bucket/dst.txt"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ContentType != "text/plain" || info.Header.Get("X-Amz-Meta-Owner") != "alice" {
+		t.Errorf("expected metadata to be preserved, got %v", info.Header)
+	}
+}
+
+func TestCopyReplacesMetadata(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/src.txt", []byte("hello"))
+	f.meta["/bucket/src.txt"] = http.Header{
+		"Content-Type":     {"text/plain"},
+		"X-Amz-Meta-Owner": {"alice"},
+	}
+
+	_, err := Copy(uri(ts, "/bucket/src.txt"), uri(ts, "/bucket/dst.txt"), &CopyOptions{
+		MetadataDirective: DirectiveReplace,
+		ContentType:       "text/markdown",
+		Metadata:          map[string]string{"Reviewer": "bob"},
+	}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := f.recorded()[0]
+	if d := r.Header.Get("X-Amz-Metadata-Directive"); d != "REPLACE" {
+		t.Errorf("unexpected metadata directive %q", d)
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "text/markdown" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	info, err := Stat(uri(ts, "/bucket/dst.txt"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ContentType != "text/markdown" {
+		t.Errorf("unexpected content type %q", info.ContentType)
+	}
+	if info.Header.Get("X-Amz-Meta-Reviewer") != "bob" || info.Header.Get("X-Amz-Meta-Owner") != "" {
+		t.Errorf("expected metadata to be replaced, got %v", info.Header)
+	}
+}
+
+func TestCopyTaggingDirective(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/src.txt", []byte("hello"))
+
+	if _, err := Copy(uri(ts, "/bucket/src.txt"), uri(ts, "/bucket/dst.txt"), nil, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Copy(uri(ts, "/bucket/src.txt"), uri(ts, "/bucket/dst.txt"), &CopyOptions{
+		TaggingDirective: DirectiveReplace,
+		Tags:             map[string]string{"project": "blue sky", "env": "prod"},
+	}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := f.recorded()
+	if d := requests[0].Header.Get("X-Amz-Tagging-Directive"); d != "" {
+		t.Errorf("unexpected tagging directive %q", d)
+	}
+	if _, ok := requests[0].Header["X-Amz-Tagging"]; ok {
+		t.Error("unexpected tagging header")
+	}
+	if d := requests[1].Header.Get("X-Amz-Tagging-Directive"); d != "REPLACE" {
+		t.Errorf("unexpected tagging directive %q", d)
+	}
+	if tags := requests[1].Header.Get("X-Amz-Tagging"); tags != "env=prod&project=blue+sky" {
+		t.Errorf("unexpected tags %q", tags)
+	}
+}
+
+func TestCopyInvalidOptions(t *testing.T) {
+	_, ts := newFakeS3(t)
+	for i, opts := range []*CopyOptions{
+		{ContentType: "text/plain"},
+		{MetadataDirective: DirectiveCopy, Metadata: map[string]string{"a": "b"}},
+		{MetadataDirective: "MERGE"},
+		{Tags: map[string]string{"a": "b"}},
+		{TaggingDirective: "MERGE"},
+	} {
+		if _, err := Copy(uri(ts, "/bucket/src.txt"), uri(ts, "/bucket/dst.txt"), opts, ts.Client()); err == nil {
+			t.Errorf("(%d) expected an error", i)
+		}
+	}
+}
+
+func TestCopyError(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		w.Write([]byte("<Error><Code>InternalError</Code><Message>oops</Message></Error>"))
+		return true
+	}
+	_, err := Copy(uri(ts, "/bucket/src.txt"), uri(ts, "/bucket/dst.txt"), nil, ts.Client())
+	if err == nil || err.(*APIError).Code != "InternalError" {
+		t.Errorf("expected an internal error, got %v", err)
+	}
+}
+
+func TestCopySource(t *testing.T) {
+	var tests = []struct {
+		URI    string
+		Source string
+	}{
+		{"s3://s3.amazonaws.com/bucket/key", "bucket/key"},
+		{"s3://bucket.s3.amazonaws.com/dir/key", "bucket/dir/key"},
+		{"s3://bucket.s3-eu-west-1.amazonaws.com/key", "bucket/key"},
+		{"s3://s3.amazonaws.com/bucket/with space+plus", "bucket/with%20space%2Bplus"},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.URI)
+		if s := copySource(u); s != test.Source {
+			t.Errorf("expected %q for %s, got %q", test.Source, test.URI, s)
+		}
+	}
+}
+
+func TestCopyThrough(t *testing.T) {
+	src, srcServer := newFakeS3(t)
+	dst, dstServer := newFakeS3(t)
+	payload := make([]byte, minPartSize+1024)
+	rand.New(rand.NewSource(1)).Read(payload)
+	src.put("/bucket/file.bin", payload)
+	src.meta["/bucket/file.bin"] = http.Header{
+		"Content-Type":     {"application/octet-stream"},
+		"Cache-Control":    {"no-cache"},
+		"X-Amz-Meta-Owner": {"alice"},
+	}
+
+	err := CopyThrough(uri(srcServer, "/bucket/file.bin"), uri(dstServer, "/other/file.bin"), srcServer.Client(), dstServer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := dst.get("/other/file.bin"); !bytes.Equal(b, payload) {
+		t.Error("unexpected content")
+	}
+	h := dst.meta["/other/file.bin"]
+	if h.Get("Content-Type") != "application/octet-stream" || h.Get("X-Amz-Meta-Owner") != "alice" {
+		t.Errorf("expected metadata to be preserved, got %v", h)
+	}
+	for _, r := range dst.recorded() {
+		if r.Method == "POST" && strings.HasSuffix(r.URL, "?uploads") && r.Header.Get("Cache-Control") != "no-cache" {
+			t.Errorf("expected content headers to be preserved, got %v", r.Header)
+		}
+	}
+}
+
+func TestCopyWithFallback(t *testing.T) {
+	src, srcServer := newFakeS3(t)
+	dst, dstServer := newFakeS3(t)
+	src.put("/bucket/file.txt", []byte("hello"))
+
+	// The destination credentials can't read the source.
+	dst.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			writeError(w, 403, "AccessDenied")
+			return true
+		}
+		return false
+	}
+	err := CopyWithFallback(uri(srcServer, "/bucket/file.txt"), uri(dstServer, "/other/file.txt"), srcServer.Client(), dstServer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := dst.get("/other/file.txt"); string(b) != "hello" {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	// Server side copies are preferred.
+	n := len(src.recorded())
+	err = CopyWithFallback(uri(srcServer, "/bucket/file.txt"), uri(srcServer, "/bucket/copy.txt"), srcServer.Client(), srcServer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range src.recorded()[n:] {
+		if r.Method == "GET" {
+			t.Errorf("expected a server side copy, got %s %s", r.Method, r.URL)
+		}
+	}
+
+	// Other errors aren't retried.
+	dst.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		writeError(w, 404, "NoSuchBucket")
+		return true
+	}
+	err = CopyWithFallback(uri(srcServer, "/bucket/file.txt"), uri(dstServer, "/missing/file.txt"), srcServer.Client(), dstServer.Client())
+	if !IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/index.html", []byte("<html>"))
+	f.meta["/bucket/index.html"] = http.Header{
+		"Content-Type":     {"application/octet-stream"},
+		"X-Amz-Meta-Owner": {"alice"},
+	}
+
+	err := UpdateMetadata(uri(ts, "/bucket/index.html"), &UploadOptions{Header: http.Header{
+		"Content-Type":     {"text/html"},
+		"Cache-Control":    {"max-age=60"},
+		"X-Amz-Meta-Owner": {"bob"},
+	}}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := f.recorded()[0]
+	if r.Method != "PUT" || r.URL != "/bucket/index.html" {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	}
+	for k, v := range map[string]string{
+		"X-Amz-Copy-Source":        "bucket/index.html",
+		"X-Amz-Metadata-Directive": "REPLACE",
+		"Content-Type":             "text/html",
+		"Cache-Control":            "max-age=60",
+		"X-Amz-Meta-Owner":         "bob",
+	} {
+		if s := r.Header.Get(k); s != v {
+			t.Errorf("expected %s to be %q, got %q", k, v, s)
+		}
+	}
+	if b, _ := f.get("/bucket/index.html"); string(b) != "<html>" {
+		t.Errorf("expected the content to be kept, got %q", b)
+	}
+
+	for _, opts := range []*UploadOptions{nil, {}} {
+		if err := UpdateMetadata(uri(ts, "/bucket/index.html"), opts, ts.Client()); err == nil {
+			t.Error("expected an error without headers")
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package s3
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cyberdelia/aws"
+)
+
+// DirOptions configures UploadDir and DownloadDir.
+type DirOptions struct {
+	// Concurrency is the number of files transferred at once, it defaults
+	// to the number of CPUs.
+	Concurrency int
+
+	// MaxConnsPerOp, if positive, caps the number of requests in flight for
+	// the whole operation, whatever the number of files transferred at
+	// once, so it doesn't monopolize the connections of the client.
+	MaxConnsPerOp int
+
+	// ChunkThreshold is the size from which DownloadDir downloads objects
+	// in parallel chunks, smaller objects are downloaded with a single GET
+	// since the HEAD and chunk requests would only add overhead. It
+	// defaults to 5MB, a negative value chunks every object.
+	ChunkThreshold int64
+
+	// Ramp starts the operation with a single request in flight, doubling
+	// the number of requests allowed as they succeed and halving it when
+	// S3 throttles them, up to MaxConnsPerOp if set. S3 scales its request
+	// rate per prefix gradually, a burst of requests to a new prefix gets
+	// SlowDown errors otherwise.
+	Ramp bool
+
+	// MaxMemory, if positive, caps the bytes of the chunks buffered by
+	// DownloadDir across all the files downloaded at once. Chunks hold
+	// their bytes from when they're requested until they're written to
+	// their file, a chunk bigger than MaxMemory is downloaded alone.
+	MaxMemory int64
+}
+
+// chunkThreshold returns the size from which objects are downloaded in
+// chunks.
+func (opts *DirOptions) chunkThreshold() int64 {
+	switch {
+	case opts == nil || opts.ChunkThreshold == 0:
+		return minPartSize
+	case opts.ChunkThreshold < 0:
+		return 0
+	default:
+		return opts.ChunkThreshold
+	}
+}
+
+// limit returns a copy of c sending at most opts.MaxConnsPerOp requests at
+// once, ramping up to it with opts.Ramp.
+func (opts *DirOptions) limit(c *http.Client) *http.Client {
+	switch {
+	case opts == nil:
+		return limitClient(c, nil)
+	case opts.Ramp:
+		return rampClient(c, aws.NewRamp(1, opts.MaxConnsPerOp))
+	case opts.MaxConnsPerOp > 0:
+		return limitClient(c, aws.NewLimiter(opts.MaxConnsPerOp))
+	default:
+		return limitClient(c, nil)
+	}
+}
+
+// UploadDir uploads the files under dir to the prefix at prefixURI, keyed by
+// their path relative to dir. Every file is attempted, the ones which
+// couldn't be uploaded are reported in a *BatchError.
+func UploadDir(dir, prefixURI string, opts *DirOptions, c *http.Client) error {
+	u, err := url.Parse(prefixURI)
+	if err != nil {
+		return err
+	}
+	c = opts.limit(c)
+	u, prefix, err := bucketPrefix(u)
+	if err != nil {
+		return err
+	}
+	// Files are keyed under the prefix as a directory.
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	var files []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b := newBatch(opts)
+	for _, path := range files {
+		path := path
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		key := prefix + filepath.ToSlash(name)
+		dst := *u
+		dst.Path = u.Path + "/" + key
+		b.do(key, func() error {
+			_, err := (&Uploader{Client: c}).UploadFile(path, dst.String())
+			return err
+		})
+	}
+	return b.wait()
+}
+
+// DownloadDir downloads the objects under the prefix at prefixURI to dir,
+// at their key relative to the prefix. Every object is attempted, the ones
+// which couldn't be downloaded are reported in a *BatchError.
+func DownloadDir(prefixURI, dir string, opts *DirOptions, c *http.Client) error {
+	c = opts.limit(c)
+	u, err := url.Parse(prefixURI)
+	if err != nil {
+		return err
+	}
+	u, prefix, err := bucketPrefix(u)
+	if err != nil {
+		return err
+	}
+	w := &walker{
+		u:    u,
+		opts: &WalkOptions{SkipOwner: true},
+		c:    c,
+		flat: true,
+	}
+	objects, err := w.readObjects(prefix)
+	if err != nil {
+		return err
+	}
+	threshold := opts.chunkThreshold()
+	d := &Downloader{Client: c}
+	if opts != nil && opts.MaxMemory > 0 {
+		d.Options = &DownloadOptions{budget: newBudget(opts.MaxMemory)}
+	}
+	b := newBatch(opts)
+	for _, o := range objects {
+		if o.IsDir() {
+			continue
+		}
+		key := o.Name()
+		name := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(key, prefix)))
+		if !strings.HasPrefix(name, filepath.Clean(dir)+string(filepath.Separator)) {
+			b.fail(key, fmt.Errorf("s3: %s is outside of %s", name, dir))
+			continue
+		}
+		src := *u
+		src.Path = u.Path + "/" + key
+		src.RawQuery = ""
+		if o.Size() >= threshold {
+			b.do(key, func() error {
+				return d.DownloadFile(src.String(), name)
+			})
+			continue
+		}
+		b.do(key, func() error {
+			return writeFile(name, func() (io.ReadCloser, error) {
+				return getObject(src.String(), c)
+			})
+		})
+	}
+	return b.wait()
+}
+
+// getObject opens the object at uri with a single GET.
+func getObject(uri string, c *http.Client) (io.ReadCloser, error) {
+	req, err := newRequest("GetObject", "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := retry(retryNoBody(c, req), retries)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, newResponseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// batch runs the items of a batch operation concurrently and collects their
+// failures.
+type batch struct {
+	sem chan struct{}
+	wg  sync.WaitGroup
+	mu  sync.Mutex
+	err BatchError
+}
+
+func newBatch(opts *DirOptions) *batch {
+	n := concurrency
+	if opts != nil && opts.Concurrency > 0 {
+		n = opts.Concurrency
+	}
+	return &batch{sem: make(chan struct{}, n)}
+}
+
+func (b *batch) do(key string, fn func() error) {
+	b.wg.Add(1)
+	b.sem <- struct{}{}
+	go func() {
+		defer func() {
+			<-b.sem
+			b.wg.Done()
+		}()
+		if err := fn(); err != nil {
+			b.fail(key, err)
+		}
+	}()
+}
+
+func (b *batch) fail(key string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err.Errors = append(b.err.Errors, &BatchItemError{Key: key, Err: err})
+}
+
+// wait waits for the items to complete and returns a *BatchError if any of
+// them failed.
+func (b *batch) wait() error {
+	b.wg.Wait()
+	if len(b.err.Errors) == 0 {
+		return nil
+	}
+	b.err.sort()
+	return &b.err
+}
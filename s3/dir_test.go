@@ -0,0 +1,271 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func failedKeys(t *testing.T, err error) []string {
+	t.Helper()
+	var e *BatchError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected a batch error, got %v", err)
+	}
+	var keys []string
+	for _, item := range e.Errors {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
+func TestUploadDir(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" && r.URL.Path == "/bucket/backup/sub/b.txt" {
+			writeError(w, 403, "AccessDenied")
+			return true
+		}
+		return false
+	}
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/c.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := UploadDir(dir, uri(ts, "/bucket/backup/"), &DirOptions{Concurrency: 2}, ts.Client())
+	if keys := failedKeys(t, err); !reflect.DeepEqual(keys, []string{"backup/sub/b.txt"}) {
+		t.Errorf("unexpected failures %v", keys)
+	}
+	if !IsAccessDenied(err) {
+		t.Errorf("expected the cause to be kept, got %v", err)
+	}
+	for _, name := range []string{"a.txt", "sub/c.txt"} {
+		if b, ok := f.get("/bucket/backup/" + name); !ok || string(b) != name {
+			t.Errorf("expected %s to be uploaded, got %q", name, b)
+		}
+	}
+
+	// The prefix is a directory with or without its trailing slash, and
+	// with virtual-hosted URIs.
+	f.handler = nil
+	prefix, _, _, err := ParseS3URI("s3://bucket/copy", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UploadDir(dir, prefix, nil, virtualHosted(ts)); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/c.txt"} {
+		if b, ok := f.get("/bucket/copy/" + name); !ok || string(b) != name {
+			t.Errorf("expected %s to be uploaded, got %q", name, b)
+		}
+	}
+}
+
+func TestDownloadDir(t *testing.T) {
+	f, ts := newFakeS3(t)
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/c.txt", "sub/d.txt"} {
+		f.put("/bucket/data/"+name, []byte(name))
+	}
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/bucket/data/sub/b.txt" || r.URL.Path == "/bucket/data/sub/d.txt" {
+			writeError(w, 403, "AccessDenied")
+			return true
+		}
+		return false
+	}
+	dir := t.TempDir()
+
+	err := DownloadDir(uri(ts, "/bucket/data/"), dir, nil, ts.Client())
+	if keys := failedKeys(t, err); !reflect.DeepEqual(keys, []string{"data/sub/b.txt", "data/sub/d.txt"}) {
+		t.Errorf("unexpected failures %v", keys)
+	}
+	for _, name := range []string{"a.txt", "sub/c.txt"} {
+		if b, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(b) != name {
+			t.Errorf("expected %s to be downloaded, got %q (%v)", name, b, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub/b.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected failed downloads not to be kept, got %v", err)
+	}
+}
+
+func TestDownloadDirMaxConnsPerOp(t *testing.T) {
+	const limit = 2
+	f, ts := newFakeS3(t)
+	for i := 0; i < 20; i++ {
+		f.put(fmt.Sprintf("/bucket/data/%d.txt", i), []byte("data"))
+	}
+	var inflight, max int32
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+		return false
+	}
+
+	opts := &DirOptions{Concurrency: 8, MaxConnsPerOp: limit}
+	if err := DownloadDir(uri(ts, "/bucket/data/"), t.TempDir(), opts, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if max > limit {
+		t.Errorf("expected at most %d requests in flight, got %d", limit, max)
+	}
+	if max == 0 {
+		t.Error("expected requests to be sent")
+	}
+}
+
+func TestDownloadDirChunkThreshold(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/data/small.txt", []byte("small"))
+	f.put("/bucket/data/large.bin", make([]byte, minPartSize+1))
+	dir := t.TempDir()
+
+	if err := DownloadDir(uri(ts, "/bucket/data/"), dir, nil, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	requests := make(map[string][]string)
+	for _, r := range f.recorded()[1:] {
+		requests[r.URL] = append(requests[r.URL], r.Method+" "+r.Header.Get("Range"))
+	}
+	if r := requests["/bucket/data/small.txt"]; !reflect.DeepEqual(r, []string{"GET "}) {
+		t.Errorf("expected a single GET for small objects, got %v", r)
+	}
+	if r := requests["/bucket/data/large.bin"]; len(r) != 3 || r[0] != "HEAD " {
+		t.Errorf("expected large objects to be chunked, got %v", r)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "small.txt")); string(b) != "small" {
+		t.Errorf("unexpected content %q", b)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "large.bin")); err != nil || info.Size() != minPartSize+1 {
+		t.Errorf("unexpected file %v (%v)", info, err)
+	}
+}
+
+func BenchmarkDownloadDirSmallObjects(b *testing.B) {
+	f, ts := newFakeS3(b)
+	for i := 0; i < 1000; i++ {
+		f.put(fmt.Sprintf("/bucket/data/%d.txt", i), []byte("small object"))
+	}
+	for _, bench := range []struct {
+		Name      string
+		Threshold int64
+	}{
+		{"Chunked", -1},
+		{"SingleGet", 0},
+	} {
+		b.Run(bench.Name, func(b *testing.B) {
+			opts := &DirOptions{ChunkThreshold: bench.Threshold}
+			start := len(f.recorded())
+			for i := 0; i < b.N; i++ {
+				if err := DownloadDir(uri(ts, "/bucket/data/"), b.TempDir(), opts, ts.Client()); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(f.recorded())-start)/float64(b.N), "requests/op")
+		})
+	}
+}
+
+func TestDownloadDirMaxMemory(t *testing.T) {
+	const size = 2*minPartSize + 1024
+	f, ts := newFakeS3(t)
+	payload := bytes.Repeat([]byte("a"), size)
+	for i := 0; i < 4; i++ {
+		f.put(fmt.Sprintf("/bucket/data/%d.bin", i), payload)
+	}
+
+	// Downloads sharing a budget never buffer more than it.
+	b := newBudget(2 * minPartSize)
+	d := &Downloader{Client: ts.Client(), Options: &DownloadOptions{budget: b}}
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := filepath.Join(dir, fmt.Sprintf("%d.bin", i))
+			if err := d.DownloadFile(uri(ts, fmt.Sprintf("/bucket/data/%d.bin", i)), name); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if b.peak > 2*minPartSize {
+		t.Errorf("expected at most %d bytes to be buffered, got %d", 2*minPartSize, b.peak)
+	}
+	if b.peak == 0 || b.used != 0 {
+		t.Errorf("expected every reservation to be released, got %d bytes reserved", b.used)
+	}
+
+	dir = t.TempDir()
+	opts := &DirOptions{Concurrency: 4, MaxMemory: minPartSize}
+	if err := DownloadDir(uri(ts, "/bucket/data/"), dir, opts, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if b, _ := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.bin", i))); !bytes.Equal(b, payload) {
+			t.Errorf("(%d) unexpected content", i)
+		}
+	}
+}
+
+func TestDownloadDirRamp(t *testing.T) {
+	f, ts := newFakeS3(t)
+	for i := 0; i < 20; i++ {
+		f.put(fmt.Sprintf("/bucket/data/%d.txt", i), []byte("data"))
+	}
+	var (
+		mu            sync.Mutex
+		inflight, max int
+		started       []int
+	)
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		inflight++
+		if inflight > max {
+			max = inflight
+		}
+		started = append(started, inflight)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+		return false
+	}
+
+	opts := &DirOptions{Concurrency: 8, Ramp: true}
+	if err := DownloadDir(uri(ts, "/bucket/data/"), t.TempDir(), opts, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	// The listing and the first download are sent alone.
+	for i, n := range started[:2] {
+		if n != 1 {
+			t.Errorf("(%d) expected a single request in flight, got %d", i, n)
+		}
+	}
+	if max < 2 || max > 8 {
+		t.Errorf("expected the concurrency to ramp up, got %d requests in flight at most", max)
+	}
+}
@@ -2,27 +2,163 @@ package s3
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/cyberdelia/aws"
 )
 
+// getter sends the requests of a download.
+type getter struct {
+	client *http.Client
+	ctx    context.Context
+	policy *aws.RetryPolicy
+	// hedgeDelay, if positive, is the delay after which chunk requests
+	// are hedged.
+	hedgeDelay time.Duration
+	// requesterPays acknowledges that the requester pays for the requests.
+	requesterPays bool
+}
+
+func (g *getter) do(op, method, url string, h http.Header) (*http.Response, error) {
+	return g.doContext(g.ctx, op, method, url, h)
+}
+
+func (g *getter) doContext(ctx context.Context, op, method, url string, h http.Header) (*http.Response, error) {
+	req, err := newRequestContext(ctx, op, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	copyHeader(req.Header, h)
+	if g.requesterPays {
+		setRequestPayer(req.Header)
+	}
+	if g.policy != nil {
+		return retryPolicy(g.policy, g.client, req)
+	}
+	return retry(retryNoBody(g.client, req), retries)
+}
+
+// hedge sends the request and, if it hasn't returned after the hedge delay,
+// sends it a second time. The first response received is returned, the
+// other request is cancelled.
+func (g *getter) hedge(op, method, url string, h http.Header) (*http.Response, error) {
+	if g.hedgeDelay <= 0 {
+		return g.do(op, method, url, h)
+	}
+	type result struct {
+		i    int
+		resp *http.Response
+		err  error
+	}
+	var (
+		cancels []context.CancelFunc
+		results = make(chan result, 2)
+	)
+	send := func() {
+		ctx, cancel := context.WithCancel(g.ctx)
+		i := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := g.doContext(ctx, op, method, url, h)
+			results <- result{i, resp, err}
+		}()
+	}
+	send()
+	timer := time.NewTimer(g.hedgeDelay)
+	defer timer.Stop()
+	hedged := timer.C
+	var err error
+	for pending := 1; pending > 0; {
+		select {
+		case <-hedged:
+			hedged = nil
+			pending++
+			send()
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				cancels[r.i]()
+				err = r.err
+				continue
+			}
+			for i, cancel := range cancels {
+				if i != r.i {
+					cancel()
+				}
+			}
+			go func(pending int) {
+				for ; pending > 0; pending-- {
+					if l := <-results; l.resp != nil {
+						l.resp.Body.Close()
+					}
+				}
+			}(pending)
+			r.resp.Body = &cancelBody{r.resp.Body, cancels[r.i]}
+			return r.resp, nil
+		}
+	}
+	return nil, err
+}
+
+// cancelBody cancels the context of its request once closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
 type chunk struct {
-	client    *http.Client
+	getter    *getter
 	buf       *bytes.Buffer
 	done      chan bool
 	readAhead chan bool
+	// stream makes received bytes readable before the chunk is entirely
+	// downloaded.
+	stream bool
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	received int64
+	finished bool
 
 	header http.Header
 	url    string
+	start  int64
+	end    int64
 	err    error
+	// etag is the ETag of the first response, resumed requests only
+	// succeed if the object still matches it.
+	etag string
+
+	// budget, if set, holds the reserved bytes of the chunk until it's
+	// read.
+	budget   *budget
+	reserved int64
+	released sync.Once
 }
 
 func (c *chunk) Read(p []byte) (int, error) {
-	<-c.done
+	if !c.stream {
+		<-c.done
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.buf.Len() == 0 && !c.finished {
+		c.cond.Wait()
+	}
 	if c.err != nil {
 		return 0, c.err
 	}
@@ -31,25 +167,68 @@ func (c *chunk) Read(p []byte) (int, error) {
 		if err == io.EOF {
 			c.readAhead <- true
 			c.buf = nil
+			c.release()
 		}
 		return n, err
 	}
 	return n, nil
 }
 
-func (c *chunk) Download() error {
+// release returns the reserved bytes of the chunk to its budget.
+func (c *chunk) release() {
+	c.released.Do(func() {
+		if c.budget != nil {
+			c.budget.release(c.reserved)
+		}
+	})
+}
+
+// Write appends received bytes to the chunk.
+func (c *chunk) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, err := c.buf.Write(p)
+	c.received += int64(n)
+	c.cond.Broadcast()
+	return n, err
+}
+
+func (c *chunk) size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.received
+}
+
+// Download downloads the chunk, if reading the response fails midway the
+// download is resumed from the last byte received, provided the object didn't
+// change.
+func (c *chunk) Download() (err error) {
 	defer close(c.done)
+	defer func() {
+		c.mu.Lock()
+		c.err = err
+		c.finished = true
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	}()
 
-	req, err := http.NewRequest("GET", c.url, nil)
-	if err != nil {
-		return err
-	}
-	for k := range c.header {
-		for _, v := range c.header[k] {
-			req.Header.Add(k, v)
+	for attempt := 1; ; attempt++ {
+		err = c.fetch()
+		if _, ok := err.(*APIError); ok || err == nil || attempt >= retries {
+			return err
 		}
 	}
-	resp, err := retry(retryNoBody(c.client, req), retries)
+}
+
+// fetch requests the remaining bytes of the chunk.
+func (c *chunk) fetch() error {
+	h := c.header.Clone()
+	offset := c.start + c.size()
+	h.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, c.end))
+	if c.etag != "" {
+		h.Set("If-Match", c.etag)
+	}
+	resp, err := c.getter.hedge("GetObject", "GET", c.url, h)
 	if err != nil {
 		return err
 	}
@@ -57,72 +236,276 @@ func (c *chunk) Download() error {
 	if resp.StatusCode != 206 {
 		return newResponseError(resp)
 	}
-	if _, err := c.buf.ReadFrom(resp.Body); err != nil {
+	if c.etag == "" {
+		c.etag = resp.Header.Get("ETag")
+	}
+	if _, err := io.Copy(c, resp.Body); err != nil {
 		return err
 	}
+	if c.size() < c.end-c.start+1 {
+		return io.ErrUnexpectedEOF
+	}
 	return nil
 }
 
 type downloader struct {
 	r         io.Reader
+	tee       io.Writer
 	chunks    chan *chunk
 	readAhead chan bool
 	once      sync.Once
+	cancel    context.CancelFunc
+	// adaptive measures the throughput of chunk downloads.
+	adaptive bool
+	// buf holds the object of buffered downloads, they don't download
+	// chunks when read.
+	buf      []byte
+	buffered bool
+
+	// budget, if set, caps the bytes of the chunks buffered, chunks are
+	// dispatched once their bytes are reserved.
+	budget   *budget
+	closed   chan struct{}
+	closing  sync.Once
+	budgeted []*chunk
+	// bufReserved is the bytes reserved by a buffered download.
+	bufReserved int64
 
+	mu  sync.Mutex
 	err error
+	// rate is the measured throughput in bytes per second.
+	rate float64
+}
+
+// Sizes of the chunks of adaptive downloads, chunks are sized to be
+// downloaded in about adaptiveChunkDuration.
+const (
+	minAdaptiveChunkSize  = 1024 * 1024
+	maxAdaptiveChunkSize  = 64 * 1024 * 1024
+	adaptiveChunkDuration = time.Second
+)
+
+// reserve reserves the bytes of c from the budget of the download, if any.
+// It returns false once the download is closed.
+func (d *downloader) reserve(c *chunk) bool {
+	if d.budget == nil {
+		return true
+	}
+	n := c.end - c.start + 1
+	if !d.budget.acquire(n, d.closed) {
+		return false
+	}
+	c.budget, c.reserved = d.budget, n
+	d.mu.Lock()
+	d.budgeted = append(d.budgeted, c)
+	d.mu.Unlock()
+	return true
+}
+
+func (d *downloader) error() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// DownloadOptions configures a download.
+type DownloadOptions struct {
+	// SkipHead discovers the size of the object from the Content-Range of
+	// the first chunk request instead of a separate HEAD request, saving a
+	// round trip. The first request is still limited to the first chunk so
+	// big objects aren't streamed at once. It falls back to a HEAD request
+	// if the server doesn't return a Content-Range.
+	SkipHead bool
+
+	// RetryPolicy, if set, retries failed requests with backoff, instead of
+	// retrying internal errors only.
+	RetryPolicy *aws.RetryPolicy
+
+	// Timeout bounds the whole download, retries included. Once elapsed,
+	// requests are aborted and reading fails with an error matching
+	// context.DeadlineExceeded.
+	Timeout time.Duration
+
+	// Stream makes bytes readable as soon as they're received, instead of
+	// once their chunk is entirely downloaded. Chunks are still read in
+	// order.
+	Stream bool
+
+	// MaxObjectSize, if positive, makes Open fail with an
+	// ObjectTooLargeError for objects bigger than it, before their content
+	// is fetched. With SkipHead, only the first chunk is fetched.
+	MaxObjectSize int64
+
+	// ExtraQuery holds query parameters added to the HEAD and GET requests
+	// of the download, such as response-content-type to override the
+	// headers of the response.
+	ExtraQuery url.Values
+
+	// AdaptiveChunking sizes chunks after the measured throughput instead
+	// of using a fixed size: the first chunk is small, the following ones
+	// grow, up to 64MiB, as long as they're downloaded in about a second.
+	AdaptiveChunking bool
+
+	// TeeTo, if set, receives the bytes as they're read, e.g. to keep a
+	// local copy of the object without fetching it twice. Bytes are written
+	// before Read returns, so slow writers slow reads down. A failed write
+	// aborts the download with a *TeeError.
+	TeeTo io.Writer
+
+	// Buffered downloads the whole object in memory before Open returns,
+	// chunks being written at their offset as soon as they complete, in any
+	// order, so a slow chunk doesn't hold back the others. It's the fastest
+	// way to get a whole object which fits in memory, AdaptiveChunking and
+	// Stream don't apply.
+	Buffered bool
+
+	// HedgeDelay, if positive, smooths out the occasional slow responses of
+	// S3: a chunk request which hasn't returned after HedgeDelay, e.g. the
+	// p99 latency of the requests, is sent a second time and the first
+	// response is used, the other request is cancelled.
+	HedgeDelay time.Duration
+
+	// RequesterPays acknowledges that the requester pays for the requests
+	// made to the bucket.
+	RequesterPays bool
+
+	// budget, if set, is shared by the downloads of DownloadDir to cap the
+	// bytes they buffer.
+	budget *budget
 }
 
 // Open opens an S3 object at url and return an io.ReadCloser.
 func Open(uri string, c *http.Client) (io.ReadCloser, http.Header, error) {
+	return OpenWithOptions(uri, nil, c)
+}
+
+// OpenWithOptions opens an S3 object at url with the given options and
+// return an io.ReadCloser.
+func OpenWithOptions(uri string, opts *DownloadOptions, c *http.Client) (io.ReadCloser, http.Header, error) {
+	d := &Downloader{Client: c, Options: opts}
+	return d.Open(uri)
+}
+
+func open(uri string, opts *DownloadOptions, c *http.Client) (io.ReadCloser, http.Header, error) {
 	if c == nil {
 		c = DefaultClient
 	}
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
 
 	u, err := url.Parse(uri)
 	if err != nil {
 		return nil, nil, err
 	}
 	u.Scheme = "https"
+	addQuery(u, opts.ExtraQuery)
 
-	// Retrieve Content-Length
-	req, err := http.NewRequest("HEAD", u.String(), nil)
-	if err != nil {
-		return nil, nil, err
+	g := &getter{
+		client:        c,
+		ctx:           context.Background(),
+		policy:        opts.RetryPolicy,
+		hedgeDelay:    opts.HedgeDelay,
+		requesterPays: opts.RequesterPays,
 	}
-	resp, err := retry(retryNoBody(c, req), retries)
-	if err != nil {
-		return nil, nil, err
+	d := &downloader{
+		chunks:    make(chan *chunk),
+		readAhead: make(chan bool, concurrency),
+		cancel:    func() {},
+		tee:       opts.TeeTo,
+		adaptive:  opts.AdaptiveChunking,
+		budget:    opts.budget,
+		closed:    make(chan struct{}),
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return nil, nil, newResponseError(resp)
+	if opts.Timeout > 0 {
+		g.ctx, d.cancel = context.WithTimeout(g.ctx, opts.Timeout)
+	}
+	newChunk := func(start, end int64) *chunk {
+		c := &chunk{
+			done:      make(chan bool),
+			buf:       new(bytes.Buffer),
+			getter:    g,
+			url:       u.String(),
+			readAhead: d.readAhead,
+			header:    make(http.Header),
+			start:     start,
+			end:       end,
+			stream:    opts.Stream,
+		}
+		c.cond = sync.NewCond(&c.mu)
+		return c
 	}
 
-	s, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
-	if err != nil {
-		return nil, nil, fmt.Errorf("s3: cannot parse content-length")
+	var (
+		first  *chunk
+		header http.Header
+		s      int64
+	)
+	if opts.SkipHead {
+		size := int64(minPartSize)
+		if opts.AdaptiveChunking {
+			size = minAdaptiveChunkSize
+		}
+		first = newChunk(0, size-1)
+		header, s, err = first.probe()
+		if err != nil {
+			d.cancel()
+			return nil, nil, err
+		}
+		if header == nil {
+			first = nil
+		}
+	}
+	var downloaded bool
+	if first != nil && first.size() == first.end-first.start+1 {
+		downloaded = true
+		first.finished = true
+		close(first.done)
+	}
+	if header == nil {
+		header, s, err = head(g, u.String())
+		if err != nil {
+			d.cancel()
+			return nil, nil, err
+		}
+	}
+	if opts.MaxObjectSize > 0 && s > opts.MaxObjectSize {
+		d.cancel()
+		return nil, nil, &ObjectTooLargeError{Size: s, MaxSize: opts.MaxObjectSize}
 	}
 
-	d := &downloader{
-		chunks:    make(chan *chunk),
-		readAhead: make(chan bool, concurrency),
+	if opts.Buffered {
+		// The whole object is held until the download is closed.
+		if d.budget != nil {
+			if !d.budget.acquire(s, g.ctx.Done()) {
+				d.Close()
+				return nil, nil, g.ctx.Err()
+			}
+			d.bufReserved = s
+		}
+		b, err := assemble(g, u.String(), s, first)
+		if err != nil {
+			d.Close()
+			return nil, nil, err
+		}
+		d.buf, d.r, d.buffered = b, bytes.NewReader(b), true
+		return d, header, nil
+	}
+
+	if opts.AdaptiveChunking {
+		d.r = d.dispatch(s, first, downloaded, newChunk)
+		return d, header, nil
 	}
 
 	// Create chunks
 	var chunks []*chunk
 	for i := int64(0); i < s; {
-		size := min64(minPartSize, s)
-		c := &chunk{
-			done:      make(chan bool),
-			buf:       new(bytes.Buffer),
-			client:    c,
-			url:       u.String(),
-			readAhead: d.readAhead,
-			header: http.Header{
-				"Range": {fmt.Sprintf("bytes=%d-%d", i, i+size-1)},
-			},
+		size := min64(minPartSize, s-i)
+		if i == 0 && first != nil {
+			chunks = append(chunks, first)
+		} else {
+			chunks = append(chunks, newChunk(i, i+size-1))
 		}
-		chunks = append(chunks, c)
 		i += size
 	}
 
@@ -134,57 +517,261 @@ func Open(uri string, c *http.Client) (io.ReadCloser, http.Header, error) {
 
 	go func() {
 		for _, c := range chunks {
+			if c == first && downloaded {
+				continue
+			}
+			if !d.reserve(c) {
+				return
+			}
 			d.chunks <- c
 		}
 	}()
 
-	return d, resp.Header, nil
+	return d, header, nil
+}
+
+// head returns the headers and the size of the object at uri.
+func head(g *getter, uri string) (http.Header, int64, error) {
+	resp, err := g.do("HeadObject", "HEAD", uri, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, 0, newResponseError(resp)
+	}
+
+	s, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("s3: cannot parse content-length")
+	}
+	return resp.Header, s, nil
+}
+
+// probe starts downloading the chunk and returns the headers and the size of the
+// object, as reported by the Content-Range of the response. It returns nil
+// headers if the response can't tell the size of the object.
+func (c *chunk) probe() (http.Header, int64, error) {
+	h := c.header.Clone()
+	h.Set("Range", fmt.Sprintf("bytes=%d-%d", c.start, c.end))
+	resp, err := c.getter.hedge("GetObject", "GET", c.url, h)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case 206:
+	case 200, 416:
+		// Servers ignoring ranges as well as empty objects need a HEAD
+		// request.
+		return nil, 0, nil
+	default:
+		return nil, 0, newResponseError(resp)
+	}
+	cr := resp.Header.Get("Content-Range")
+	i := strings.LastIndex(cr, "/")
+	if i < 0 {
+		return nil, 0, nil
+	}
+	s, err := strconv.ParseInt(cr[i+1:], 10, 64)
+	if err != nil {
+		return nil, 0, nil
+	}
+	c.end = min64(c.end, s-1)
+	c.etag = resp.Header.Get("ETag")
+	// A partial read is resumed when the chunk is downloaded again.
+	io.Copy(c, resp.Body)
+
+	// Report the object as a HEAD request would.
+	h = resp.Header.Clone()
+	h.Del("Content-Range")
+	h.Set("Content-Length", strconv.FormatInt(s, 10))
+	return h, s, nil
 }
 
 func (d *downloader) Read(p []byte) (int, error) {
-	if d.err != nil {
-		return 0, d.err
+	if err := d.error(); err != nil {
+		return 0, err
+	}
+	if !d.buffered {
+		d.once.Do(func() {
+			// Start downloading chunks only when requested.
+			for i := 0; i < concurrency; i++ {
+				go d.download()
+			}
+		})
 	}
-	d.once.Do(func() {
-		// Start downloading chunks only when requested.
-		for i := 0; i < concurrency; i++ {
-			go d.download()
+	n, err := d.r.Read(p)
+	if n > 0 && d.tee != nil {
+		if err := tee(d.tee, p[:n]); err != nil {
+			d.cancel()
+			d.mu.Lock()
+			d.err = &TeeError{Err: err}
+			d.mu.Unlock()
+			return n, d.error()
 		}
-	})
-	return d.r.Read(p)
+	}
+	return n, err
+}
+
+func tee(w io.Writer, p []byte) error {
+	n, err := w.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	return err
 }
 
 func (d *downloader) WriteTo(w io.Writer) (n int64, err error) {
 	buf := make([]byte, minPartSize)
 	for {
-		m, err := d.Read(buf)
-		if err != nil && err != io.EOF {
-			return n, err
+		m, rerr := d.Read(buf)
+		if m > 0 {
+			// Only bytes actually written are accounted.
+			written, err := w.Write(buf[:m])
+			n += int64(written)
+			if err != nil {
+				return n, err
+			}
+			if written < m {
+				return n, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
 		}
-		m, err = w.Write(buf[:m])
-		n += int64(m)
-		if err != nil || err == io.EOF {
-			return n, err
+		if rerr != nil {
+			return n, rerr
 		}
 	}
 }
 
 func (d *downloader) Close() error {
-	if d.err != nil {
-		return d.err
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.closing.Do(func() {
+		close(d.closed)
+		if d.budget == nil {
+			return
+		}
+		// Chunks left unread would hold their bytes forever.
+		d.mu.Lock()
+		for _, c := range d.budgeted {
+			c.release()
+		}
+		d.mu.Unlock()
+		if d.bufReserved > 0 {
+			d.budget.release(d.bufReserved)
+		}
+		d.budget.wake()
+	})
+	if err := d.error(); err != nil {
+		return err
 	}
 	return nil
 }
 
 func (d *downloader) download() {
 	for c := range d.chunks {
-		if err := c.Download(); err != nil {
+		start := time.Now()
+		err := c.Download()
+		d.mu.Lock()
+		if err != nil {
 			d.err = err
+		} else if d.adaptive {
+			rate := float64(c.end-c.start+1) / time.Since(start).Seconds()
+			if d.rate == 0 {
+				d.rate = rate
+			} else {
+				d.rate = (d.rate + rate) / 2
+			}
 		}
+		d.mu.Unlock()
 		<-d.readAhead
 	}
 }
 
+// dispatch creates the chunks of an adaptive download of an object of size
+// s as workers become available, so their size follows the measured
+// throughput. Chunks are read in order from the returned reader.
+func (d *downloader) dispatch(s int64, first *chunk, downloaded bool, newChunk func(start, end int64) *chunk) io.Reader {
+	ordered := make(chan *chunk, concurrency)
+	go func() {
+		defer close(ordered)
+		var size int64
+		for i := int64(0); i < s; i += size {
+			var c *chunk
+			if i == 0 && first != nil {
+				c = first
+			} else {
+				c = newChunk(i, min64(i+d.chunkSize(size), s)-1)
+			}
+			size = c.end - c.start + 1
+			ordered <- c
+			if c == first && downloaded {
+				continue
+			}
+			if !d.reserve(c) {
+				return
+			}
+			d.chunks <- c
+		}
+	}()
+	return &chunkReader{chunks: ordered}
+}
+
+// chunkSize returns the size of the chunk following one of the given size:
+// it is the number of bytes downloaded in adaptiveChunkDuration at the
+// measured throughput, without growing faster than doubling. Chunks are
+// small until the throughput is known.
+func (d *downloader) chunkSize(previous int64) int64 {
+	d.mu.Lock()
+	rate := d.rate
+	d.mu.Unlock()
+	if rate == 0 {
+		return minAdaptiveChunkSize
+	}
+	size := 2 * previous
+	if n := int64(rate * adaptiveChunkDuration.Seconds()); n < size {
+		size = n
+	}
+	switch {
+	case size < minAdaptiveChunkSize:
+		return minAdaptiveChunkSize
+	case size > maxAdaptiveChunkSize:
+		return maxAdaptiveChunkSize
+	}
+	return size
+}
+
+// chunkReader reads chunks in the order they're received.
+type chunkReader struct {
+	chunks  <-chan *chunk
+	current *chunk
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			c, ok := <-r.chunks
+			if !ok {
+				return 0, io.EOF
+			}
+			r.current = c
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
 func min64(a, b int64) int64 {
 	if a < b {
 		return a
@@ -0,0 +1,152 @@
+package s3
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Partition is a group of AWS regions sharing the same DNS suffix.
+type Partition struct {
+	ID        string
+	DNSSuffix string
+}
+
+// Partitions of AWS regions.
+var (
+	AWSPartition      = Partition{ID: "aws", DNSSuffix: "amazonaws.com"}
+	ChinaPartition    = Partition{ID: "aws-cn", DNSSuffix: "amazonaws.com.cn"}
+	GovCloudPartition = Partition{ID: "aws-us-gov", DNSSuffix: "amazonaws.com"}
+)
+
+// PartitionOf returns the partition of the given region.
+func PartitionOf(region string) Partition {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return ChinaPartition
+	case strings.HasPrefix(region, "us-gov-"):
+		return GovCloudPartition
+	default:
+		return AWSPartition
+	}
+}
+
+// EndpointOptions configures the S3 endpoints requests are sent to.
+type EndpointOptions struct {
+	// UseFIPS sends requests to FIPS 140-2 validated endpoints.
+	UseFIPS bool
+
+	// Partition is the partition of the endpoints, it is inferred from the
+	// region if nil.
+	Partition *Partition
+
+	// PathStyle sends requests with path-style addressing, the bucket being
+	// the first segment of the path instead of part of the host. Buckets
+	// with dots always use path-style addressing.
+	PathStyle bool
+}
+
+// fipsRegions are the regions with FIPS endpoints.
+var fipsRegions = map[string]bool{
+	"us-east-1":     true,
+	"us-east-2":     true,
+	"us-west-1":     true,
+	"us-west-2":     true,
+	"ca-central-1":  true,
+	"ca-west-1":     true,
+	"us-gov-east-1": true,
+	"us-gov-west-1": true,
+}
+
+var (
+	hostRegexp   = regexp.MustCompile(`^(?:(.+)\.)?s3(-fips)?(?:[.-]([a-z0-9-]+))?\.amazonaws\.com(\.cn)?$`)
+	regionRegexp = regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-\d+$`)
+)
+
+// Endpoint returns the host of the S3 endpoint of the given region.
+func Endpoint(region string, opts *EndpointOptions) (string, error) {
+	if opts == nil {
+		opts = &EndpointOptions{}
+	}
+	if !regionRegexp.MatchString(region) {
+		return "", fmt.Errorf("s3: invalid region %q", region)
+	}
+	service := "s3"
+	if opts.UseFIPS {
+		if !fipsRegions[region] {
+			return "", fmt.Errorf("s3: FIPS endpoints aren't available in %s", region)
+		}
+		service = "s3-fips"
+	}
+	p := PartitionOf(region)
+	if opts.Partition != nil {
+		p = *opts.Partition
+	}
+	return service + "." + region + "." + p.DNSSuffix, nil
+}
+
+// parseHost returns the bucket and the region of an S3 endpoint host. It
+// reports false if host isn't an S3 endpoint.
+func parseHost(host string) (bucket, region string, ok bool) {
+	m := hostRegexp.FindStringSubmatch(host)
+	if m == nil {
+		return "", "", false
+	}
+	bucket, region = m[1], m[3]
+	switch {
+	case region == "" && m[4] != "":
+		// China regions don't have a global endpoint.
+		return "", "", false
+	case region == "", region == "external-1":
+		region = "us-east-1"
+	}
+	if !regionRegexp.MatchString(region) {
+		return "", "", false
+	}
+	return bucket, region, true
+}
+
+// pathStyle moves the bucket of virtual-hosted S3 URLs to their path when it
+// contains dots, as such hosts don't match the wildcard certificate of S3.
+func pathStyle(u *url.URL) {
+	bucket, _, ok := parseHost(u.Hostname())
+	if !ok || !strings.Contains(bucket, ".") {
+		return
+	}
+	u.Host = strings.TrimPrefix(u.Host, bucket+".")
+	u.Path = "/" + bucket + u.Path
+	u.RawPath = ""
+}
+
+// EndpointBuilder returns a RequestBuilder sending requests to S3 endpoints
+// to the variant described by opts, other hosts are left untouched.
+func EndpointBuilder(opts EndpointOptions) RequestBuilder {
+	return func(method, uri string, body io.Reader) (*http.Request, error) {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, err
+		}
+		if bucket, region, ok := parseHost(u.Hostname()); ok {
+			host, err := Endpoint(region, &opts)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case bucket == "":
+			case opts.PathStyle || strings.Contains(bucket, "."):
+				u.Path = "/" + bucket + u.Path
+				u.RawPath = ""
+			default:
+				host = bucket + "." + host
+			}
+			if port := u.Port(); port != "" {
+				host += ":" + port
+			}
+			u.Host = host
+		}
+		return AWSRequestBuilder(method, u.String(), body)
+	}
+}
@@ -2,29 +2,207 @@ package s3
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 )
 
-type responseError struct {
-	Code    string `xml:"Code"`
-	Message string `xml:"Message"`
+// APIError is returned when S3 responds with an unexpected status code.
+type APIError struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestID  string `xml:"RequestId"`
 
-	r *http.Response
+	// Header holds the headers of the response.
+	Header http.Header `xml:"-"`
 }
 
-func newResponseError(r *http.Response) *responseError {
-	e := &responseError{
-		r: r,
+func newResponseError(r *http.Response) *APIError {
+	e := &APIError{
+		StatusCode: r.StatusCode,
+		Header:     r.Header,
 	}
 	defer r.Body.Close()
 	xml.NewDecoder(r.Body).Decode(&e)
+	if e.RequestID == "" {
+		e.RequestID = r.Header.Get("X-Amz-Request-Id")
+	}
 	return e
 }
 
-func (e *responseError) Error() string {
+func (e *APIError) Error() string {
 	if e.Code != "" && e.Message != "" {
 		return fmt.Sprintf("s3: unexpected error: (%s) %s", e.Code, e.Message)
 	}
-	return fmt.Sprintf("s3: unexpected error: (%d)", e.r.StatusCode)
+	return fmt.Sprintf("s3: unexpected error: (%d)", e.StatusCode)
+}
+
+// AlreadyExistsError is returned when creating an object which already
+// exists with UploadOptions.CreateIfAbsent, or without Overwrite in its
+// Preflight, in which case APIError is the 412 PreconditionFailed S3 would
+// have returned for a conditional write.
+type AlreadyExistsError struct {
+	*APIError
+}
+
+func (e *AlreadyExistsError) Error() string {
+	return "s3: object already exists"
+}
+
+func (e *AlreadyExistsError) Unwrap() error {
+	if e.APIError == nil {
+		return nil
+	}
+	return e.APIError
+}
+
+// IsAlreadyExists reports whether err indicates that the object already
+// exists.
+func IsAlreadyExists(err error) bool {
+	var e *AlreadyExistsError
+	return errors.As(err, &e)
+}
+
+// ObjectTooLargeError is returned when opening an object bigger than
+// DownloadOptions.MaxObjectSize, or uploading one bigger than the MaxSize of
+// its Preflight.
+type ObjectTooLargeError struct {
+	Size    int64
+	MaxSize int64
+}
+
+func (e *ObjectTooLargeError) Error() string {
+	return fmt.Sprintf("s3: object size %d exceeds maximum of %d", e.Size, e.MaxSize)
+}
+
+// MetadataTooLargeError is returned when the user-defined metadata of an
+// object exceeds the 2KB allowed by S3.
+type MetadataTooLargeError struct {
+	Size    int
+	MaxSize int
+}
+
+func (e *MetadataTooLargeError) Error() string {
+	return fmt.Sprintf("s3: metadata size %d exceeds maximum of %d", e.Size, e.MaxSize)
+}
+
+// TeeError is returned when writing downloaded bytes to
+// DownloadOptions.TeeTo fails, the download is then aborted.
+type TeeError struct {
+	Err error
+}
+
+func (e *TeeError) Error() string {
+	return "s3: cannot write to tee: " + e.Err.Error()
+}
+
+func (e *TeeError) Unwrap() error {
+	return e.Err
+}
+
+// ChecksumMismatchError is returned when the checksum of an assembled object
+// isn't the one computed from its parts.
+type ChecksumMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("s3: mismatching checksum of assembled object: %q != %q", e.Actual, e.Expected)
+}
+
+// BatchItemError describes an item of a batch operation which failed.
+type BatchItemError struct {
+	Key string
+	Err error
+}
+
+func (e *BatchItemError) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError is returned when some items of a batch operation, such as
+// DeleteObjects or UploadDir, failed while the others succeeded. The
+// failures are sorted by key, errors.Is and errors.As match any of them.
+type BatchError struct {
+	Errors []*BatchItemError
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Errors) == 1 {
+		return "s3: 1 item failed: " + e.Errors[0].Error()
+	}
+	return fmt.Sprintf("s3: %d items failed, first: %v", len(e.Errors), e.Errors[0])
+}
+
+func (e *BatchError) sort() {
+	sort.SliceStable(e.Errors, func(i, j int) bool {
+		return e.Errors[i].Key < e.Errors[j].Key
+	})
+}
+
+// Is reports whether any of the failures matches target.
+func (e *BatchError) Is(target error) bool {
+	for _, item := range e.Errors {
+		if errors.Is(item, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first failure matching target.
+func (e *BatchError) As(target interface{}) bool {
+	for _, item := range e.Errors {
+		if errors.As(item, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotFound reports whether err indicates that the object or bucket
+// doesn't exist.
+func IsNotFound(err error) bool {
+	return hasCode(err, http.StatusNotFound, "NoSuchKey", "NoSuchBucket", "NoSuchVersion", "NotFound")
+}
+
+// IsAccessDenied reports whether err indicates that access to the resource
+// was denied.
+func IsAccessDenied(err error) bool {
+	return hasCode(err, http.StatusForbidden, "AccessDenied")
+}
+
+// IsThrottled reports whether err indicates that the request was throttled.
+func IsThrottled(err error) bool {
+	return hasCode(err, http.StatusTooManyRequests, "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequests")
+}
+
+// IsPreconditionFailed reports whether err indicates that a condition of the
+// request, such as DeleteOptions.IfMatch, wasn't met.
+func IsPreconditionFailed(err error) bool {
+	return hasCode(err, http.StatusPreconditionFailed, "PreconditionFailed")
+}
+
+func hasCode(err error, status int, codes ...string) bool {
+	var e *APIError
+	if !errors.As(err, &e) {
+		return false
+	}
+	if e.Code == "" {
+		// HEAD responses don't have a body to read the code from.
+		return e.StatusCode == status
+	}
+	for _, c := range codes {
+		if e.Code == c {
+			return true
+		}
+	}
+	return e.StatusCode == status
 }
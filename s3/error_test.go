@@ -1,6 +1,8 @@
 package s3
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -40,3 +42,77 @@ func TestResponseError(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorHelpers(t *testing.T) {
+	var tests = []struct {
+		Status       int
+		Code         string
+		NotFound     bool
+		AccessDenied bool
+		Throttled    bool
+	}{
+		{Status: 404, Code: "NoSuchKey", NotFound: true},
+		{Status: 404, Code: "NoSuchBucket", NotFound: true},
+		{Status: 404, NotFound: true},
+		{Status: 403, Code: "AccessDenied", AccessDenied: true},
+		{Status: 403, AccessDenied: true},
+		{Status: 403, Code: "SignatureDoesNotMatch", AccessDenied: true},
+		{Status: 503, Code: "SlowDown", Throttled: true},
+		{Status: 429, Throttled: true},
+		{Status: 503, Code: "ServiceUnavailable"},
+		{Status: 500, Code: "InternalError"},
+	}
+	for _, test := range tests {
+		body := ""
+		if test.Code != "" {
+			body = "<Error><Code>" + test.Code + "</Code><Message>message</Message></Error>"
+		}
+		err := fmt.Errorf("wrapped: %w", newResponseError(&http.Response{
+			StatusCode: test.Status,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}))
+		if IsNotFound(err) != test.NotFound {
+			t.Errorf("(%d %s) expected IsNotFound to be %t", test.Status, test.Code, test.NotFound)
+		}
+		if IsAccessDenied(err) != test.AccessDenied {
+			t.Errorf("(%d %s) expected IsAccessDenied to be %t", test.Status, test.Code, test.AccessDenied)
+		}
+		if IsThrottled(err) != test.Throttled {
+			t.Errorf("(%d %s) expected IsThrottled to be %t", test.Status, test.Code, test.Throttled)
+		}
+	}
+	if IsNotFound(errors.New("not found")) {
+		t.Error("expected non API errors to be ignored")
+	}
+}
+
+func TestStatNotFound(t *testing.T) {
+	_, ts := newFakeS3(t)
+	if _, err := Stat(uri(ts, "/bucket/missing.txt"), ts.Client()); !IsNotFound(err) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	if _, _, err := Open(uri(ts, "/bucket/missing.txt"), ts.Client()); !IsNotFound(err) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	notFound := &APIError{StatusCode: 404, Code: "NoSuchKey"}
+	err := fmt.Errorf("wrapped: %w", &BatchError{Errors: []*BatchItemError{
+		{Key: "a.txt", Err: errors.New("boom")},
+		{Key: "b.txt", Err: notFound},
+	}})
+	if s := err.Error(); s != "wrapped: s3: 2 items failed, first: a.txt: boom" {
+		t.Errorf("unexpected message %q", s)
+	}
+	if !errors.Is(err, notFound) || !IsNotFound(err) {
+		t.Error("expected the failures to be matched")
+	}
+	var item *BatchItemError
+	if !errors.As(err, &item) || item.Key != "a.txt" {
+		t.Errorf("expected the first failure, got %v", item)
+	}
+	if errors.Is(err, errCompleted) {
+		t.Error("unexpected match")
+	}
+}
@@ -0,0 +1,202 @@
+package s3
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// GzipMember locates a member of a gzip object made of concatenated
+// members, like logs compressed in batches. Each member can be decompressed
+// on its own.
+type GzipMember struct {
+	// Offset and Size locate the compressed member in the object.
+	Offset int64
+	Size   int64
+	// Length is the size of the decompressed member.
+	Length int64
+}
+
+// ScanGzipMembers downloads the gzip object at uri once and returns the
+// members it is made of, which can be kept as an index to read the object
+// later with a GzipReader.
+func ScanGzipMembers(uri string, c *http.Client) ([]GzipMember, error) {
+	r, _, err := OpenWithOptions(uri, &DownloadOptions{Stream: true}, c)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// The decompressor reads exactly up to the end of a member from an
+	// io.ByteReader, so the bytes read so far are the offset of the next.
+	cr := &countingReader{r: bufio.NewReader(r)}
+	var (
+		members []GzipMember
+		z       gzip.Reader
+	)
+	for {
+		offset := cr.n
+		if err := z.Reset(cr); err == io.EOF {
+			return members, nil
+		} else if err != nil {
+			return nil, err
+		}
+		z.Multistream(false)
+		n, err := io.Copy(ioutil.Discard, &z)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, GzipMember{Offset: offset, Size: cr.n - offset, Length: n})
+	}
+}
+
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// OpenGzipMember fetches the member m of the gzip object at uri with a
+// ranged request, and returns its decompressed content.
+func OpenGzipMember(uri string, m GzipMember, c *http.Client) (io.ReadCloser, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	if m.Offset < 0 || m.Size <= 0 {
+		return nil, fmt.Errorf("s3: invalid gzip member at %d of %d bytes", m.Offset, m.Size)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "https"
+
+	req, err := newRequest("GetObject", "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", m.Offset, m.Offset+m.Size-1))
+	resp, err := retry(retryNoBody(c, req), retries)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 206 {
+		defer resp.Body.Close()
+		return nil, newResponseError(resp)
+	}
+	z, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	z.Multistream(false)
+	return &gzipMember{Reader: z, body: resp.Body}, nil
+}
+
+type gzipMember struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (m *gzipMember) Close() error {
+	m.Reader.Close()
+	return m.body.Close()
+}
+
+// GzipReader reads the decompressed content of a gzip object made of
+// concatenated members at arbitrary offsets, only fetching and decompressing
+// the members covering the bytes read. It is safe for concurrent use.
+type GzipReader struct {
+	uri     string
+	members []GzipMember
+	// starts holds the decompressed offset of each member.
+	starts []int64
+	size   int64
+	c      *http.Client
+}
+
+// NewGzipReader returns a GzipReader of the gzip object at uri, made of the
+// given members in order, as returned by ScanGzipMembers.
+func NewGzipReader(uri string, members []GzipMember, c *http.Client) (*GzipReader, error) {
+	if len(members) == 0 {
+		return nil, errors.New("s3: no gzip members")
+	}
+	r := &GzipReader{
+		uri:     uri,
+		members: members,
+		starts:  make([]int64, len(members)),
+		c:       c,
+	}
+	for i, m := range members {
+		if m.Length < 0 {
+			return nil, fmt.Errorf("s3: invalid length %d of gzip member %d", m.Length, i)
+		}
+		r.starts[i] = r.size
+		r.size += m.Length
+	}
+	return r, nil
+}
+
+// Size returns the decompressed size of the object.
+func (r *GzipReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt reads len(p) bytes of the decompressed content from off, it
+// implements io.ReaderAt.
+func (r *GzipReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("s3: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	// The last member starting at or before off.
+	i := sort.Search(len(r.starts), func(i int) bool { return r.starts[i] > off }) - 1
+	var n int
+	for ; n < len(p) && i < len(r.members); i++ {
+		if r.members[i].Length == 0 {
+			continue
+		}
+		m, err := OpenGzipMember(r.uri, r.members[i], r.c)
+		if err != nil {
+			return n, err
+		}
+		skip := off + int64(n) - r.starts[i]
+		if _, err := io.CopyN(ioutil.Discard, m, skip); err != nil {
+			m.Close()
+			return n, err
+		}
+		want := min64(int64(len(p)-n), r.members[i].Length-skip)
+		k, err := io.ReadFull(m, p[n:n+int(want)])
+		n += k
+		m.Close()
+		if err != nil {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestGzipReader(t *testing.T) {
+	f, ts := newFakeS3(t)
+	var (
+		object  bytes.Buffer
+		content []string
+	)
+	for _, s := range []string{"first line\n", "second line\n", "", "third line\n"} {
+		z := gzip.NewWriter(&object)
+		z.Write([]byte(s))
+		z.Close()
+		content = append(content, s)
+	}
+	f.put("/bucket/logs.gz", object.Bytes())
+	expected := strings.Join(content, "")
+
+	members, err := ScanGzipMembers(uri(ts, "/bucket/logs.gz"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 4 {
+		t.Fatalf("expected 4 members, got %d", len(members))
+	}
+	var end int64
+	for i, m := range members {
+		if m.Offset != end || m.Length != int64(len(content[i])) {
+			t.Errorf("unexpected member %d %+v", i, m)
+		}
+		end = m.Offset + m.Size
+	}
+	if end != int64(object.Len()) {
+		t.Errorf("expected members to cover %d bytes, got %d", object.Len(), end)
+	}
+
+	r, err := NewGzipReader(uri(ts, "/bucket/logs.gz"), members, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(expected)) {
+		t.Errorf("expected a size of %d, got %d", len(expected), r.Size())
+	}
+	got, err := ioutil.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("unexpected content %q", got)
+	}
+
+	// Reading within the second member only fetches it.
+	before := len(f.recorded())
+	p := make([]byte, 4)
+	if _, err := r.ReadAt(p, 18); err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != "line" {
+		t.Errorf("unexpected content %q", p)
+	}
+	requests := f.recorded()[before:]
+	if len(requests) != 1 {
+		t.Fatalf("expected a single request, got %d", len(requests))
+	}
+	if rg := requests[0].Header.Get("Range"); rg != fmt.Sprintf("bytes=%d-%d", members[1].Offset, members[1].Offset+members[1].Size-1) {
+		t.Errorf("unexpected range %q", rg)
+	}
+
+	// Reads across members and past the end.
+	p = make([]byte, 20)
+	n, err := r.ReadAt(p, 15)
+	if err != io.EOF || string(p[:n]) != expected[15:] {
+		t.Errorf("unexpected read %q %v", p[:n], err)
+	}
+}
@@ -0,0 +1,31 @@
+package s3
+
+import (
+	"bufio"
+	"net/http"
+)
+
+// Lines calls fn with each line of the object at uri, without its end of
+// line marker, as the object is downloaded. Lines are limited to maxLineSize
+// bytes, bufio.MaxScanTokenSize if 0, longer lines fail with
+// bufio.ErrTooLong. Iteration stops at the first error returned by fn, which
+// is returned.
+func Lines(uri string, maxLineSize int, fn func(line string) error, c *http.Client) error {
+	r, _, err := OpenWithOptions(uri, &DownloadOptions{Stream: true}, c)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if maxLineSize <= 0 {
+		maxLineSize = bufio.MaxScanTokenSize
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, min(maxLineSize, 64*1024)), maxLineSize)
+	for s.Scan() {
+		if err := fn(s.Text()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	f, ts := newFakeS3(t)
+	var (
+		lines []string
+		size  int
+	)
+	// Long lines span the chunk boundaries.
+	for i := 0; size < 2*minPartSize+1024; i++ {
+		l := fmt.Sprintf("%d %s", i, strings.Repeat("x", 100*1024+i))
+		lines = append(lines, l)
+		size += len(l) + 1
+	}
+	f.put("/bucket/log.txt", []byte(strings.Join(lines, "\n")+"\n"))
+
+	var read []string
+	err := Lines(uri(ts, "/bucket/log.txt"), 256*1024, func(line string) error {
+		read = append(read, line)
+		return nil
+	}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(lines) {
+		t.Fatalf("expected %d lines, got %d", len(lines), len(read))
+	}
+	for i := range lines {
+		if read[i] != lines[i] {
+			t.Fatalf("unexpected line %d", i)
+		}
+	}
+
+	err = Lines(uri(ts, "/bucket/log.txt"), 0, func(string) error { return nil }, ts.Client())
+	if err != bufio.ErrTooLong {
+		t.Errorf("expected lines to be too long, got %v", err)
+	}
+
+	stop := errors.New("stop")
+	var n int
+	err = Lines(uri(ts, "/bucket/log.txt"), 256*1024, func(string) error {
+		n++
+		return stop
+	}, ts.Client())
+	if err != stop || n != 1 {
+		t.Errorf("expected iteration to stop, got %v after %d lines", err, n)
+	}
+}
+
+func TestLinesError(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/log.txt", []byte(strings.Repeat("line\n", 2*minPartSize/5)))
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if strings.HasPrefix(r.Header.Get("Range"), fmt.Sprintf("bytes=%d-", minPartSize)) {
+			writeError(w, 403, "AccessDenied")
+			return true
+		}
+		return false
+	}
+	var n int
+	err := Lines(uri(ts, "/bucket/log.txt"), 0, func(string) error {
+		n++
+		return nil
+	}, ts.Client())
+	if !IsAccessDenied(err) {
+		t.Errorf("expected the download error, got %v", err)
+	}
+	if n != minPartSize/5 {
+		t.Errorf("expected the lines of the first chunk, got %d", n)
+	}
+}
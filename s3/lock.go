@@ -0,0 +1,154 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Retention modes of locked objects.
+const (
+	RetentionGovernance = "GOVERNANCE"
+	RetentionCompliance = "COMPLIANCE"
+)
+
+// Retention describes how long a locked object version can't be overwritten
+// or deleted.
+type Retention struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ Retention"`
+
+	// Mode is either RetentionGovernance or RetentionCompliance.
+	Mode            string    `xml:"Mode"`
+	RetainUntilDate time.Time `xml:"RetainUntilDate"`
+}
+
+type legalHold struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LegalHold"`
+	Status  string   `xml:"Status"`
+}
+
+// GetObjectRetention returns the retention of the object at uri.
+func GetObjectRetention(uri string, c *http.Client) (*Retention, error) {
+	r := new(Retention)
+	if err := getSubresource("GetObjectRetention", uri, "retention", r, c); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// PutObjectRetention sets the retention of the object at uri.
+func PutObjectRetention(uri string, r *Retention, c *http.Client) error {
+	return putSubresource("PutObjectRetention", uri, "retention", r, c)
+}
+
+// GetObjectLegalHold reports whether the object at uri is under legal hold.
+func GetObjectLegalHold(uri string, c *http.Client) (bool, error) {
+	var l legalHold
+	if err := getSubresource("GetObjectLegalHold", uri, "legal-hold", &l, c); err != nil {
+		return false, err
+	}
+	return l.Status == "ON", nil
+}
+
+// PutObjectLegalHold places or removes a legal hold on the object at uri.
+func PutObjectLegalHold(uri string, on bool, c *http.Client) error {
+	return putSubresource("PutObjectLegalHold", uri, "legal-hold", &legalHold{Status: legalHoldStatus(on)}, c)
+}
+
+func legalHoldStatus(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// getSubresource decodes the given subresource of the object at uri into v.
+func getSubresource(op, uri, subresource string, v interface{}, c *http.Client) error {
+	if c == nil {
+		c = DefaultClient
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	u.Scheme = "https"
+	u.RawQuery = subresource
+
+	req, err := newRequest(op, "GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := retry(retryNoBody(c, req), retries)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return newResponseError(resp)
+	}
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+// putSubresource encodes v as the given subresource of the object at uri.
+func putSubresource(op, uri, subresource string, v interface{}, c *http.Client) error {
+	if c == nil {
+		c = DefaultClient
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	u.Scheme = "https"
+	u.RawQuery = subresource
+
+	body, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// Object lock configurations require a Content-MD5.
+	sum := md5.Sum(body)
+	b := bytes.NewReader(body)
+	resp, err := retry(func() (*http.Response, error) {
+		if _, err := b.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		req, err := newRequest(op, "PUT", u.String(), b)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == 500 {
+			return nil, newResponseError(resp)
+		}
+		return resp, nil
+	}, retries)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return newResponseError(resp)
+	}
+	return nil
+}
+
+// setObjectLock sets the object lock headers of an upload.
+func setObjectLock(h http.Header, r *Retention, legalHold bool) {
+	if r != nil {
+		h.Set("X-Amz-Object-Lock-Mode", r.Mode)
+		h.Set("X-Amz-Object-Lock-Retain-Until-Date", r.RetainUntilDate.UTC().Format(time.RFC3339))
+	}
+	if legalHold {
+		h.Set("X-Amz-Object-Lock-Legal-Hold", legalHoldStatus(true))
+	}
+}
@@ -0,0 +1,103 @@
+package s3
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// subresource stores the body of PUT ?name requests and serves it back on GET.
+func subresource(f *fakeS3, name string) {
+	var stored []byte
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if !has(r.URL.Query(), name) {
+			return false
+		}
+		switch r.Method {
+		case "PUT":
+			if r.Header.Get("Content-Md5") == "" {
+				writeError(w, 400, "MissingContentMD5")
+				return true
+			}
+			stored, _ = ioutil.ReadAll(r.Body)
+		case "GET":
+			w.Write(stored)
+		}
+		return true
+	}
+}
+
+func TestObjectRetention(t *testing.T) {
+	f, ts := newFakeS3(t)
+	subresource(f, "retention")
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	err := PutObjectRetention(uri(ts, "/bucket/key"), &Retention{
+		Mode:            RetentionCompliance,
+		RetainUntilDate: until,
+	}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := GetObjectRetention(uri(ts, "/bucket/key"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Mode != RetentionCompliance || !r.RetainUntilDate.Equal(until) {
+		t.Errorf("unexpected retention %+v", r)
+	}
+	if u := f.recorded()[0].URL; u != "/bucket/key?retention" {
+		t.Errorf("unexpected url %q", u)
+	}
+}
+
+func TestObjectLegalHold(t *testing.T) {
+	f, ts := newFakeS3(t)
+	subresource(f, "legal-hold")
+
+	for _, on := range []bool{true, false} {
+		if err := PutObjectLegalHold(uri(ts, "/bucket/key"), on, ts.Client()); err != nil {
+			t.Fatal(err)
+		}
+		hold, err := GetObjectLegalHold(uri(ts, "/bucket/key"), ts.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hold != on {
+			t.Errorf("expected legal hold to be %t", on)
+		}
+	}
+}
+
+func TestUploadObjectLock(t *testing.T) {
+	f, ts := newFakeS3(t)
+	w, err := CreateWithOptions(uri(ts, "/bucket/key"), &UploadOptions{
+		Retention: &Retention{
+			Mode:            RetentionGovernance,
+			RetainUntilDate: time.Date(2030, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)),
+		},
+		LegalHold: true,
+	}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte(strings.Repeat("a", 10))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	h := f.recorded()[0].Header
+	for k, v := range map[string]string{
+		"X-Amz-Object-Lock-Mode":              "GOVERNANCE",
+		"X-Amz-Object-Lock-Retain-Until-Date": "2030-01-02T02:04:05Z",
+		"X-Amz-Object-Lock-Legal-Hold":        "ON",
+	} {
+		if h.Get(k) != v {
+			t.Errorf("expected %s to be %q, got %q", k, v, h.Get(k))
+		}
+	}
+}
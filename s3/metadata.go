@@ -0,0 +1,65 @@
+package s3
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxMetadataSize is the maximum size of the user-defined metadata of an
+// object, the sum of the lengths of the keys and values.
+const maxMetadataSize = 2 * 1024
+
+const metadataPrefix = "X-Amz-Meta-"
+
+// encodeMetadata RFC 2047 encodes the non-ASCII values of the x-amz-meta-*
+// headers of h, which S3 rejects otherwise, and checks the size of the
+// metadata. S3 returns the encoded values as is, they can be decoded with a
+// mime.WordDecoder.
+func encodeMetadata(h http.Header) error {
+	var size int
+	for k, values := range h {
+		if !strings.HasPrefix(http.CanonicalHeaderKey(k), metadataPrefix) {
+			continue
+		}
+		for i, v := range values {
+			values[i] = mime.QEncoding.Encode("utf-8", v)
+			size += len(values[i])
+		}
+		size += len(k) - len(metadataPrefix)
+	}
+	if size > maxMetadataSize {
+		return &MetadataTooLargeError{Size: size, MaxSize: maxMetadataSize}
+	}
+	return nil
+}
+
+// Limits of the tags of an object.
+const (
+	maxTags           = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// encodeTags returns the x-amz-tagging header value of tags, after checking
+// they're within the limits of S3.
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/object-tagging.html
+func encodeTags(tags map[string]string) (string, error) {
+	if len(tags) > maxTags {
+		return "", fmt.Errorf("s3: %d tags exceed the maximum of %d", len(tags), maxTags)
+	}
+	q := make(url.Values, len(tags))
+	for k, v := range tags {
+		if n := utf8.RuneCountInString(k); n == 0 || n > maxTagKeyLength {
+			return "", fmt.Errorf("s3: tag key %q must be 1 to %d characters long", k, maxTagKeyLength)
+		}
+		if utf8.RuneCountInString(v) > maxTagValueLength {
+			return "", fmt.Errorf("s3: value of tag %q exceeds %d characters", k, maxTagValueLength)
+		}
+		q.Set(k, v)
+	}
+	return q.Encode(), nil
+}
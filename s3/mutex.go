@@ -0,0 +1,127 @@
+package s3
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	lockTokenHeader   = "X-Amz-Meta-Lock-Token"
+	lockExpiresHeader = "X-Amz-Meta-Lock-Expires"
+)
+
+var (
+	// ErrLocked is returned by Lock when the lock is held by someone else.
+	ErrLocked = errors.New("s3: lock already held")
+
+	// ErrLockLost is returned by Unlock when the lock expired and was taken
+	// over.
+	ErrLockLost = errors.New("s3: lock no longer held")
+)
+
+// Lease is a lock acquired with Lock.
+type Lease struct {
+	// Token identifies the owner of the lock.
+	Token   string
+	Expires time.Time
+
+	uri string
+	c   *http.Client
+}
+
+// Lock acquires a lock backed by the object at uri, which is created only if
+// it doesn't exist yet. The lock is held until Unlock is called or until ttl
+// elapses, after which it can be taken over by another caller.
+func Lock(uri string, ttl time.Duration, c *http.Client) (*Lease, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	l := &Lease{
+		Token:   token,
+		Expires: time.Now().Add(ttl),
+		uri:     uri,
+		c:       c,
+	}
+	err = l.create()
+	if err == nil {
+		return l, nil
+	}
+	if !IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	// Take over an expired lock, deleting it only if it wasn't taken over
+	// meanwhile.
+	info, err := Stat(uri, c)
+	switch {
+	case IsNotFound(err):
+	case err != nil:
+		return nil, err
+	default:
+		expires, err := time.Parse(time.RFC3339Nano, info.Header.Get(lockExpiresHeader))
+		if err == nil && time.Now().Before(expires) {
+			return nil, ErrLocked
+		}
+		if _, err := DeleteWithOptions(uri, &DeleteOptions{IfMatch: info.ETag}, c); err != nil && !IsNotFound(err) {
+			if IsPreconditionFailed(err) {
+				return nil, ErrLocked
+			}
+			return nil, err
+		}
+	}
+	if err := l.create(); err != nil {
+		if IsAlreadyExists(err) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Lease) create() error {
+	h := make(http.Header)
+	h.Set(lockTokenHeader, l.Token)
+	h.Set(lockExpiresHeader, l.Expires.UTC().Format(time.RFC3339Nano))
+	w, err := CreateWithOptions(l.uri, &UploadOptions{Header: h, CreateIfAbsent: true}, l.c)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte(l.Token)); err != nil {
+		return err
+	}
+	_, err = w.Complete()
+	return err
+}
+
+// Unlock releases the lock, ErrLockLost is returned if it's now held by
+// someone else.
+func (l *Lease) Unlock() error {
+	info, err := Stat(l.uri, l.c)
+	if IsNotFound(err) {
+		return ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+	if info.Header.Get(lockTokenHeader) != l.Token {
+		return ErrLockLost
+	}
+	_, err = DeleteWithOptions(l.uri, &DeleteOptions{IfMatch: info.ETag}, l.c)
+	if IsNotFound(err) || IsPreconditionFailed(err) {
+		return ErrLockLost
+	}
+	return err
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,59 @@
+package s3
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	f, ts := newFakeS3(t)
+	l, err := Lock(uri(ts, "/bucket/lock"), time.Minute, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Lock(uri(ts, "/bucket/lock"), time.Minute, ts.Client()); err != ErrLocked {
+		t.Errorf("expected lock to be contended, got %v", err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.get("/bucket/lock"); ok {
+		t.Error("expected lock to be released")
+	}
+	if err := l.Unlock(); err != ErrLockLost {
+		t.Errorf("expected lock to be lost, got %v", err)
+	}
+	l, err = Lock(uri(ts, "/bucket/lock"), time.Minute, ts.Client())
+	if err != nil {
+		t.Fatalf("expected lock to be acquired again, got %v", err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockExpiry(t *testing.T) {
+	f, ts := newFakeS3(t)
+	expired, err := Lock(uri(ts, "/bucket/lock"), time.Millisecond, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	l, err := Lock(uri(ts, "/bucket/lock"), time.Minute, ts.Client())
+	if err != nil {
+		t.Fatalf("expected expired lock to be taken over, got %v", err)
+	}
+	if l.Token == expired.Token {
+		t.Error("expected a new token")
+	}
+	if err := expired.Unlock(); err != ErrLockLost {
+		t.Errorf("expected lock to be lost, got %v", err)
+	}
+	if b, _ := f.get("/bucket/lock"); string(b) != l.Token {
+		t.Errorf("expected lock to be held by the new owner, got %q", b)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
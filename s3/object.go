@@ -1,15 +1,23 @@
 package s3
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/cyberdelia/aws"
 )
 
 type objectInfo struct {
@@ -40,6 +48,269 @@ func (f *objectInfo) ModTime() time.Time {
 func (f *objectInfo) IsDir() bool      { return f.dir }
 func (f *objectInfo) Sys() interface{} { return f.sys }
 
+// ObjectInfo describes an S3 object as returned by Stat.
+type ObjectInfo struct {
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+
+	// PartCount is the number of parts of objects uploaded in multiple
+	// parts, it's 0 otherwise.
+	PartCount int
+
+	// ReplicationStatus is the status of the replication of the object,
+	// PENDING, COMPLETED, FAILED or REPLICA, if the bucket has a replication
+	// configuration applying to it.
+	ReplicationStatus string
+
+	// ServerSideEncryption is the algorithm the object is encrypted with at
+	// rest, AES256 or aws:kms, and KMSKeyID the key of objects encrypted
+	// with aws:kms.
+	ServerSideEncryption string
+	KMSKeyID             string
+
+	// Header holds all the headers returned for the object.
+	Header http.Header
+}
+
+func newObjectInfo(h http.Header) (*ObjectInfo, error) {
+	size, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, errors.New("s3: cannot parse content-length")
+	}
+	modTime, _ := http.ParseTime(h.Get("Last-Modified"))
+	etag := strings.Trim(h.Get("ETag"), `"`)
+	parts, err := strconv.Atoi(h.Get("X-Amz-Mp-Parts-Count"))
+	if err != nil {
+		parts = partCount(etag)
+	}
+	return &ObjectInfo{
+		Size:         size,
+		ETag:         etag,
+		ContentType:  h.Get("Content-Type"),
+		LastModified: modTime,
+		PartCount:    parts,
+		Header:       h,
+
+		ReplicationStatus:    h.Get("X-Amz-Replication-Status"),
+		ServerSideEncryption: h.Get("X-Amz-Server-Side-Encryption"),
+		KMSKeyID:             h.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
+	}, nil
+}
+
+// IsMultipartETag reports whether etag is the ETag of an object uploaded in
+// multiple parts, which isn't the MD5 of its content.
+func IsMultipartETag(etag string) bool {
+	return partCount(etag) > 0
+}
+
+// partCount returns the number of parts of a composite ETag, such as
+// "d41d8cd98f00b204e9800998ecf8427e-3".
+func partCount(etag string) int {
+	etag = strings.Trim(etag, `"`)
+	i := strings.LastIndex(etag, "-")
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(etag[i+1:])
+	if err != nil || n < 1 {
+		return 0
+	}
+	return n
+}
+
+// Stat returns an ObjectInfo describing the given object. It doesn't
+// acknowledge requester pays buckets, OpenWithOptions does and returns the
+// headers of the object.
+func Stat(uri string, c *http.Client) (*ObjectInfo, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "https"
+
+	req, err := newRequest("HeadObject", "HEAD", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := retry(retryNoBody(c, req), retries)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, newResponseError(resp)
+	}
+	return newObjectInfo(resp.Header)
+}
+
+// Peek returns up to the first n bytes of the object at uri along an
+// ObjectInfo describing it, with a single ranged GET instead of a HEAD
+// followed by a GET, e.g. to sniff the type of its content.
+func Peek(uri string, n int, c *http.Client) ([]byte, *ObjectInfo, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	if n < 1 {
+		return nil, nil, fmt.Errorf("s3: cannot peek %d bytes", n)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.Scheme = "https"
+
+	req, err := newRequest("GetObject", "GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", n-1))
+	resp, err := retry(retryNoBody(c, req), retries)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	h := resp.Header.Clone()
+	switch resp.StatusCode {
+	case 206:
+		// Report the object as a HEAD request would.
+		cr := h.Get("Content-Range")
+		i := strings.LastIndex(cr, "/")
+		if i < 0 {
+			return nil, nil, fmt.Errorf("s3: cannot parse content-range %q", cr)
+		}
+		h.Del("Content-Range")
+		h.Set("Content-Length", cr[i+1:])
+	case 200:
+		// Servers can ignore ranges.
+	case 416:
+		// Empty objects can't satisfy any range.
+		info, err := Stat(uri, c)
+		return []byte{}, info, err
+	default:
+		return nil, nil, newResponseError(resp)
+	}
+	info, err := newObjectInfo(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(n)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, info, nil
+}
+
+// PartInfo describes a part of an object uploaded in multiple parts.
+type PartInfo struct {
+	PartNumber int
+	// Offset is the position of the first byte of the part in the object.
+	Offset int64
+	Size   int64
+
+	// ObjectSize is the size of the whole object and PartCount its number of
+	// parts.
+	ObjectSize int64
+	PartCount  int
+
+	// ETag is the ETag of the whole object.
+	ETag string
+}
+
+// GetPart opens the part partNumber of the object at uri, as it was
+// uploaded, e.g. to process or verify an object part by part. Objects which
+// weren't uploaded in multiple parts have a single part.
+func GetPart(uri string, partNumber int, c *http.Client) (io.ReadCloser, *PartInfo, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	if partNumber < 1 || partNumber > maxParts {
+		return nil, nil, fmt.Errorf("s3: invalid part number %d", partNumber)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.Scheme = "https"
+	addQuery(u, url.Values{"partNumber": []string{strconv.Itoa(partNumber)}})
+
+	req, err := newRequest("GetObject", "GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := retry(retryNoBody(c, req), retries)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &PartInfo{
+		PartNumber: partNumber,
+		ETag:       strings.Trim(resp.Header.Get("ETag"), `"`),
+		PartCount:  1,
+	}
+	switch resp.StatusCode {
+	case 206:
+		cr := resp.Header.Get("Content-Range")
+		var end int64
+		if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &info.Offset, &end, &info.ObjectSize); err != nil {
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("s3: cannot parse content-range %q", cr)
+		}
+		info.Size = end - info.Offset + 1
+		if n, err := strconv.Atoi(resp.Header.Get("X-Amz-Mp-Parts-Count")); err == nil {
+			info.PartCount = n
+		}
+	case 200:
+		// The single part of an object uploaded at once is the whole object.
+		info.Size, err = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+		if err != nil {
+			resp.Body.Close()
+			return nil, nil, errors.New("s3: cannot parse content-length")
+		}
+		info.ObjectSize = info.Size
+	default:
+		defer resp.Body.Close()
+		return nil, nil, newResponseError(resp)
+	}
+	return resp.Body, info, nil
+}
+
+// GetObjectTorrent returns the .torrent file of the object at uri, which
+// allows distributing it with BitTorrent. S3 only serves torrents of objects
+// smaller than 5GB, in buckets of the regions supporting them.
+func GetObjectTorrent(uri string, c *http.Client) (io.ReadCloser, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "https"
+	u.RawQuery = "torrent"
+
+	req, err := newRequest("GetObjectTorrent", "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := retry(retryNoBody(c, req), retries)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		return nil, newResponseError(resp)
+	}
+	return resp.Body, nil
+}
+
 // Object represents an S3 object.
 type Object struct {
 	Key          string
@@ -49,6 +320,15 @@ type Object struct {
 	StorageClass string
 	OwnerID      string `xml:"Owner>ID"`
 	OwnerName    string `xml:"Owner>DisplayName"`
+	// Owner holds OwnerID and OwnerName, it's nil when listing with
+	// WalkOptions.SkipOwner.
+	Owner *Owner `xml:"-"`
+}
+
+// Owner represents the owner of an S3 object.
+type Owner struct {
+	ID          string
+	DisplayName string
 }
 
 // SkipDir is used as a return value from WalkFuncs to indicate that
@@ -59,33 +339,149 @@ var SkipDir = errors.New("skip this directory")
 // WalkFunc is the type of the function called for each object visited by Walk.
 type WalkFunc func(name string, info os.FileInfo) error
 
+// WalkOptions configures Walk.
+type WalkOptions struct {
+	// RetryPolicy is used to retry listing requests, it defaults to
+	// aws.DefaultRetryPolicy.
+	RetryPolicy *aws.RetryPolicy
+
+	// PageDelay is the delay observed between two listing requests, it
+	// allows to pace long walks to avoid being throttled.
+	PageDelay time.Duration
+
+	// Ramp, if set, paces the listing requests, it can be shared by walks
+	// run concurrently, and with the transfers of their objects, so they
+	// ramp up together to the request rate S3 allows on the prefix.
+	Ramp *aws.Ramp
+
+	// Context, if set, cancels the listing requests and the delays
+	// between them once done.
+	Context context.Context
+
+	// SkipOwner doesn't request the owner of each object, which is
+	// returned by default.
+	SkipOwner bool
+
+	// StartAfter is the key after which the listing starts, it allows to
+	// resume an interrupted walk from the last visited key.
+	StartAfter string
+
+	// MaxKeys is the maximum number of keys returned per listing request,
+	// between 1 and 1000. It defaults to 1000.
+	MaxKeys int
+
+	// RequesterPays acknowledges that the requester pays for the requests
+	// made to the bucket.
+	RequesterPays bool
+
+	// Placeholders reports the placeholder objects of directories, the
+	// zero-byte objects with a key ending with a slash created by the S3
+	// console for folders: the entries of directories having one get its
+	// *Object as Sys. Directories are then listed before walkFn is called
+	// for them, even if it returns SkipDir. By default placeholders are
+	// skipped, their directories being reported by the listing already.
+	Placeholders bool
+}
+
+const maxKeys = 1000
+
 // Walk walks the bucket starting at prefix, calling walkFn for each object
 // in the bucket.
 func Walk(uri string, walkFn WalkFunc, client *http.Client) error {
+	return WalkWithOptions(uri, walkFn, nil, client)
+}
+
+// WalkWithOptions is like Walk but allows to configure the listing.
+func WalkWithOptions(uri string, walkFn WalkFunc, opts *WalkOptions, client *http.Client) error {
 	c := client
 	if c == nil {
 		c = DefaultClient
 	}
+	if opts == nil {
+		opts = &WalkOptions{}
+	}
+	if opts.MaxKeys < 0 || opts.MaxKeys > maxKeys {
+		return fmt.Errorf("s3: max keys must be between 1 and %d, got %d", maxKeys, opts.MaxKeys)
+	}
 	u, err := url.Parse(uri)
 	if err != nil {
 		return err
 	}
-	u.Scheme = "https"
-	path := strings.Split(u.Path, "/")
-	u.Path = strings.Join(path[:2], "/")
-	prefix := strings.Join(path[2:], "/")
-	objects, err := readObjects(u, prefix, c)
+	u, prefix, err := bucketPrefix(u)
 	if err != nil {
 		return err
 	}
-	if err := walk(u, objects, walkFn, c); err != nil {
+	w := &walker{
+		u:    u,
+		opts: opts,
+		c:    rampClient(c, opts.Ramp),
+	}
+	objects, err := w.readObjects(prefix)
+	if err != nil {
+		return err
+	}
+	_, objects = placeholder(objects, prefix)
+	if err := w.walk(objects, walkFn); err != nil {
 		return err
 	}
 	return nil
 }
 
-func walk(u *url.URL, objects []os.FileInfo, walkFn WalkFunc, c *http.Client) error {
+// PrefixSize returns the number of objects under the given prefix and their
+// total size.
+func PrefixSize(prefixURI string, c *http.Client) (objectCount int64, totalBytes int64, err error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	u, err := url.Parse(prefixURI)
+	if err != nil {
+		return 0, 0, err
+	}
+	u, prefix, err := bucketPrefix(u)
+	if err != nil {
+		return 0, 0, err
+	}
+	w := &walker{
+		u:    u,
+		opts: &WalkOptions{SkipOwner: true},
+		c:    c,
+		flat: true,
+	}
+	err = w.readPages(prefix, func(objects []os.FileInfo) error {
+		for _, o := range objects {
+			objectCount++
+			totalBytes += o.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return objectCount, totalBytes, nil
+}
+
+type walker struct {
+	u     *url.URL
+	opts  *WalkOptions
+	c     *http.Client
+	pages int
+	// flat lists all the objects under the prefix at once.
+	flat bool
+}
+
+func (w *walker) walk(objects []os.FileInfo, walkFn WalkFunc) error {
 	for _, o := range objects {
+		var (
+			d      []os.FileInfo
+			listed bool
+		)
+		if o.IsDir() && w.opts.Placeholders {
+			var err error
+			if d, err = w.readDir(o); err != nil {
+				return err
+			}
+			listed = true
+		}
 		if err := walkFn(o.Name(), o); err != nil {
 			if o.IsDir() && err == SkipDir {
 				return nil
@@ -93,11 +489,13 @@ func walk(u *url.URL, objects []os.FileInfo, walkFn WalkFunc, c *http.Client) er
 			return err
 		}
 		if o.IsDir() {
-			d, err := readObjects(u, o.Name()+"/", c)
-			if err != nil {
-				return err
+			if !listed {
+				var err error
+				if d, err = w.readDir(o); err != nil {
+					return err
+				}
 			}
-			if err := walk(u, d[1:], walkFn, c); err != nil {
+			if err := w.walk(d, walkFn); err != nil {
 				return err
 			}
 		}
@@ -105,26 +503,94 @@ func walk(u *url.URL, objects []os.FileInfo, walkFn WalkFunc, c *http.Client) er
 	return nil
 }
 
-func readObjects(u *url.URL, prefix string, c *http.Client) (objects []os.FileInfo, err error) {
+// readDir lists the objects of the directory dir, without its placeholder
+// which is set as the Sys of dir when WalkOptions.Placeholders is set.
+func (w *walker) readDir(dir os.FileInfo) ([]os.FileInfo, error) {
+	d, err := w.readObjects(dir.Name() + "/")
+	if err != nil {
+		return nil, err
+	}
+	p, d := placeholder(d, dir.Name()+"/")
+	if p != nil && w.opts.Placeholders {
+		dir.(*objectInfo).sys = p
+	}
+	return d, nil
+}
+
+// placeholder removes the placeholder object of the directory prefix from
+// the objects listed under it, if any, and returns it.
+func placeholder(objects []os.FileInfo, prefix string) (*Object, []os.FileInfo) {
+	if !strings.HasSuffix(prefix, "/") {
+		return nil, objects
+	}
+	for i, o := range objects {
+		if obj, ok := o.Sys().(*Object); ok && obj != nil && obj.Key == prefix {
+			return obj, append(objects[:i:i], objects[i+1:]...)
+		}
+	}
+	return nil, objects
+}
+
+func (w *walker) readObjects(prefix string) (objects []os.FileInfo, err error) {
+	err = w.readPages(prefix, func(page []os.FileInfo) error {
+		objects = append(objects, page...)
+		return nil
+	})
+	return objects, err
+}
+
+func (w *walker) ctx() context.Context {
+	if w.opts.Context != nil {
+		return w.opts.Context
+	}
+	return context.Background()
+}
+
+// readPages lists the objects under prefix, calling fn with the objects of
+// each page as it is received instead of holding them all.
+func (w *walker) readPages(prefix string, fn func([]os.FileInfo) error) error {
 	var completed bool
 	q := url.Values{
-		"list-type":   []string{"2"},
-		"delimiter":   []string{"/"},
-		"fetch-owner": []string{"true"},
-		"prefix":      []string{prefix},
+		"list-type": []string{"2"},
+		"prefix":    []string{prefix},
+	}
+	if !w.flat {
+		q.Set("delimiter", "/")
+	}
+	if !w.opts.SkipOwner {
+		q.Set("fetch-owner", "true")
+	}
+	if w.opts.StartAfter != "" {
+		q.Set("start-after", w.opts.StartAfter)
+	}
+	if w.opts.MaxKeys > 0 {
+		q.Set("max-keys", strconv.Itoa(w.opts.MaxKeys))
 	}
 	for !completed {
-		u.RawQuery = q.Encode()
-		req, err := http.NewRequest("GET", u.String(), nil)
+		w.u.RawQuery = q.Encode()
+		req, err := newRequestContext(w.ctx(), "ListObjectsV2", "GET", w.u.String(), nil)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		resp, err := retry(retryNoBody(c, req), retries)
+		if w.pages > 0 && w.opts.PageDelay > 0 {
+			t := time.NewTimer(w.opts.PageDelay)
+			select {
+			case <-t.C:
+			case <-req.Context().Done():
+				t.Stop()
+				return req.Context().Err()
+			}
+		}
+		w.pages++
+		if w.opts.RequesterPays {
+			setRequestPayer(req.Header)
+		}
+		resp, err := retryPolicy(w.opts.RetryPolicy, w.c, req)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if resp.StatusCode != 200 {
-			return nil, newResponseError(resp)
+			return newResponseError(resp)
 		}
 		var l struct {
 			Truncated bool     `xml:"IsTruncated"`
@@ -132,22 +598,29 @@ func readObjects(u *url.URL, prefix string, c *http.Client) (objects []os.FileIn
 			Objects   []Object `xml:"Contents"`
 			Prefixes  []string `xml:"CommonPrefixes>Prefix"`
 		}
-		if err := xml.NewDecoder(resp.Body).Decode(&l); err != nil {
+		err = xml.NewDecoder(resp.Body).Decode(&l)
+		resp.Body.Close()
+		if err != nil {
 			// A 200 OK response can contain valid or invalid XML.
 			// http://docs.aws.amazon.com/AmazonS3/latest/API/v2-RESTBucketGET.html#v2-RESTBucketGET-description
 			if err == io.EOF {
-				return nil, nil
+				return nil
 			}
-			return nil, err
+			return err
 		}
 
 		// Stop iteration if needed.
 		completed = !l.Truncated
 		// Or continues it.
 		q.Set("continuation-token", l.Token)
-		for _, c := range l.Objects {
+		objects := make([]os.FileInfo, 0, len(l.Objects)+len(l.Prefixes))
+		for i := range l.Objects {
+			c := l.Objects[i]
 			// Parse ETag properly
 			c.ETag = c.ETag[1 : len(c.ETag)-1]
+			if c.OwnerID != "" || c.OwnerName != "" {
+				c.Owner = &Owner{ID: c.OwnerID, DisplayName: c.OwnerName}
+			}
 
 			size, _ := strconv.ParseInt(c.Size, 10, 0)
 			name, dir := c.Key, false
@@ -170,33 +643,177 @@ func readObjects(u *url.URL, prefix string, c *http.Client) (objects []os.FileIn
 				dir:  true,
 			})
 		}
+		if err := fn(objects); err != nil {
+			return err
+		}
 	}
-	return objects, nil
+	return nil
 }
 
-// Remove removes the given object.
+// Remove removes the given object. Use DeleteWithOptions to remove objects
+// of requester pays buckets.
 func Remove(uri string, c *http.Client) error {
+	_, err := Delete(uri, c)
+	return err
+}
+
+// DeleteResult describes the outcome of Delete.
+type DeleteResult struct {
+	// DeleteMarker reports whether a delete marker was involved, on
+	// versioned buckets S3 creates one instead of removing the data unless
+	// a version is deleted.
+	DeleteMarker bool
+
+	// VersionID is the version of the delete marker created, or the
+	// version deleted.
+	VersionID string
+}
+
+// DeleteOptions configures a delete.
+type DeleteOptions struct {
+	// IfMatch only deletes the object if its ETag is the given one, an
+	// error for which IsPreconditionFailed reports true is returned
+	// otherwise. It avoids deleting an object which changed since it was
+	// last read.
+	IfMatch string
+
+	// RequesterPays acknowledges that the requester pays for the requests
+	// made to the bucket.
+	RequesterPays bool
+}
+
+// Delete deletes the given object, see DeleteResult for versioned buckets.
+func Delete(uri string, c *http.Client) (*DeleteResult, error) {
+	return DeleteWithOptions(uri, nil, c)
+}
+
+// DeleteWithOptions is like Delete but allows to configure the delete.
+func DeleteWithOptions(uri string, opts *DeleteOptions, c *http.Client) (*DeleteResult, error) {
 	if c == nil {
 		c = DefaultClient
 	}
+	if opts == nil {
+		opts = &DeleteOptions{}
+	}
 
 	u, err := url.Parse(uri)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	u.Scheme = "https"
 
-	req, err := http.NewRequest("DELETE", u.String(), nil)
+	req, err := newRequest("DeleteObject", "DELETE", u.String(), nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if opts.IfMatch != "" {
+		req.Header.Set("If-Match", `"`+strings.Trim(opts.IfMatch, `"`)+`"`)
+	}
+	if opts.RequesterPays {
+		setRequestPayer(req.Header)
 	}
 	resp, err := retry(retryNoBody(c, req), retries)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 204 {
-		return newResponseError(resp)
+		return nil, newResponseError(resp)
 	}
-	return nil
+	return &DeleteResult{
+		DeleteMarker: resp.Header.Get("X-Amz-Delete-Marker") == "true",
+		VersionID:    resp.Header.Get("X-Amz-Version-Id"),
+	}, nil
+}
+
+// maxDeleteObjects is the maximum number of objects of a DeleteObjects
+// request.
+const maxDeleteObjects = 1000
+
+// ObjectIdentifier identifies an object, or one of its versions.
+type ObjectIdentifier struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+}
+
+// DeleteError describes an object DeleteObjects failed to delete.
+type DeleteError struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+}
+
+func (e *DeleteError) Error() string {
+	return fmt.Sprintf("s3: cannot delete %s: (%s) %s", e.Key, e.Code, e.Message)
+}
+
+type deleteRequest struct {
+	XMLName xml.Name           `xml:"http://s3.amazonaws.com/doc/2006-03-01/ Delete"`
+	Quiet   bool               `xml:"Quiet"`
+	Objects []ObjectIdentifier `xml:"Object"`
+}
+
+// DeleteObjects deletes up to 1000 objects of the bucket at bucketURL in a
+// single request. The objects which couldn't be deleted are returned.
+func DeleteObjects(bucketURL string, objects []ObjectIdentifier, c *http.Client) ([]DeleteError, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	if len(objects) > maxDeleteObjects {
+		return nil, fmt.Errorf("s3: cannot delete more than %d objects at once, got %d", maxDeleteObjects, len(objects))
+	}
+
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "https"
+	u.RawQuery = "delete"
+
+	body, err := xml.Marshal(&deleteRequest{
+		Quiet:   true,
+		Objects: objects,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Multi-object deletes require a Content-MD5.
+	sum := md5.Sum(body)
+	b := bytes.NewReader(body)
+	resp, err := retry(func() (*http.Response, error) {
+		if _, err := b.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		req, err := newRequest("DeleteObjects", "POST", u.String(), b)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == 500 {
+			return nil, newResponseError(resp)
+		}
+		return resp, nil
+	}, retries)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, newResponseError(resp)
+	}
+	var result struct {
+		Errors []DeleteError `xml:"Error"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return result.Errors, nil
 }
@@ -2,11 +2,21 @@ package s3
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"testing/quick"
+	"time"
+
+	"github.com/cyberdelia/aws"
+	"github.com/cyberdelia/aws/awstest"
 )
 
 func roundTrip(name string, payload []byte) bool {
@@ -19,10 +29,13 @@ func roundTrip(name string, payload []byte) bool {
 	if err != nil {
 		return false
 	}
+	defer w.Close()
 	if _, err := w.Write(payload); err != nil {
 		return false
 	}
-	w.Close()
+	if _, err := w.Complete(); err != nil {
+		return false
+	}
 
 	r, _, err := Open(uri, nil)
 	if err != nil {
@@ -68,3 +81,676 @@ func ExampleRemove() {
 		return
 	}
 }
+
+func TestWalkRetry(t *testing.T) {
+	f, ts := newFakeS3(t)
+	keys := []string{"a.txt", "b.txt", "c.txt"}
+	for _, k := range keys {
+		f.put("/bucket/"+k, []byte(k))
+	}
+	var throttled bool
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if !throttled {
+			throttled = true
+			w.Header().Set("Retry-After", "0")
+			writeError(w, 503, "SlowDown")
+			return true
+		}
+		return false
+	}
+	var walked []string
+	walkFn := func(name string, info os.FileInfo) error {
+		walked = append(walked, name)
+		return nil
+	}
+	opts := &WalkOptions{
+		RetryPolicy: &aws.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond},
+		PageDelay:   time.Millisecond,
+	}
+	if err := WalkWithOptions(uri(ts, "/bucket/"), walkFn, opts, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(walked, keys) {
+		t.Errorf("expected %v, got %v", keys, walked)
+	}
+	if n := len(f.recorded()); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestWalkRamp(t *testing.T) {
+	f, ts := newFakeS3(t)
+	for _, k := range []string{"a.txt", "b.txt", "c.txt"} {
+		f.put("/bucket/"+k, []byte(k))
+	}
+	var throttled bool
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if !throttled {
+			throttled = true
+			writeError(w, 503, "SlowDown")
+			return true
+		}
+		return false
+	}
+	c := &http.Client{
+		Transport: &aws.Transport{
+			Signer:      aws.AnonymousSigner{},
+			Transport:   ts.Client().Transport,
+			RetryPolicy: &aws.RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond},
+		},
+	}
+	ramp := aws.NewRamp(4, 4)
+	opts := &WalkOptions{
+		RetryPolicy: &aws.RetryPolicy{MaxAttempts: 1},
+		Ramp:        ramp,
+	}
+	walkFn := func(name string, info os.FileInfo) error { return nil }
+	if err := WalkWithOptions(uri(ts, "/bucket/"), walkFn, opts, c); err != nil {
+		t.Fatal(err)
+	}
+	// The throttled attempt, retried by the transport, lowers the limit.
+	if n := ramp.Limit(); n != 2 {
+		t.Errorf("expected the ramp to be halved, got a limit of %d", n)
+	}
+}
+
+func TestWalkPageDelayCanceled(t *testing.T) {
+	f, ts := newFakeS3(t)
+	for _, k := range []string{"a.txt", "b.txt"} {
+		f.put("/bucket/"+k, []byte(k))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := &WalkOptions{
+		MaxKeys:   1,
+		PageDelay: time.Hour,
+		Context:   ctx,
+	}
+	walkFn := func(name string, info os.FileInfo) error { return nil }
+	done := make(chan error, 1)
+	go func() {
+		done <- WalkWithOptions(uri(ts, "/bucket/"), walkFn, opts, ts.Client())
+	}()
+	for len(f.recorded()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("expected the walk to be canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the page delay to be interrupted")
+	}
+	if n := len(f.recorded()); n != 1 {
+		t.Errorf("expected a single request, got %d", n)
+	}
+}
+
+func TestWalkRetryExhausted(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		writeError(w, 503, "SlowDown")
+		return true
+	}
+	opts := &WalkOptions{
+		RetryPolicy: &aws.RetryPolicy{MaxAttempts: 2},
+	}
+	walkFn := func(name string, info os.FileInfo) error { return nil }
+	if err := WalkWithOptions(uri(ts, "/bucket/"), walkFn, opts, ts.Client()); err == nil {
+		t.Error("expected walk to fail")
+	}
+	if n := len(f.recorded()); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestWalkSkipOwner(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		f, ts := newFakeS3(t)
+		f.put("/bucket/a.txt", []byte("a"))
+		f.put("/bucket/b.txt", []byte("b"))
+		var objects []*Object
+		walkFn := func(name string, info os.FileInfo) error {
+			objects = append(objects, info.Sys().(*Object))
+			return nil
+		}
+		opts := &WalkOptions{SkipOwner: skip}
+		if err := WalkWithOptions(uri(ts, "/bucket/"), walkFn, opts, ts.Client()); err != nil {
+			t.Fatal(err)
+		}
+		u := f.recorded()[0].URL
+		if strings.Contains(u, "fetch-owner=true") == skip {
+			t.Errorf("unexpected query %q", u)
+		}
+		for _, o := range objects {
+			if !skip && (o.Owner == nil || *o.Owner != Owner{ID: "owner-id", DisplayName: "owner"} || o.OwnerID != "owner-id" || o.OwnerName != "owner") {
+				t.Errorf("unexpected owner %v %q %q", o.Owner, o.OwnerID, o.OwnerName)
+			}
+			if skip && (o.Owner != nil || o.OwnerID != "") {
+				t.Errorf("expected no owner, got %v", o.Owner)
+			}
+		}
+	}
+}
+
+func TestWalkPlaceholders(t *testing.T) {
+	f, ts := newFakeS3(t)
+	for _, k := range []string{"docs/", "docs/a.txt", "docs/b.txt", "empty/", "src/main.go", "src/util.go", "top.txt"} {
+		f.put("/bucket/"+k, []byte{})
+	}
+	for _, placeholders := range []bool{false, true} {
+		var visited []string
+		withPlaceholder := make(map[string]bool)
+		walkFn := func(name string, info os.FileInfo) error {
+			if info.IsDir() {
+				name += "/"
+				if o, ok := info.Sys().(*Object); ok && o != nil {
+					withPlaceholder[name] = true
+				}
+			}
+			visited = append(visited, name)
+			return nil
+		}
+		opts := &WalkOptions{Placeholders: placeholders}
+		if err := WalkWithOptions(uri(ts, "/bucket/"), walkFn, opts, ts.Client()); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"top.txt", "docs/", "docs/a.txt", "docs/b.txt", "empty/", "src/", "src/main.go", "src/util.go"}
+		if !reflect.DeepEqual(visited, expected) {
+			t.Errorf("(%t) expected %v, got %v", placeholders, expected, visited)
+		}
+		if placeholders && !reflect.DeepEqual(withPlaceholder, map[string]bool{"docs/": true, "empty/": true}) {
+			t.Errorf("expected placeholders to be reported, got %v", withPlaceholder)
+		}
+		if !placeholders && len(withPlaceholder) > 0 {
+			t.Errorf("expected placeholders to be skipped, got %v", withPlaceholder)
+		}
+	}
+}
+
+func TestWalkStartAfter(t *testing.T) {
+	f, ts := newFakeS3(t)
+	for _, k := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		f.put("/bucket/"+k, []byte(k))
+	}
+	var walked []string
+	walkFn := func(name string, info os.FileInfo) error {
+		walked = append(walked, name)
+		return nil
+	}
+	opts := &WalkOptions{StartAfter: "b.txt"}
+	if err := WalkWithOptions(uri(ts, "/bucket/"), walkFn, opts, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"c.txt", "d.txt"}; !reflect.DeepEqual(walked, expected) {
+		t.Errorf("expected %v, got %v", expected, walked)
+	}
+	if u := f.recorded()[0].URL; !strings.Contains(u, "start-after=b.txt") {
+		t.Errorf("unexpected query %q", u)
+	}
+}
+
+func TestWalkMaxKeys(t *testing.T) {
+	f, ts := newFakeS3(t)
+	keys := []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"}
+	for _, k := range keys {
+		f.put("/bucket/"+k, []byte(k))
+	}
+	var walked []string
+	walkFn := func(name string, info os.FileInfo) error {
+		walked = append(walked, name)
+		return nil
+	}
+	opts := &WalkOptions{MaxKeys: 2}
+	if err := WalkWithOptions(uri(ts, "/bucket/"), walkFn, opts, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(walked, keys) {
+		t.Errorf("expected %v, got %v", keys, walked)
+	}
+	requests := f.recorded()
+	if len(requests) != 3 {
+		t.Errorf("expected 3 pages, got %d", len(requests))
+	}
+	for _, r := range requests {
+		if !strings.Contains(r.URL, "max-keys=2") {
+			t.Errorf("unexpected query %q", r.URL)
+		}
+	}
+
+	for _, n := range []int{-1, 1001} {
+		if err := WalkWithOptions(uri(ts, "/bucket/"), walkFn, &WalkOptions{MaxKeys: n}, ts.Client()); err == nil {
+			t.Errorf("expected max keys %d to be rejected", n)
+		}
+	}
+}
+
+func TestWalkVirtualHosted(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/data/a.txt", []byte("a"))
+	f.put("/bucket/data/b.txt", []byte("b"))
+	f.put("/bucket/other.txt", []byte("other"))
+	prefix, _, _, err := ParseS3URI("s3://bucket/data/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var walked []string
+	walkFn := func(name string, info os.FileInfo) error {
+		walked = append(walked, name)
+		return nil
+	}
+	if err := Walk(prefix, walkFn, virtualHosted(ts)); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"data/a.txt", "data/b.txt"}; !reflect.DeepEqual(walked, expected) {
+		t.Errorf("expected %v, got %v", expected, walked)
+	}
+
+	bucket, _, _, err := ParseS3URI("s3://bucket", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	walked = nil
+	if err := Walk(bucket, walkFn, virtualHosted(ts)); err != nil {
+		t.Fatal(err)
+	}
+	if len(walked) != 4 {
+		t.Errorf("expected the whole bucket to be walked, got %v", walked)
+	}
+	if err := Walk("s3://"+ts.Listener.Addr().String(), walkFn, ts.Client()); err == nil {
+		t.Error("expected an URI without bucket to fail")
+	}
+}
+
+func TestDeleteObjects(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/a.txt", []byte("a"))
+	f.put("/bucket/b.txt", []byte("b"))
+
+	errs, err := DeleteObjects(uri(ts, "/bucket"), []ObjectIdentifier{
+		{Key: "a.txt"}, {Key: "b.txt"}, {Key: "missing.txt"},
+	}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Key != "missing.txt" || errs[0].Code != "NoSuchKey" {
+		t.Errorf("unexpected errors %+v", errs)
+	}
+	for _, k := range []string{"/bucket/a.txt", "/bucket/b.txt"} {
+		if _, ok := f.get(k); ok {
+			t.Errorf("expected %s to be deleted", k)
+		}
+	}
+	if _, err := DeleteObjects(uri(ts, "/bucket"), make([]ObjectIdentifier, 1001), ts.Client()); err == nil {
+		t.Error("expected an error for too many objects")
+	}
+}
+
+func TestIsMultipartETag(t *testing.T) {
+	var tests = []struct {
+		ETag      string
+		Multipart bool
+		Parts     int
+	}{
+		{"d41d8cd98f00b204e9800998ecf8427e", false, 0},
+		{`"d41d8cd98f00b204e9800998ecf8427e"`, false, 0},
+		{"d41d8cd98f00b204e9800998ecf8427e-3", true, 3},
+		{`"d41d8cd98f00b204e9800998ecf8427e-12"`, true, 12},
+		{"d41d8cd98f00b204e9800998ecf8427e-", false, 0},
+	}
+	for _, test := range tests {
+		if m := IsMultipartETag(test.ETag); m != test.Multipart {
+			t.Errorf("%s: expected multipart to be %t", test.ETag, test.Multipart)
+		}
+		info, err := newObjectInfo(http.Header{"Content-Length": {"0"}, "Etag": {test.ETag}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.PartCount != test.Parts {
+			t.Errorf("%s: expected %d parts, got %d", test.ETag, test.Parts, info.PartCount)
+		}
+	}
+	info, _ := newObjectInfo(http.Header{
+		"Content-Length":       {"0"},
+		"Etag":                 {"d41d8cd98f00b204e9800998ecf8427e-3"},
+		"X-Amz-Mp-Parts-Count": {"4"},
+	})
+	if info.PartCount != 4 {
+		t.Errorf("expected the parts count header to be used, got %d", info.PartCount)
+	}
+}
+
+func TestPrefixSize(t *testing.T) {
+	f, ts := newFakeS3(t)
+	var size int64
+	for i := 0; i < 1500; i++ {
+		b := []byte(strconv.Itoa(i))
+		f.put(fmt.Sprintf("/bucket/logs/%d/%d.log", i%3, i), b)
+		size += int64(len(b))
+	}
+	f.put("/bucket/other.txt", []byte("other"))
+
+	count, total, err := PrefixSize(uri(ts, "/bucket/logs/"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1500 || total != size {
+		t.Errorf("expected 1500 objects of %d bytes, got %d objects of %d bytes", size, count, total)
+	}
+	if n := len(f.recorded()); n != 2 {
+		t.Errorf("expected 2 pages, got %d", n)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/file.txt", []byte("hello"))
+
+	res, err := Delete(uri(ts, "/bucket/file.txt"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DeleteMarker || res.VersionID != "" {
+		t.Errorf("expected no delete marker, got %+v", res)
+	}
+
+	// Versioned buckets create a delete marker.
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set("X-Amz-Delete-Marker", "true")
+		w.Header().Set("X-Amz-Version-Id", "3HL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY")
+		w.WriteHeader(204)
+		return true
+	}
+	res, err = Delete(uri(ts, "/bucket/file.txt"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &DeleteResult{DeleteMarker: true, VersionID: "3HL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %+v, got %+v", expected, res)
+	}
+}
+
+func TestDeleteIfMatch(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/file.txt", []byte("hello"))
+
+	_, err := DeleteWithOptions(uri(ts, "/bucket/file.txt"), &DeleteOptions{IfMatch: "d41d8cd98f00b204e9800998ecf8427e"}, ts.Client())
+	if !IsPreconditionFailed(err) {
+		t.Errorf("expected a precondition failed error, got %v", err)
+	}
+	if _, ok := f.get("/bucket/file.txt"); !ok {
+		t.Fatal("expected the object not to be deleted")
+	}
+	if _, err := DeleteWithOptions(uri(ts, "/bucket/file.txt"), &DeleteOptions{IfMatch: "5d41402abc4b2a76b9719d911017c592"}, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.get("/bucket/file.txt"); ok {
+		t.Error("expected the object to be deleted")
+	}
+	if m := f.recorded()[1].Header.Get("If-Match"); m != `"5d41402abc4b2a76b9719d911017c592"` {
+		t.Errorf("unexpected If-Match %q", m)
+	}
+}
+
+func TestSpecialKeys(t *testing.T) {
+	var tests = []struct {
+		Key     string
+		Escaped string
+	}{
+		{"my folder/a+b#c.txt", "my%20folder/a%2Bb%23c.txt"},
+		{"what?.txt", "what%3F.txt"},
+		{"100%.txt", "100%25.txt"},
+		{"a&b=c;d,e:f@g$h.txt", "a%26b%3Dc%3Bd%2Ce%3Af%40g%24h.txt"},
+		{"日本/café.txt", "%E6%97%A5%E6%9C%AC/caf%C3%A9.txt"},
+		{"tilde~dash-under_score.txt", "tilde~dash-under_score.txt"},
+		{"<xml>&'quotes\".txt", "%3Cxml%3E%26%27quotes%22.txt"},
+		{"double//slash.txt", "double//slash.txt"},
+	}
+	for _, test := range tests {
+		// Keys are sent as canonicalized when signing, whichever encoding
+		// the URL uses.
+		req, err := newRequest("GetObject", "GET", (&url.URL{Scheme: "https", Host: "s3.amazonaws.com", Path: "/bucket/" + test.Key}).String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := req.URL.RequestURI(); p != "/bucket/"+test.Escaped {
+			t.Errorf("%s: expected path %s, got %s", test.Key, test.Escaped, p)
+		}
+
+		f, ts := newFakeS3(t)
+		// Requests are signed, the signer canonicalizes the keys too.
+		c := &http.Client{
+			Transport: &aws.Transport{
+				Signer:    awstest.Signer("s3"),
+				Transport: ts.Client().Transport,
+			},
+		}
+		u := uri(ts, "/bucket/"+test.Escaped)
+		if _, err := Presign(u, &PresignOptions{Signer: awstest.Signer("s3")}); err != nil {
+			t.Errorf("%s: %v", test.Key, err)
+		}
+		if _, err := Put(u, strings.NewReader("content"), nil, c); err != nil {
+			t.Fatalf("%s: %v", test.Key, err)
+		}
+		if _, ok := f.get("/bucket/" + test.Key); !ok {
+			t.Fatalf("%s: expected object to be stored under its key", test.Key)
+		}
+		if r := f.recorded()[0]; r.URL != "/bucket/"+test.Escaped {
+			t.Errorf("%s: expected key to be sent as %s, got %s", test.Key, test.Escaped, r.URL)
+		}
+		if _, err := Stat(u, c); err != nil {
+			t.Errorf("%s: %v", test.Key, err)
+		}
+		r, _, err := Open(u, c)
+		if err != nil {
+			t.Fatalf("%s: %v", test.Key, err)
+		}
+		b, _ := ioutil.ReadAll(r)
+		r.Close()
+		if string(b) != "content" {
+			t.Errorf("%s: unexpected content %q", test.Key, b)
+		}
+		if _, err := Copy(u, u+".copy", nil, c); err != nil {
+			t.Errorf("%s: %v", test.Key, err)
+		}
+		if _, ok := f.get("/bucket/" + test.Key + ".copy"); !ok {
+			t.Errorf("%s: expected object to be copied", test.Key)
+		}
+		var walked []string
+		walkFn := func(name string, info os.FileInfo) error {
+			if !info.IsDir() {
+				walked = append(walked, name)
+			}
+			return nil
+		}
+		dir := ""
+		if i := strings.LastIndex(test.Escaped, "/"); i >= 0 {
+			dir = test.Escaped[:i+1]
+		}
+		if err := Walk(uri(ts, "/bucket/"+dir), walkFn, c); err != nil {
+			t.Fatalf("%s: %v", test.Key, err)
+		}
+		if expected := []string{test.Key, test.Key + ".copy"}; !reflect.DeepEqual(walked, expected) {
+			t.Errorf("expected %q, got %q", expected, walked)
+		}
+		if err := Remove(u, c); err != nil {
+			t.Errorf("%s: %v", test.Key, err)
+		}
+		if _, ok := f.get("/bucket/" + test.Key); ok {
+			t.Errorf("%s: expected object to be deleted", test.Key)
+		}
+		for _, r := range f.recorded() {
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+				t.Errorf("%s: expected %s %s to be signed", test.Key, r.Method, r.URL)
+			}
+		}
+	}
+}
+
+func TestGetObjectTorrent(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/file.bin", []byte("content"))
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if _, ok := r.URL.Query()["torrent"]; !ok {
+			return false
+		}
+		if _, ok := f.get(r.URL.Path); !ok {
+			writeError(w, 404, "NoSuchKey")
+			return true
+		}
+		w.Header().Set("Content-Type", "application/x-bittorrent")
+		w.Write([]byte("d8:announce0:e"))
+		return true
+	}
+	signer := awstest.Signer("s3")
+	c := &http.Client{Transport: &aws.Transport{Signer: signer, Transport: ts.Client().Transport}}
+	r, err := GetObjectTorrent(uri(ts, "/bucket/file.bin"), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if b, _ := ioutil.ReadAll(r); string(b) != "d8:announce0:e" {
+		t.Errorf("unexpected torrent %q", b)
+	}
+
+	// The signature covers the subresource, as verified by S3.
+	sent := f.recorded()[0]
+	if !strings.HasSuffix(sent.URL, "/bucket/file.bin?torrent=") {
+		t.Errorf("expected the torrent subresource, got %s", sent.URL)
+	}
+	req, _ := http.NewRequest("GET", "https://"+ts.Listener.Addr().String()+sent.URL, nil)
+	for _, h := range []string{"X-Amz-Date", "X-Amz-Content-Sha256"} {
+		req.Header.Set(h, sent.Header.Get(h))
+	}
+	signer.Sign(req)
+	if a := req.Header.Get("Authorization"); a != sent.Header.Get("Authorization") {
+		t.Errorf("expected signature %q, got %q", a, sent.Header.Get("Authorization"))
+	}
+	req.URL.RawQuery = ""
+	signer.Sign(req)
+	if a := req.Header.Get("Authorization"); a == sent.Header.Get("Authorization") {
+		t.Error("expected the subresource to be signed")
+	}
+
+	if _, err := GetObjectTorrent(uri(ts, "/bucket/missing.bin"), ts.Client()); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/image.png", []byte("\x89PNG\r\n\x1a\n and the rest of the image"))
+	f.meta["/bucket/image.png"] = http.Header{"Content-Type": {"image/png"}}
+	f.put("/bucket/empty", []byte{})
+
+	b, info, err := Peek(uri(ts, "/bucket/image.png"), 8, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "\x89PNG\r\n\x1a\n" {
+		t.Errorf("unexpected prefix %q", b)
+	}
+	if info.Size != 34 || info.ContentType != "image/png" || info.LastModified.IsZero() || info.ETag == "" {
+		t.Errorf("unexpected info %+v", info)
+	}
+	if r := f.recorded(); len(r) != 1 || r[0].Method != "GET" || r[0].Header.Get("Range") != "bytes=0-7" {
+		t.Errorf("expected a single ranged GET, got %+v", r)
+	}
+
+	b, info, err = Peek(uri(ts, "/bucket/image.png"), 1024, ts.Client())
+	if err != nil || len(b) != 34 || info.Size != 34 {
+		t.Errorf("expected the whole object, got %q (%v)", b, err)
+	}
+	b, info, err = Peek(uri(ts, "/bucket/empty"), 8, ts.Client())
+	if err != nil || len(b) != 0 || info.Size != 0 {
+		t.Errorf("expected an empty object, got %q (%v)", b, err)
+	}
+	if _, _, err := Peek(uri(ts, "/bucket/missing"), 8, ts.Client()); !IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestStatSystemMetadata(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/file.txt", []byte("hello"))
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set("X-Amz-Replication-Status", "COMPLETED")
+		w.Header().Set("X-Amz-Server-Side-Encryption", "aws:kms")
+		w.Header().Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", "arn:aws:kms:us-east-1:123456789012:key/example")
+		return false
+	}
+
+	info, err := Stat(uri(ts, "/bucket/file.txt"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ReplicationStatus != "COMPLETED" {
+		t.Errorf("unexpected replication status %q", info.ReplicationStatus)
+	}
+	if info.ServerSideEncryption != "aws:kms" {
+		t.Errorf("unexpected encryption %q", info.ServerSideEncryption)
+	}
+	if info.KMSKeyID != "arn:aws:kms:us-east-1:123456789012:key/example" {
+		t.Errorf("unexpected key %q", info.KMSKeyID)
+	}
+}
+
+func TestGetPart(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/single.txt", []byte("hello"))
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/bucket/multi.bin" {
+			return false
+		}
+		if n := r.URL.Query().Get("partNumber"); n != "2" {
+			t.Errorf("unexpected part number %q", n)
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e-3"`)
+		w.Header().Set("Content-Range", "bytes 5242880-10485759/12582912")
+		w.Header().Set("X-Amz-Mp-Parts-Count", "3")
+		w.WriteHeader(206)
+		w.Write([]byte("part"))
+		return true
+	}
+
+	r, info, err := GetPart(uri(ts, "/bucket/multi.bin"), 2, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	expected := &PartInfo{
+		PartNumber: 2,
+		Offset:     5242880,
+		Size:       5242880,
+		ObjectSize: 12582912,
+		PartCount:  3,
+		ETag:       "d41d8cd98f00b204e9800998ecf8427e-3",
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("unexpected part info %+v", info)
+	}
+	if b, _ := ioutil.ReadAll(r); string(b) != "part" {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	r, info, err = GetPart(uri(ts, "/bucket/single.txt"), 1, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if info.Size != 5 || info.ObjectSize != 5 || info.PartCount != 1 {
+		t.Errorf("unexpected part info %+v", info)
+	}
+	if u := f.recorded()[1].URL; u != "/bucket/single.txt?partNumber=1" {
+		t.Errorf("unexpected url %q", u)
+	}
+
+	if _, _, err := GetPart(uri(ts, "/bucket/missing.bin"), 1, ts.Client()); !IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if _, _, err := GetPart(uri(ts, "/bucket/multi.bin"), 0, ts.Client()); err == nil {
+		t.Error("expected an invalid part number error")
+	}
+}
@@ -0,0 +1,182 @@
+package s3
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cyberdelia/aws"
+)
+
+// Bounds of the validity of presigned URLs.
+const (
+	DefaultPresignExpires = 15 * time.Minute
+	MaxPresignExpires     = 7 * 24 * time.Hour
+)
+
+// PresignOptions configures a presigned URL.
+type PresignOptions struct {
+	// Method is the method of the presigned request, GET by default.
+	Method string
+
+	// Expires is how long the URL stays valid, DefaultPresignExpires by
+	// default.
+	Expires time.Duration
+
+	// ExtraQuery holds query parameters added to the URL, they are part of
+	// the signature and can't be altered by the URL holder.
+	ExtraQuery url.Values
+
+	// ResponseContentType, ResponseContentDisposition and
+	// ResponseCacheControl override the headers of the response to a
+	// presigned GET, e.g. an attachment disposition makes browsers download
+	// the object under the given filename.
+	ResponseContentType        string
+	ResponseContentDisposition string
+	ResponseCacheControl       string
+
+	// Signer signs the URL, DefaultSigner by default.
+	Signer *aws.V4Signer
+}
+
+// Presign returns a URL granting access to the S3 object at uri without
+// credentials until it expires.
+func Presign(uri string, opts *PresignOptions) (string, error) {
+	if opts == nil {
+		opts = &PresignOptions{}
+	}
+	signer := opts.Signer
+	if signer == nil {
+		signer = DefaultSigner
+	}
+	method := opts.Method
+	if method == "" {
+		method = "GET"
+	}
+	expires := opts.Expires
+	if expires == 0 {
+		expires = DefaultPresignExpires
+	}
+	if expires < time.Second || expires > MaxPresignExpires {
+		return "", errors.New("s3: presigned URLs expire between 1 second and 7 days")
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = "https"
+	addQuery(u, opts.ExtraQuery)
+	addQuery(u, opts.responseQuery())
+
+	req, err := newRequest("Presign", method, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if err := signer.Presign(req, expires); err != nil {
+		return "", err
+	}
+	return req.URL.String(), nil
+}
+
+func (opts *PresignOptions) responseQuery() url.Values {
+	q := make(url.Values)
+	for k, v := range map[string]string{
+		"response-content-type":        opts.ResponseContentType,
+		"response-content-disposition": opts.ResponseContentDisposition,
+		"response-cache-control":       opts.ResponseCacheControl,
+	} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	return q
+}
+
+// BuildOptions configures BuildRequest.
+type BuildOptions struct {
+	// Header holds headers sent with the request, they are signed.
+	Header http.Header
+
+	// Body is the body of the request, its length must be known as
+	// described by Put, so its payload can be signed.
+	Body io.Reader
+
+	// ExtraQuery holds query parameters added to the URL of the request,
+	// they are signed.
+	ExtraQuery url.Values
+
+	// Signer signs the request, DefaultSigner by default.
+	Signer aws.Signer
+
+	// Operation is the API operation of the request, as reported to the
+	// Collector of a Transport. It defaults to the object operation of the
+	// method, such as GetObject for GET.
+	Operation string
+}
+
+// objectOperations are the operations on objects of each method.
+var objectOperations = map[string]string{
+	"GET":    "GetObject",
+	"HEAD":   "HeadObject",
+	"PUT":    "PutObject",
+	"DELETE": "DeleteObject",
+}
+
+// BuildRequest returns the signed request for the given method and S3 object
+// at uri, without sending it, so it can be inspected or sent through other
+// means, such as a proxy. The request must be sent before its signature
+// expires, 15 minutes after it was built.
+func BuildRequest(method, uri string, opts *BuildOptions) (*http.Request, error) {
+	if opts == nil {
+		opts = &BuildOptions{}
+	}
+	var signer aws.Signer = DefaultSigner
+	if opts.Signer != nil {
+		signer = opts.Signer
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "https"
+	addQuery(u, opts.ExtraQuery)
+
+	var body *io.SectionReader
+	if opts.Body != nil {
+		if body, err = sizedBody(opts.Body); err != nil {
+			return nil, err
+		}
+		if body == nil {
+			return nil, ErrUnknownLength
+		}
+	}
+	op := opts.Operation
+	if op == "" {
+		op = objectOperations[method]
+	}
+	req, err := newRequest(op, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case body == nil:
+	case body.Size() == 0:
+		req.Body = http.NoBody
+		req.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+	default:
+		req.Body = ioutil.NopCloser(io.NewSectionReader(body, 0, body.Size()))
+		req.ContentLength = body.Size()
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(io.NewSectionReader(body, 0, body.Size())), nil
+		}
+	}
+	copyHeader(req.Header, opts.Header)
+	if err := aws.SignRequest(signer, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
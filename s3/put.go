@@ -0,0 +1,208 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/cyberdelia/aws"
+)
+
+// ErrUnknownLength is returned by Put when the length of the body can't be
+// determined.
+var ErrUnknownLength = errors.New("s3: unknown body length, S3 doesn't accept chunked uploads")
+
+// Put uploads body to an S3 object at uri in a single request, which saves
+// the round trips of a multipart upload for small objects. Objects can't be
+// bigger than 5GB.
+//
+// The length of body is determined beforehand when it is an io.ReaderAt and
+// an io.Seeker, like *os.File or *bytes.Reader, or a *bytes.Buffer, so the
+// request is sent with a Content-Length and can be retried. S3 rejects
+// chunked uploads, ErrUnknownLength is returned for other bodies unless
+// UploadOptions.SpillToDisk is set, they can also be uploaded with Create.
+//
+// The body is sent with its Content-MD5, so S3 rejects it if it was corrupted
+// in transit, unless UploadOptions.DisableContentMD5 is set.
+func Put(uri string, body io.Reader, opts *UploadOptions, c *http.Client) (UploadResult, error) {
+	u := &Uploader{Client: c, Options: opts}
+	return u.Put(uri, body)
+}
+
+func put(uri string, body io.Reader, opts *UploadOptions, c *http.Client) (UploadResult, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	h, common, skipped, err := uploadHeaders(uri, opts, c)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if skipped != nil {
+		return *skipped, nil
+	}
+	copyHeader(h, common)
+	h.Del("X-Amz-Checksum-Algorithm")
+	if opts.CreateIfAbsent {
+		h.Set("If-None-Match", "*")
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	u.Scheme = "https"
+
+	r, err := sizedBody(body)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if r == nil {
+		if !opts.SpillToDisk {
+			return UploadResult{}, ErrUnknownLength
+		}
+		f, err := spill(body, maxPartSize)
+		if err != nil {
+			return UploadResult{}, err
+		}
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+		if r, err = sizedBody(f); err != nil {
+			return UploadResult{}, err
+		}
+	}
+	if p := opts.Preflight; p != nil && p.MaxSize > 0 && r.Size() > p.MaxSize {
+		return UploadResult{}, &ObjectTooLargeError{Size: r.Size(), MaxSize: p.MaxSize}
+	}
+	if r.Size() > maxPartSize {
+		return UploadResult{}, fmt.Errorf("s3: objects uploaded with Put can't be bigger than %d bytes", int64(maxPartSize))
+	}
+	var sum []byte
+	if !opts.DisableContentMD5 {
+		m := md5.New()
+		if _, err := io.Copy(m, io.NewSectionReader(r, 0, r.Size())); err != nil {
+			return UploadResult{}, err
+		}
+		sum = m.Sum(nil)
+	}
+
+	resp, err := retry(func() (*http.Response, error) {
+		req, err := newRequest("PutObject", "PUT", u.String(), io.NewSectionReader(r, 0, r.Size()))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = r.Size()
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(io.NewSectionReader(r, 0, r.Size())), nil
+		}
+		copyHeader(req.Header, h)
+		if sum != nil {
+			req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum))
+		}
+		if opts.ExpectContinue {
+			req.Header.Set("Expect", "100-continue")
+		}
+		if opts.ChecksumAlgorithm != "" {
+			if _, err := aws.SetUnsignedTrailer(req, opts.ChecksumAlgorithm); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == 500 {
+			return nil, newResponseError(resp)
+		}
+		return resp, nil
+	}, retries)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	result, err := putResult(resp, opts.CreateIfAbsent)
+	if err != nil {
+		return result, err
+	}
+	if eTag := hex.EncodeToString(sum); sum != nil && result.ETag != eTag {
+		return UploadResult{}, fmt.Errorf("s3: mismatching checksum: %q != %q", result.ETag, eTag)
+	}
+	return result, nil
+}
+
+func putResult(resp *http.Response, absent bool) (UploadResult, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPreconditionFailed && absent {
+		return UploadResult{}, &AlreadyExistsError{newResponseError(resp)}
+	}
+	if resp.StatusCode != 200 {
+		return UploadResult{}, newResponseError(resp)
+	}
+	s := resp.Header.Get("ETag")
+	if len(s) < 2 {
+		return UploadResult{}, fmt.Errorf("s3: received invalid checksum: %q", s)
+	}
+	return UploadResult{ETag: s[1 : len(s)-1]}, nil
+}
+
+// spill copies body to a temporary file, up to a byte more than max so
+// bigger bodies can be told apart without copying them entirely.
+func spill(body io.Reader, max int64) (*os.File, error) {
+	f, err := ioutil.TempFile("", "s3-put-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(f, body, max+1); err != nil && err != io.EOF {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// sizedBody returns the remaining content of body as an io.SectionReader if
+// its length can be determined, nil otherwise.
+func sizedBody(body io.Reader) (*io.SectionReader, error) {
+	switch b := body.(type) {
+	case *io.SectionReader:
+		return b, nil
+	case interface {
+		io.ReaderAt
+		io.Seeker
+	}:
+		off, err := b.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		end, err := b.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := b.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return io.NewSectionReader(b, off, end-off), nil
+	case *bytes.Buffer:
+		// The buffer is drained as if it was read, without copying it.
+		p := b.Next(b.Len())
+		return io.NewSectionReader(bytes.NewReader(p), 0, int64(len(p))), nil
+	default:
+		return nil, nil
+	}
+}
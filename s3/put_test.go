@@ -0,0 +1,307 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPutFile(t *testing.T) {
+	f, ts := newFakeS3(t)
+	payload := bytes.Repeat([]byte("abcdefgh"), 1024)
+	name := filepath.Join(t.TempDir(), "file.txt")
+	if err := ioutil.WriteFile(name, payload, 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	// Only the remaining content is uploaded.
+	if _, err := file.Seek(8, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Put(uri(ts, "/bucket/file.txt"), file, nil, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := f.get("/bucket/file.txt"); !bytes.Equal(b, payload[8:]) {
+		t.Error("unexpected content")
+	}
+	if result.ETag != strings.Trim(etag(payload[8:]), `"`) {
+		t.Errorf("unexpected etag %q", result.ETag)
+	}
+	requests := f.recorded()
+	if len(requests) != 1 {
+		t.Fatalf("expected a single request, got %d", len(requests))
+	}
+	if r := requests[0]; r.ContentLength != int64(len(payload)-8) || len(r.TransferEncoding) != 0 {
+		t.Errorf("expected a content length of %d without transfer encoding, got %d %v", len(payload)-8, r.ContentLength, r.TransferEncoding)
+	}
+}
+
+func TestPutContentMD5(t *testing.T) {
+	f, ts := newFakeS3(t)
+	payload := []byte("hello")
+	if _, err := Put(uri(ts, "/bucket/file.txt"), bytes.NewReader(payload), nil, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(payload)
+	if h := f.recorded()[0].Header.Get("Content-Md5"); h != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("unexpected Content-MD5 %q", h)
+	}
+
+	f, ts = newFakeS3(t)
+	if _, err := Put(uri(ts, "/bucket/file.txt"), bytes.NewReader(payload), &UploadOptions{DisableContentMD5: true}, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if h := f.recorded()[0].Header.Get("Content-Md5"); h != "" {
+		t.Errorf("expected no Content-MD5, got %q", h)
+	}
+}
+
+// readCounter counts the bytes read from a bytes.Reader.
+type readCounter struct {
+	*bytes.Reader
+	n int64
+}
+
+func (r *readCounter) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
+
+func TestPutExpectContinue(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/bucket/denied.txt" {
+			writeError(w, 403, "AccessDenied")
+			return true
+		}
+		return false
+	}
+	transport := ts.Client().Transport.(*http.Transport).Clone()
+	transport.ExpectContinueTimeout = 5 * time.Second
+	c := &http.Client{Transport: transport}
+	opts := &UploadOptions{ExpectContinue: true, DisableContentMD5: true}
+
+	body := &readCounter{Reader: bytes.NewReader(bytes.Repeat([]byte("a"), 1024))}
+	if _, err := Put(uri(ts, "/bucket/denied.txt"), body, opts, c); !IsAccessDenied(err) {
+		t.Fatalf("expected the upload to be denied, got %v", err)
+	}
+	if h := f.recorded()[0].Header.Get("Expect"); h != "100-continue" {
+		t.Errorf("unexpected Expect %q", h)
+	}
+	if n := atomic.LoadInt64(&body.n); n != 0 {
+		t.Errorf("expected the body not to be sent, %d bytes were read", n)
+	}
+
+	if _, err := Put(uri(ts, "/bucket/file.txt"), strings.NewReader("hello"), opts, c); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := f.get("/bucket/file.txt"); string(b) != "hello" {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	w, err := CreateWithOptions(uri(ts, "/bucket/parts.txt"), opts, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("hello"))
+	if _, err := w.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range f.recorded() {
+		if r.Method == "PUT" && strings.Contains(r.URL, "uploadId") && r.Header.Get("Expect") != "100-continue" {
+			t.Errorf("expected part %s to be sent with Expect", r.URL)
+		}
+	}
+}
+
+func TestPutSized(t *testing.T) {
+	for _, body := range []io.Reader{
+		bytes.NewReader([]byte("hello")),
+		strings.NewReader("hello"),
+		bytes.NewBufferString("hello"),
+	} {
+		f, ts := newFakeS3(t)
+		if _, err := Put(uri(ts, "/bucket/file.txt"), body, &UploadOptions{CreateIfAbsent: true}, ts.Client()); err != nil {
+			t.Fatal(err)
+		}
+		if r := f.recorded()[0]; r.ContentLength != 5 || len(r.TransferEncoding) != 0 {
+			t.Errorf("%T: expected a content length of 5 without transfer encoding, got %d %v", body, r.ContentLength, r.TransferEncoding)
+		}
+		if b, _ := f.get("/bucket/file.txt"); string(b) != "hello" {
+			t.Errorf("%T: unexpected content %q", body, b)
+		}
+		_, err := Put(uri(ts, "/bucket/file.txt"), strings.NewReader("hello"), &UploadOptions{CreateIfAbsent: true}, ts.Client())
+		if !IsAlreadyExists(err) {
+			t.Errorf("%T: expected the object to already exist, got %v", body, err)
+		}
+	}
+}
+
+func TestPutUnknownLength(t *testing.T) {
+	f, ts := newFakeS3(t)
+	r, w := io.Pipe()
+	go func() {
+		w.Write([]byte("hello"))
+		w.Close()
+	}()
+	if _, err := Put(uri(ts, "/bucket/file.txt"), r, nil, ts.Client()); err != ErrUnknownLength {
+		t.Errorf("expected ErrUnknownLength, got %v", err)
+	}
+	if n := len(f.recorded()); n != 0 {
+		t.Errorf("expected no request to be sent, got %d", n)
+	}
+
+	// Readers with a Len method aren't necessarily in memory.
+	if _, err := Put(uri(ts, "/bucket/file.txt"), lenReader{r}, nil, ts.Client()); err != ErrUnknownLength {
+		t.Errorf("expected ErrUnknownLength, got %v", err)
+	}
+}
+
+// lenReader is a reader reporting a length it doesn't hold.
+type lenReader struct {
+	io.Reader
+}
+
+func (lenReader) Len() int { return 5 }
+
+func TestPutSpillToDisk(t *testing.T) {
+	f, ts := newFakeS3(t)
+	payload := bytes.Repeat([]byte("abcdefgh"), 1024)
+	r, w := io.Pipe()
+	go func() {
+		w.Write(payload)
+		w.Close()
+	}()
+	dir := t.TempDir()
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", dir)
+
+	if _, err := Put(uri(ts, "/bucket/file.txt"), r, &UploadOptions{SpillToDisk: true}, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected the temporary file to be removed, got %d files", len(files))
+	}
+	if b, _ := f.get("/bucket/file.txt"); !bytes.Equal(b, payload) {
+		t.Error("unexpected content")
+	}
+	if r := f.recorded()[0]; r.ContentLength != int64(len(payload)) || len(r.TransferEncoding) != 0 {
+		t.Errorf("expected a content length of %d without transfer encoding, got %d %v", len(payload), r.ContentLength, r.TransferEncoding)
+	}
+}
+
+func TestSpillLimit(t *testing.T) {
+	body := strings.NewReader("hello world")
+	f, err := spill(struct{ io.Reader }{body}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	if b, _ := ioutil.ReadAll(f); string(b) != "hello" {
+		t.Errorf("expected a byte past the limit to be spilled, got %q", b)
+	}
+	if body.Len() != 6 {
+		t.Errorf("expected the rest of the body to be left unread, %d bytes remain", body.Len())
+	}
+}
+
+func TestPutMetadata(t *testing.T) {
+	f, ts := newFakeS3(t)
+	opts := &UploadOptions{Header: http.Header{
+		"X-Amz-Meta-Author": {"Zoë Café"},
+		"X-Amz-Meta-Plain":  {"ascii"},
+	}}
+	if _, err := Put(uri(ts, "/bucket/file.txt"), strings.NewReader("hello"), opts, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	h := f.recorded()[0].Header
+	if v := h.Get("X-Amz-Meta-Author"); v != "=?utf-8?q?Zo=C3=AB_Caf=C3=A9?=" {
+		t.Errorf("expected the value to be encoded, got %q", v)
+	}
+	if v, err := new(mime.WordDecoder).DecodeHeader(h.Get("X-Amz-Meta-Author")); err != nil || v != "Zoë Café" {
+		t.Errorf("expected the value to decode, got %q (%v)", v, err)
+	}
+	if v := h.Get("X-Amz-Meta-Plain"); v != "ascii" {
+		t.Errorf("expected ASCII values to be left untouched, got %q", v)
+	}
+	if v := opts.Header.Get("X-Amz-Meta-Author"); v != "Zoë Café" {
+		t.Errorf("expected the options not to be modified, got %q", v)
+	}
+
+	f, ts = newFakeS3(t)
+	opts = &UploadOptions{Header: http.Header{"X-Amz-Meta-Big": {strings.Repeat("a", 2046)}}}
+	_, err := Put(uri(ts, "/bucket/file.txt"), strings.NewReader("hello"), opts, ts.Client())
+	var e *MetadataTooLargeError
+	if !errors.As(err, &e) || e.Size != 2049 {
+		t.Errorf("expected metadata to be too large, got %v", err)
+	}
+	if _, err := CreateWithOptions(uri(ts, "/bucket/file.txt"), opts, ts.Client()); !errors.As(err, &e) {
+		t.Errorf("expected metadata to be too large, got %v", err)
+	}
+	if n := len(f.recorded()); n != 0 {
+		t.Errorf("expected no request, got %d", n)
+	}
+}
+
+func TestPutTags(t *testing.T) {
+	f, ts := newFakeS3(t)
+	tags := map[string]string{"project": "blue sky", "cost-center": "a&b=c"}
+	expected := "cost-center=a%26b%3Dc&project=blue+sky"
+
+	opts := &UploadOptions{Tags: tags}
+	if _, err := Put(uri(ts, "/bucket/file.txt"), strings.NewReader("hello"), opts, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	w, err := CreateWithOptions(uri(ts, "/bucket/file.bin"), opts, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("hello"))
+	if _, err := w.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range f.recorded() {
+		tagging := r.Header.Get("X-Amz-Tagging")
+		switch {
+		case r.Method == "PUT" && !strings.Contains(r.URL, "uploadId"), r.Method == "POST" && strings.HasSuffix(r.URL, "?uploads"):
+			if tagging != expected {
+				t.Errorf("%s %s: expected tagging %q, got %q", r.Method, r.URL, expected, tagging)
+			}
+		case tagging != "":
+			t.Errorf("%s %s: unexpected tagging %q", r.Method, r.URL, tagging)
+		}
+	}
+
+	for _, tags := range []map[string]string{
+		{"": "empty"},
+		{strings.Repeat("k", 129): "v"},
+		{"k": strings.Repeat("v", 257)},
+		{"1": "", "2": "", "3": "", "4": "", "5": "", "6": "", "7": "", "8": "", "9": "", "10": "", "11": ""},
+	} {
+		if _, err := Put(uri(ts, "/bucket/file.txt"), strings.NewReader("hello"), &UploadOptions{Tags: tags}, ts.Client()); err == nil {
+			t.Errorf("expected %v to be invalid", tags)
+		}
+	}
+}
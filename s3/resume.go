@@ -0,0 +1,212 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// uploadState is the progress of a resumable upload, as persisted in its
+// state file.
+type uploadState struct {
+	URI      string             `json:"uri"`
+	UploadID string             `json:"uploadId"`
+	Size     int64              `json:"size"`
+	PartSize int64              `json:"partSize"`
+	Parts    map[int]*statePart `json:"parts"`
+}
+
+// statePart is an uploaded part.
+type statePart struct {
+	ETag           string `json:"etag"`
+	ChecksumCRC32C string `json:"checksumCRC32C,omitempty"`
+	ChecksumSHA256 string `json:"checksumSHA256,omitempty"`
+}
+
+func loadUploadState(name string) (*uploadState, error) {
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s uploadState
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("s3: malformed upload state %s: %v", name, err)
+	}
+	if s.Parts == nil {
+		s.Parts = make(map[int]*statePart)
+	}
+	return &s, nil
+}
+
+// save writes the state to name, atomically so a crash doesn't leave a
+// truncated state behind.
+func (s *uploadState) save(name string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(name+".tmp", b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// ResumeUpload is like UploadReaderAt but persists the progress of the
+// upload, its ID and the parts already uploaded, to stateFile. If the upload
+// is interrupted, calling ResumeUpload again with the same stateFile only
+// uploads the missing parts before completing the upload. The state file is
+// removed once the upload is completed.
+//
+// The multipart upload isn't aborted on failure so it can be resumed, it
+// should be aborted otherwise as uploaded parts are billed.
+func ResumeUpload(stateFile, uri string, r io.ReaderAt, size int64, opts *UploadOptions, c *http.Client) (UploadResult, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	state, err := loadUploadState(stateFile)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	var up *uploader
+	if state == nil {
+		var skipped *UploadResult
+		up, skipped, err = initiate(uri, opts, c)
+		if err != nil {
+			return UploadResult{}, err
+		}
+		if skipped != nil {
+			return *skipped, nil
+		}
+		state = &uploadState{
+			URI:      uri,
+			UploadID: up.uploadID,
+			Size:     size,
+			PartSize: partSizeOf(size),
+			Parts:    make(map[int]*statePart),
+		}
+		if err := state.save(stateFile); err != nil {
+			up.abort()
+			return UploadResult{}, err
+		}
+	} else {
+		if state.URI != uri || state.Size != size {
+			return UploadResult{}, fmt.Errorf("s3: %s is the state of another upload", stateFile)
+		}
+		if up, err = resumeUploader(uri, state.UploadID, opts, c); err != nil {
+			return UploadResult{}, err
+		}
+	}
+
+	// Parts uploaded before, state.Parts is updated concurrently.
+	done := make(map[int]*statePart, len(state.Parts))
+	for n, p := range state.Parts {
+		if _, err := hex.DecodeString(p.ETag); err != nil {
+			return UploadResult{}, fmt.Errorf("s3: malformed upload state %s: %v", stateFile, err)
+		}
+		done[n] = p
+	}
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		parts = make(chan *part)
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range parts {
+				err := p.Upload()
+				p.Reset()
+				mu.Lock()
+				if err == nil {
+					state.Parts[p.PartNumber] = &statePart{
+						ETag:           p.ETag,
+						ChecksumCRC32C: p.ChecksumCRC32C,
+						ChecksumSHA256: p.ChecksumSHA256,
+					}
+					err = state.save(stateFile)
+				}
+				if err != nil && up.err == nil {
+					up.err = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	n := (size + state.PartSize - 1) / state.PartSize
+	if n == 0 {
+		// Empty objects are uploaded as a single empty part.
+		n = 1
+	}
+	for i := int64(0); i < n; i++ {
+		off := i * state.PartSize
+		p := &part{
+			PartNumber: len(up.Parts) + 1,
+			ReadSeeker: io.NewSectionReader(r, off, min64(state.PartSize, size-off)),
+			url:        up.url,
+			client:     up.client,
+			header:     up.header,
+			checksum:   up.checksum,
+			uploadID:   up.uploadID,
+			expect:     up.expect,
+		}
+		up.Parts = append(up.Parts, p)
+		if s, ok := done[p.PartNumber]; ok {
+			p.Reset()
+			p.ETag, p.ChecksumCRC32C, p.ChecksumSHA256 = s.ETag, s.ChecksumCRC32C, s.ChecksumSHA256
+			p.md5, _ = hex.DecodeString(s.ETag)
+			continue
+		}
+		parts <- p
+	}
+	close(parts)
+	wg.Wait()
+	if up.err != nil {
+		return UploadResult{}, up.err
+	}
+	result, err := up.complete()
+	if err != nil {
+		return result, err
+	}
+	return result, os.Remove(stateFile)
+}
+
+// resumeUploader returns the uploader of an already initiated upload.
+func resumeUploader(uri, uploadID string, opts *UploadOptions, c *http.Client) (*uploader, error) {
+	_, common, _, err := uploadHeaders(uri, &UploadOptions{
+		RequesterPays:     opts.RequesterPays,
+		ChecksumAlgorithm: opts.ChecksumAlgorithm,
+	}, c)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "https"
+	return &uploader{
+		client:   c,
+		header:   common,
+		checksum: opts.ChecksumAlgorithm,
+		absent:   opts.CreateIfAbsent,
+		verify:   opts.VerifyChecksum,
+		url:      u.String(),
+		uploadID: uploadID,
+		md5:      md5.New(),
+	}, nil
+}
@@ -0,0 +1,65 @@
+package s3
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestResumeUpload(t *testing.T) {
+	f, ts := newFakeS3(t)
+	payload := make([]byte, 2*minPartSize+1024)
+	rand.New(rand.NewSource(1)).Read(payload)
+	stateFile := filepath.Join(t.TempDir(), "upload.json")
+
+	// Crash after the first part.
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" && r.URL.Query().Get("partNumber") != "1" {
+			writeError(w, 400, "RequestTimeout")
+			return true
+		}
+		return false
+	}
+	_, err := ResumeUpload(stateFile, uri(ts, "/bucket/file.bin"), bytes.NewReader(payload), int64(len(payload)), nil, ts.Client())
+	if err == nil {
+		t.Fatal("expected the upload to fail")
+	}
+	if _, ok := f.get("/bucket/file.bin"); ok {
+		t.Fatal("expected the upload not to be completed")
+	}
+	if _, err := os.Stat(stateFile); err != nil {
+		t.Fatalf("expected the state to be persisted: %v", err)
+	}
+
+	f.handler = nil
+	before := len(f.recorded())
+	if _, err := ResumeUpload(stateFile, uri(ts, "/bucket/file.bin"), bytes.NewReader(payload), int64(len(payload)), nil, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := f.get("/bucket/file.bin"); !bytes.Equal(b, payload) {
+		t.Error("unexpected content")
+	}
+	var uploaded []string
+	for _, r := range f.recorded()[before:] {
+		if r.Method != "PUT" {
+			continue
+		}
+		uploaded = append(uploaded, r.Method+" "+r.URL)
+	}
+	sort.Strings(uploaded)
+	expected := []string{
+		"PUT /bucket/file.bin?partNumber=2&uploadId=1",
+		"PUT /bucket/file.bin?partNumber=3&uploadId=1",
+	}
+	if !reflect.DeepEqual(uploaded, expected) {
+		t.Errorf("expected only the missing parts to be uploaded, got %v", uploaded)
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("expected the state to be removed, got %v", err)
+	}
+}
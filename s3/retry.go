@@ -1,6 +1,13 @@
 package s3
 
-import "net/http"
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/cyberdelia/aws"
+)
 
 type retryFunc func() (*http.Response, error)
 
@@ -29,3 +36,29 @@ func retryNoBody(c *http.Client, req *http.Request) retryFunc {
 		return resp, nil
 	}
 }
+
+// retryPolicy sends req, retrying it according to p. The last response is
+// returned once retries are exhausted, leaving status checks to the caller.
+func retryPolicy(p *aws.RetryPolicy, c *http.Client, req *http.Request) (*http.Response, error) {
+	if req.GetBody != nil {
+		panic("request should not contain a body")
+	}
+	if p == nil {
+		p = aws.DefaultRetryPolicy
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := c.Do(req)
+		if attempt >= p.Attempts() || !p.Retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(p.Backoff(attempt, resp)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
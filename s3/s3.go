@@ -1,13 +1,17 @@
 package s3
 
 import (
+	"context"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 
 	"github.com/cyberdelia/aws"
 )
 
 // DefaultSigner is the default Signer and is use for all requests.
+// Requests are sent anonymously when AWS_ACCESS_KEY_ID is not set.
 var DefaultSigner = &aws.V4Signer{
 	Region:        os.Getenv("AWS_REGION"),
 	AccessKey:     os.Getenv("AWS_ACCESS_KEY_ID"),
@@ -20,3 +24,107 @@ var DefaultSigner = &aws.V4Signer{
 var DefaultClient = &http.Client{
 	Transport: DefaultSigner.Transport(),
 }
+
+// RequestBuilder returns the request sent to url, it allows adapting
+// requests to the quirks of S3 compatible providers.
+type RequestBuilder func(method, url string, body io.Reader) (*http.Request, error)
+
+// AWSRequestBuilder builds requests to AWS endpoints, url is used as is.
+func AWSRequestBuilder(method, url string, body io.Reader) (*http.Request, error) {
+	return http.NewRequest(method, url, body)
+}
+
+// WithRequestBuilder returns a copy of c whose requests are rebuilt with b
+// before being signed and sent, c is DefaultClient if nil. The headers, body
+// and context of the requests are kept.
+func WithRequestBuilder(c *http.Client, b RequestBuilder) *http.Client {
+	if c == nil {
+		c = DefaultClient
+	}
+	built := *c
+	built.Transport = &builderTransport{build: b, next: c.Transport}
+	return &built
+}
+
+type builderTransport struct {
+	build RequestBuilder
+	next  http.RoundTripper
+}
+
+func (t *builderTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body io.Reader
+	if r.Body != nil {
+		body = r.Body
+	}
+	req, err := t.build(r.Method, r.URL.String(), body)
+	if err != nil {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, err
+	}
+	req = req.WithContext(r.Context())
+	req.URL.RawPath = aws.EscapePath(req.URL.Path)
+	req.Header = r.Header.Clone()
+	req.Body = r.Body
+	req.GetBody = r.GetBody
+	req.ContentLength = r.ContentLength
+	req.TransferEncoding = r.TransferEncoding
+	req.Trailer = r.Trailer
+	req.Close = r.Close
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// newRequest returns a new request for the given S3 operation.
+func newRequest(op, method, url string, body io.Reader) (*http.Request, error) {
+	return newRequestContext(context.Background(), op, method, url, body)
+}
+
+// newRequestContext returns a new request for the given S3 operation bound
+// to ctx.
+func newRequestContext(ctx context.Context, op, method, uri string, body io.Reader) (*http.Request, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	// Buckets with dots can't be virtual-hosted over TLS.
+	pathStyle(u)
+	req, err := AWSRequestBuilder(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	// Keys are sent encoded as they are canonicalized when signing, Go
+	// leaves characters like + unencoded, which S3 may decode differently.
+	req.URL.RawPath = aws.EscapePath(req.URL.Path)
+	return req.WithContext(aws.WithOperation(ctx, op)), nil
+}
+
+// copyHeader adds all the values of src to dst.
+func copyHeader(dst, src http.Header) {
+	for k := range src {
+		for _, v := range src[k] {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// addQuery adds the values of q to the query of u.
+func addQuery(u *url.URL, q url.Values) {
+	if len(q) == 0 {
+		return
+	}
+	query := u.Query()
+	for k, v := range q {
+		query[k] = append(query[k], v...)
+	}
+	u.RawQuery = query.Encode()
+}
+
+// setRequestPayer acknowledges that the requester pays for the request.
+func setRequestPayer(h http.Header) {
+	h.Set("X-Amz-Request-Payer", "requester")
+}
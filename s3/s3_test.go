@@ -0,0 +1,674 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cyberdelia/aws"
+)
+
+type request struct {
+	Method        string
+	URL           string
+	Header        http.Header
+	ContentLength int64
+	// TransferEncoding is set for chunked requests.
+	TransferEncoding []string
+	// Body is only recorded for POST requests.
+	Body []byte
+}
+
+// fakeS3 is a minimal in-memory S3 implementation used by tests.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	meta     map[string]http.Header
+	uploads  map[string]map[int][]byte
+	pending  map[string]http.Header
+	requests []request
+	uploadID int
+
+	// handler, if set, is called before the default handling and can
+	// intercept requests by returning true.
+	handler func(w http.ResponseWriter, r *http.Request) bool
+}
+
+func newFakeS3(t testing.TB) (*fakeS3, *httptest.Server) {
+	f := newFake()
+	ts := httptest.NewTLSServer(f)
+	t.Cleanup(ts.Close)
+	return f, ts
+}
+
+func newFake() *fakeS3 {
+	return &fakeS3{
+		objects: make(map[string][]byte),
+		meta:    make(map[string]http.Header),
+		uploads: make(map[string]map[int][]byte),
+		pending: make(map[string]http.Header),
+	}
+}
+
+// uri returns the s3:// URI of the given path on the test server.
+func uri(ts *httptest.Server, path string) string {
+	return "s3://" + ts.Listener.Addr().String() + path
+}
+
+// virtualHosted returns a client sending requests to virtual-hosted S3 URLs,
+// like the ones returned by ParseS3URI, path-style to the test server.
+func virtualHosted(ts *httptest.Server) *http.Client {
+	return &http.Client{Transport: &rewriteTransport{ts: ts}}
+}
+
+type rewriteTransport struct {
+	ts *httptest.Server
+}
+
+func (t *rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if bucket := aws.HostBucket(r.URL.Host); bucket != "" {
+		r = r.Clone(r.Context())
+		r.URL.Host = t.ts.Listener.Addr().String()
+		r.URL.Path = "/" + bucket + r.URL.Path
+		r.URL.RawPath = ""
+		r.Host = r.URL.Host
+	}
+	return t.ts.Client().Transport.RoundTrip(r)
+}
+
+func (f *fakeS3) put(key string, b []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = b
+}
+
+// metadata returns the headers stored along an object, such as Content-Type
+// and x-amz-meta-* headers.
+func metadata(h http.Header) http.Header {
+	m := make(http.Header)
+	for k, v := range h {
+		if k == "Content-Type" || strings.HasPrefix(k, "X-Amz-Meta-") {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+func (f *fakeS3) get(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.objects[key]
+	return b, ok
+}
+
+func (f *fakeS3) recorded() []request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]request(nil), f.requests...)
+}
+
+func etag(b []byte) string {
+	sum := md5.Sum(b)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Method == "POST" {
+		body, _ = ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, request{
+		Method:           r.Method,
+		URL:              r.URL.RequestURI(),
+		Header:           r.Header.Clone(),
+		ContentLength:    r.ContentLength,
+		TransferEncoding: r.TransferEncoding,
+		Body:             body,
+	})
+	f.mu.Unlock()
+	if f.handler != nil && f.handler(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	key := r.URL.Path
+	switch {
+	case r.Method == "POST" && has(q, "uploads"):
+		f.mu.Lock()
+		f.uploadID++
+		id := strconv.Itoa(f.uploadID)
+		f.uploads[id] = make(map[int][]byte)
+		f.pending[id] = metadata(r.Header)
+		f.mu.Unlock()
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == "PUT" && has(q, "uploadId"):
+		var (
+			b   []byte
+			err error
+		)
+		src := r.Header.Get("X-Amz-Copy-Source")
+		if src != "" {
+			var ok bool
+			if src, err = url.PathUnescape(src); err != nil {
+				writeError(w, 400, "InvalidArgument")
+				return
+			}
+			if b, ok = f.get("/" + strings.TrimPrefix(src, "/")); !ok {
+				writeError(w, 404, "NoSuchKey")
+				return
+			}
+		} else if b, err = readBody(r); err != nil {
+			writeError(w, 400, "BadDigest")
+			return
+		}
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.mu.Lock()
+		parts, ok := f.uploads[q.Get("uploadId")]
+		if ok {
+			parts[n] = b
+		}
+		f.mu.Unlock()
+		if !ok {
+			writeError(w, 404, "NoSuchUpload")
+			return
+		}
+		if src != "" {
+			fmt.Fprintf(w, "<CopyPartResult><ETag>%s</ETag><ChecksumCRC32C>%s</ChecksumCRC32C><ChecksumSHA256>%s</ChecksumSHA256></CopyPartResult>",
+				html.EscapeString(etag(b)), checksum(aws.ChecksumCRC32C, b), checksum(aws.ChecksumSHA256, b))
+			return
+		}
+		w.Header().Set("ETag", etag(b))
+	case r.Method == "POST" && has(q, "uploadId"):
+		var c struct {
+			Parts []struct {
+				PartNumber     int
+				ChecksumCRC32C string
+				ChecksumSHA256 string
+			} `xml:"Part"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&c); err != nil {
+			writeError(w, 400, "MalformedXML")
+			return
+		}
+		f.mu.Lock()
+		_, exists := f.objects[key]
+		f.mu.Unlock()
+		if exists && r.Header.Get("If-None-Match") == "*" {
+			writeError(w, 412, "PreconditionFailed")
+			return
+		}
+		f.mu.Lock()
+		parts, ok := f.uploads[q.Get("uploadId")]
+		f.meta[key] = f.pending[q.Get("uploadId")]
+		delete(f.uploads, q.Get("uploadId"))
+		f.mu.Unlock()
+		if !ok {
+			writeError(w, 404, "NoSuchUpload")
+			return
+		}
+		var body []byte
+		sums := md5.New()
+		composite := map[string]hash.Hash{}
+		for _, p := range c.Parts {
+			if (p.ChecksumCRC32C != "" && p.ChecksumCRC32C != checksum(aws.ChecksumCRC32C, parts[p.PartNumber])) ||
+				(p.ChecksumSHA256 != "" && p.ChecksumSHA256 != checksum(aws.ChecksumSHA256, parts[p.PartNumber])) {
+				writeError(w, 400, "InvalidPart")
+				return
+			}
+			for algorithm, sum := range map[string]string{aws.ChecksumCRC32C: p.ChecksumCRC32C, aws.ChecksumSHA256: p.ChecksumSHA256} {
+				if sum == "" {
+					continue
+				}
+				if composite[algorithm] == nil {
+					composite[algorithm] = newHash(algorithm)
+				}
+				b, _ := base64.StdEncoding.DecodeString(sum)
+				composite[algorithm].Write(b)
+			}
+			body = append(body, parts[p.PartNumber]...)
+			s := md5.Sum(parts[p.PartNumber])
+			sums.Write(s[:])
+		}
+		tag := fmt.Sprintf("\"%s-%d\"", hex.EncodeToString(sums.Sum(nil)), len(c.Parts))
+		checksums := map[string]string{}
+		for algorithm, h := range composite {
+			sum := base64.StdEncoding.EncodeToString(h.Sum(nil))
+			checksums[algorithm] = fmt.Sprintf("%s-%d", sum, len(c.Parts))
+			// The expected checksum of the object, if sent, is validated,
+			// it has no part count.
+			if expected := r.Header.Get("X-Amz-Checksum-" + algorithm); expected != "" && expected != sum {
+				writeError(w, 400, "BadDigest")
+				return
+			}
+		}
+		f.put(key, body)
+		f.mu.Lock()
+		f.meta[key].Set("ETag", tag)
+		for algorithm, sum := range checksums {
+			f.meta[key].Set("X-Amz-Checksum-"+algorithm, sum)
+		}
+		f.mu.Unlock()
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Location>https://%s%s</Location><ETag>%s</ETag><ChecksumCRC32C>%s</ChecksumCRC32C><ChecksumSHA256>%s</ChecksumSHA256></CompleteMultipartUploadResult>",
+			r.Host, key, tag, checksums[aws.ChecksumCRC32C], checksums[aws.ChecksumSHA256])
+	case r.Method == "POST" && has(q, "delete"):
+		f.delete(w, r)
+	case r.Method == "DELETE" && has(q, "uploadId"):
+		f.mu.Lock()
+		delete(f.uploads, q.Get("uploadId"))
+		f.mu.Unlock()
+		w.WriteHeader(204)
+	case r.Method == "PUT" && r.Header.Get("X-Amz-Copy-Source") != "":
+		f.copy(w, r)
+	case r.Method == "PUT":
+		b, err := readBody(r)
+		if err != nil {
+			writeError(w, 400, "BadDigest")
+			return
+		}
+		if _, exists := f.get(key); exists && r.Header.Get("If-None-Match") == "*" {
+			writeError(w, 412, "PreconditionFailed")
+			return
+		}
+		f.put(key, b)
+		f.mu.Lock()
+		f.meta[key] = metadata(r.Header)
+		f.mu.Unlock()
+		w.Header().Set("ETag", etag(b))
+	case r.Method == "DELETE":
+		f.mu.Lock()
+		b, ok := f.objects[key]
+		tag := f.meta[key].Get("Etag")
+		if tag == "" {
+			tag = etag(b)
+		}
+		if m := r.Header.Get("If-Match"); m != "" && (!ok || m != tag) {
+			f.mu.Unlock()
+			writeError(w, 412, "PreconditionFailed")
+			return
+		}
+		delete(f.objects, key)
+		f.mu.Unlock()
+		w.WriteHeader(204)
+	case r.Method == "GET" && q.Get("list-type") == "2":
+		f.list(w, r)
+	case r.Method == "GET" && has(q, "attributes"):
+		f.attributes(w, r)
+	case r.Method == "GET" || r.Method == "HEAD":
+		b, ok := f.get(key)
+		if !ok {
+			writeError(w, 404, "NoSuchKey")
+			return
+		}
+		f.mu.Lock()
+		for k, v := range f.meta[key] {
+			w.Header()[k] = v
+		}
+		f.mu.Unlock()
+		if _, ok := w.Header()["Etag"]; !ok {
+			w.Header().Set("ETag", etag(b))
+		}
+		if m := r.Header.Get("If-Match"); m != "" && m != w.Header().Get("Etag") {
+			writeError(w, 412, "PreconditionFailed")
+			return
+		}
+		w.Header().Set("Last-Modified", "Wed, 12 Oct 2009 17:50:00 GMT")
+		if rg := r.Header.Get("Range"); rg != "" {
+			var start, end int
+			if _, err := fmt.Sscanf(rg, "bytes=%d-%d", &start, &end); err != nil {
+				writeError(w, 416, "InvalidRange")
+				return
+			}
+			if start >= len(b) {
+				writeError(w, 416, "InvalidRange")
+				return
+			}
+			if end >= len(b) {
+				end = len(b) - 1
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(b)))
+			w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+			w.WriteHeader(206)
+			w.Write(b[start : end+1])
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.Write(b)
+	default:
+		writeError(w, 405, "MethodNotAllowed")
+	}
+}
+
+// attributes implements GetObjectAttributes, checksums are only known for
+// multipart uploads.
+func (f *fakeS3) attributes(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	b, ok := f.objects[r.URL.Path]
+	meta := f.meta[r.URL.Path]
+	f.mu.Unlock()
+	if !ok {
+		writeError(w, 404, "NoSuchKey")
+		return
+	}
+	tag := meta.Get("Etag")
+	if tag == "" {
+		tag = etag(b)
+	}
+	var parts int
+	if i := strings.LastIndex(tag, "-"); i > 0 {
+		parts, _ = strconv.Atoi(strings.Trim(tag[i+1:], `"`))
+	}
+	fmt.Fprintf(w, "<GetObjectAttributesResponse><ETag>%s</ETag><Checksum><ChecksumCRC32C>%s</ChecksumCRC32C><ChecksumSHA256>%s</ChecksumSHA256></Checksum><ObjectParts><TotalPartsCount>%d</TotalPartsCount></ObjectParts><ObjectSize>%d</ObjectSize></GetObjectAttributesResponse>",
+		strings.Trim(tag, `"`), meta.Get("X-Amz-Checksum-Crc32c"), meta.Get("X-Amz-Checksum-Sha256"), parts, len(b))
+}
+
+// delete implements DeleteObjects, keys which don't exist are reported as
+// errors.
+func (f *fakeS3) delete(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Md5") == "" {
+		writeError(w, 400, "MissingContentMD5")
+		return
+	}
+	var d struct {
+		Quiet   bool
+		Objects []ObjectIdentifier `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&d); err != nil {
+		writeError(w, 400, "MalformedXML")
+		return
+	}
+	bucket := strings.TrimSuffix(r.URL.Path, "/") + "/"
+	var buf bytes.Buffer
+	buf.WriteString("<DeleteResult>")
+	f.mu.Lock()
+	for _, o := range d.Objects {
+		if _, ok := f.objects[bucket+o.Key]; !ok && o.VersionID == "" {
+			fmt.Fprintf(&buf, "<Error><Key>%s</Key><Code>NoSuchKey</Code><Message>missing</Message></Error>", html.EscapeString(o.Key))
+			continue
+		}
+		delete(f.objects, bucket+o.Key)
+		if !d.Quiet {
+			fmt.Fprintf(&buf, "<Deleted><Key>%s</Key></Deleted>", html.EscapeString(o.Key))
+		}
+	}
+	f.mu.Unlock()
+	buf.WriteString("</DeleteResult>")
+	w.Write(buf.Bytes())
+}
+
+// copy implements CopyObject.
+func (f *fakeS3) copy(w http.ResponseWriter, r *http.Request) {
+	src, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeError(w, 400, "InvalidArgument")
+		return
+	}
+	src = "/" + strings.TrimPrefix(src, "/")
+	b, ok := f.get(src)
+	if !ok {
+		writeError(w, 404, "NoSuchKey")
+		return
+	}
+	f.mu.Lock()
+	m := f.meta[src].Clone()
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		m = metadata(r.Header)
+	}
+	if m == nil {
+		m = make(http.Header)
+	}
+	m.Del("Etag")
+	f.objects[r.URL.Path] = b
+	f.meta[r.URL.Path] = m
+	f.mu.Unlock()
+	fmt.Fprintf(w, "<CopyObjectResult><LastModified>2009-10-12T17:50:30.000Z</LastModified><ETag>&quot;%x&quot;</ETag></CopyObjectResult>", md5.Sum(b))
+}
+
+// list implements a simplified ListObjectsV2.
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	bucket := r.URL.Path
+	if !strings.HasSuffix(bucket, "/") {
+		bucket += "/"
+	}
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	after := q.Get("continuation-token")
+	if after == "" {
+		after = q.Get("start-after")
+	}
+	max := 1000
+	if m := q.Get("max-keys"); m != "" {
+		max, _ = strconv.Atoi(m)
+	}
+
+	f.mu.Lock()
+	var keys []string
+	sizes := make(map[string]int)
+	for k, b := range f.objects {
+		if strings.HasPrefix(k, bucket) {
+			keys = append(keys, strings.TrimPrefix(k, bucket))
+			sizes[strings.TrimPrefix(k, bucket)] = len(b)
+		}
+	}
+	f.mu.Unlock()
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	var prefixes []string
+	seen := make(map[string]bool)
+	count, truncated, next := 0, false, ""
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) || k <= after {
+			continue
+		}
+		if count == max {
+			truncated = true
+			break
+		}
+		if delimiter != "" {
+			if i := strings.Index(k[len(prefix):], delimiter); i >= 0 {
+				p := k[:len(prefix)+i+1]
+				if !seen[p] {
+					seen[p] = true
+					prefixes = append(prefixes, p)
+					count++
+				}
+				next = k
+				continue
+			}
+		}
+		fmt.Fprintf(&buf, "<Contents><Key>%s</Key><LastModified>2009-10-12T17:50:30.000Z</LastModified><ETag>&quot;%x&quot;</ETag><Size>%d</Size><StorageClass>STANDARD</StorageClass>", html.EscapeString(k), md5.Sum(nil), sizes[k])
+		if q.Get("fetch-owner") == "true" {
+			buf.WriteString("<Owner><ID>owner-id</ID><DisplayName>owner</DisplayName></Owner>")
+		}
+		buf.WriteString("</Contents>")
+		count++
+		next = k
+	}
+	for _, p := range prefixes {
+		fmt.Fprintf(&buf, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", html.EscapeString(p))
+	}
+	fmt.Fprintf(w, "<ListBucketResult><IsTruncated>%t</IsTruncated>", truncated)
+	if truncated {
+		fmt.Fprintf(w, "<NextContinuationToken>%s</NextContinuationToken>", html.EscapeString(next))
+	}
+	w.Write(buf.Bytes())
+	w.Write([]byte("</ListBucketResult>"))
+}
+
+// readBody reads the body of r, decoding aws-chunked bodies and verifying
+// their trailing checksum.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Header.Get("Content-Encoding") != "aws-chunked" {
+		return ioutil.ReadAll(r.Body)
+	}
+	var body []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(line, "\r\n"), 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		body = append(body, chunk[:n]...)
+	}
+	trailer, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	kv := strings.SplitN(strings.TrimSuffix(trailer, "\r\n"), ":", 2)
+	if len(kv) != 2 || kv[0] != r.Header.Get("X-Amz-Trailer") {
+		return nil, fmt.Errorf("unexpected trailer %q", trailer)
+	}
+	algorithm := strings.ToUpper(strings.TrimPrefix(kv[0], "x-amz-checksum-"))
+	if kv[1] != checksum(algorithm, body) {
+		return nil, fmt.Errorf("mismatching checksum %q", kv[1])
+	}
+	if l := r.Header.Get("X-Amz-Decoded-Content-Length"); l != strconv.Itoa(len(body)) {
+		return nil, fmt.Errorf("mismatching decoded length %q", l)
+	}
+	return body, nil
+}
+
+func checksum(algorithm string, b []byte) string {
+	h := newHash(algorithm)
+	if h == nil {
+		return ""
+	}
+	h.Write(b)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func has(q url.Values, k string) bool {
+	_, ok := q[k]
+	return ok
+}
+
+func TestTransferHook(t *testing.T) {
+	f, ts := newFakeS3(t)
+	var transfers []aws.Transfer
+	c := &http.Client{
+		Transport: &aws.Transport{
+			Signer:    aws.AnonymousSigner{},
+			Transport: ts.Client().Transport,
+			OnTransfer: func(t aws.Transfer) {
+				transfers = append(transfers, t)
+			},
+		},
+	}
+	payload := bytes.Repeat([]byte("a"), 1024)
+
+	w, err := CreateWithOptions(uri(ts, "/bucket/file.txt"), &UploadOptions{RequesterPays: true}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	r, _, err := OpenWithOptions(uri(ts, "/bucket/file.txt"), &DownloadOptions{RequesterPays: true}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Copy(uri(ts, "/bucket/file.txt"), uri(ts, "/bucket/copy.txt"), &CopyOptions{RequesterPays: true}, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeleteWithOptions(uri(ts, "/bucket/copy.txt"), &DeleteOptions{RequesterPays: true}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	totals := make(map[string][2]int64)
+	for _, t := range transfers {
+		b := totals[t.Operation]
+		totals[t.Operation] = [2]int64{b[0] + t.RequestBytes, b[1] + t.ResponseBytes}
+	}
+	if b := totals["UploadPart"]; b[0] != int64(len(payload)) {
+		t.Errorf("expected %d bytes uploaded, got %d", len(payload), b[0])
+	}
+	if b := totals["GetObject"]; b[1] != int64(len(payload)) {
+		t.Errorf("expected %d bytes downloaded, got %d", len(payload), b[1])
+	}
+	for _, op := range []string{"CreateMultipartUpload", "CompleteMultipartUpload", "HeadObject"} {
+		if _, ok := totals[op]; !ok {
+			t.Errorf("expected a transfer for %s", op)
+		}
+	}
+	for _, r := range f.recorded() {
+		if r.Header.Get("X-Amz-Request-Payer") != "requester" {
+			t.Errorf("expected %s %s to acknowledge requester pays", r.Method, r.URL)
+		}
+	}
+}
+
+func TestRequestBuilder(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/file.txt", []byte("hello"))
+
+	// Rewrite virtual-hosted URLs of a provider to path-style ones.
+	c := WithRequestBuilder(ts.Client(), func(method, uri string, body io.Reader) (*http.Request, error) {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, err
+		}
+		if bucket := strings.TrimSuffix(u.Host, ".storage.example"); bucket != u.Host {
+			u.Host = ts.Listener.Addr().String()
+			u.Path = "/" + bucket + u.Path
+		}
+		return AWSRequestBuilder(method, u.String(), body)
+	})
+	info, err := Stat("s3://bucket.storage.example/file.txt", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 5 {
+		t.Errorf("unexpected size %d", info.Size)
+	}
+	if u := f.recorded()[0].URL; u != "/bucket/file.txt" {
+		t.Errorf("unexpected url %q", u)
+	}
+
+	// The body of rebuilt requests is kept.
+	if _, err := Put("s3://bucket.storage.example/other.txt", strings.NewReader("world"), nil, c); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := f.get("/bucket/other.txt"); string(b) != "world" {
+		t.Errorf("unexpected content %q", b)
+	}
+}
@@ -0,0 +1,568 @@
+// Package s3test provides an in-memory S3 server for testing code using s3.
+//
+// The server supports path-style requests to store, read and delete
+// objects, ranged reads, listing and multipart uploads, which is what the
+// s3 package needs to open, create and walk objects. Buckets exist as soon
+// as an object is stored in them. Requests aren't authenticated.
+package s3test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minPartSize is the minimum size of the parts of a multipart upload, but
+// the last one.
+const minPartSize = 5 * 1024 * 1024
+
+// storedHeaders are the headers of a request creating an object which are
+// stored with it, along its x-amz-meta-* headers.
+var storedHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Type",
+	"Expires",
+}
+
+type object struct {
+	data    []byte
+	etag    string
+	header  http.Header
+	modTime time.Time
+}
+
+type upload struct {
+	path   string
+	header http.Header
+	parts  map[int][]byte
+}
+
+// Server is an in-memory S3 server, it must be closed once done.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string]*object
+	uploads  map[string]*upload
+	uploadID int
+}
+
+// NewServer starts and returns a new Server. The client of the server,
+// returned by Client, must be used to send requests to it.
+func NewServer() *Server {
+	s := &Server{
+		objects: make(map[string]*object),
+		uploads: make(map[string]*upload),
+	}
+	s.Server = httptest.NewTLSServer(s)
+	return s
+}
+
+// URI returns the s3:// URI of key in bucket on the server, key can be
+// empty or a prefix.
+func (s *Server) URI(bucket, key string) string {
+	return "s3://" + s.Listener.Addr().String() + "/" + bucket + "/" + key
+}
+
+// PutObject stores an object with the given content.
+func (s *Server) PutObject(bucket, key string, b []byte) {
+	s.store("/"+bucket+"/"+key, b, etag(b), nil)
+}
+
+// GetObject returns the content of an object and whether it exists.
+func (s *Server) GetObject(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects["/"+bucket+"/"+key]
+	if !ok {
+		return nil, false
+	}
+	return o.data, true
+}
+
+func (s *Server) store(path string, b []byte, tag string, h http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[path] = &object{
+		data:    b,
+		etag:    tag,
+		header:  h,
+		modTime: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func (s *Server) object(path string) (*object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[path]
+	return o, ok
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path := r.URL.Path
+	isBucket := strings.Count(strings.Trim(path, "/"), "/") == 0
+	switch {
+	case path == "/" || path == "":
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "listing buckets isn't supported")
+	case isBucket && r.Method == "GET":
+		s.list(w, r)
+	case isBucket:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "bucket operations aren't supported")
+	case r.Method == "POST" && has(q, "uploads"):
+		s.initiate(w, r)
+	case r.Method == "PUT" && has(q, "uploadId"):
+		s.uploadPart(w, r)
+	case r.Method == "POST" && has(q, "uploadId"):
+		s.complete(w, r)
+	case r.Method == "DELETE" && has(q, "uploadId"):
+		s.mu.Lock()
+		delete(s.uploads, q.Get("uploadId"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT":
+		s.put(w, r)
+	case r.Method == "GET" || r.Method == "HEAD":
+		s.get(w, r)
+	case r.Method == "DELETE":
+		s.mu.Lock()
+		delete(s.objects, path)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "the method isn't allowed")
+	}
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "copies aren't supported")
+		return
+	}
+	b, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if !s.precondition(w, r) {
+		return
+	}
+	tag := etag(b)
+	s.store(r.URL.Path, b, tag, storedHeader(r.Header))
+	w.Header().Set("ETag", tag)
+}
+
+// precondition reports whether the object of r can be created given its
+// If-None-Match header, it writes an error otherwise.
+func (s *Server) precondition(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("If-None-Match") != "*" {
+		return true
+	}
+	if _, ok := s.object(r.URL.Path); ok {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "the object already exists")
+		return false
+	}
+	return true
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	o, ok := s.object(r.URL.Path)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "the object doesn't exist")
+		return
+	}
+	h := w.Header()
+	for k, v := range o.header {
+		h[k] = v
+	}
+	h.Set("ETag", o.etag)
+	h.Set("Last-Modified", o.modTime.Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	size := int64(len(o.data))
+	rg := r.Header.Get("Range")
+	if rg == "" {
+		h.Set("Content-Length", strconv.FormatInt(size, 10))
+		if r.Method == "GET" {
+			w.Write(o.data)
+		}
+		return
+	}
+	start, end, ok := parseRange(rg, size)
+	if !ok {
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "the range can't be satisfied")
+		return
+	}
+	h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	h.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method == "GET" {
+		w.Write(o.data[start : end+1])
+	}
+}
+
+// parseRange parses a single byte range of an object of the given size,
+// it reports whether the range can be satisfied.
+func parseRange(rg string, size int64) (start, end int64, ok bool) {
+	spec := strings.TrimPrefix(rg, "bytes=")
+	i := strings.Index(spec, "-")
+	if spec == rg || i < 0 || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last := spec[:i], spec[i+1:]
+	var err error
+	switch {
+	case first == "":
+		// The last bytes of the object.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	case last == "":
+		end = size - 1
+	default:
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil || start >= size || end < start {
+		return 0, 0, false
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return start, end, true
+}
+
+func (s *Server) initiate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.uploadID++
+	id := strconv.Itoa(s.uploadID)
+	s.uploads[id] = &upload{
+		path:   r.URL.Path,
+		header: storedHeader(r.Header),
+		parts:  make(map[int][]byte),
+	}
+	s.mu.Unlock()
+	bucket, key := split(r.URL.Path)
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadID string `xml:"UploadId"`
+	}{Bucket: bucket, Key: key, UploadID: id})
+}
+
+// upload returns the upload of r, it writes an error if it doesn't exist.
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) (*upload, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	up, ok := s.uploads[r.URL.Query().Get("uploadId")]
+	if !ok || up.path != r.URL.Path {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "the upload doesn't exist")
+		return nil, false
+	}
+	return up, true
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || n < 1 || n > 10000 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "invalid part number")
+		return
+	}
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "copies aren't supported")
+		return
+	}
+	b, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	up, ok := s.upload(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	up.parts[n] = b
+	s.mu.Unlock()
+	w.Header().Set("ETag", etag(b))
+}
+
+func (s *Server) complete(w http.ResponseWriter, r *http.Request) {
+	var c struct {
+		Parts []struct {
+			PartNumber int
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&c); err != nil || len(c.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "the parts of the upload can't be read")
+		return
+	}
+	up, ok := s.upload(w, r)
+	if !ok || !s.precondition(w, r) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var (
+		data []byte
+		sums = md5.New()
+	)
+	for i, p := range c.Parts {
+		b, ok := up.parts[p.PartNumber]
+		switch {
+		case !ok:
+			writeError(w, http.StatusBadRequest, "InvalidPart", "a part doesn't exist")
+			return
+		case i > 0 && p.PartNumber <= c.Parts[i-1].PartNumber:
+			writeError(w, http.StatusBadRequest, "InvalidPartOrder", "the parts aren't in ascending order")
+			return
+		case i < len(c.Parts)-1 && len(b) < minPartSize:
+			writeError(w, http.StatusBadRequest, "EntityTooSmall", "a part is smaller than the minimum allowed")
+			return
+		}
+		data = append(data, b...)
+		sum := md5.Sum(b)
+		sums.Write(sum[:])
+	}
+	tag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sums.Sum(nil)), len(c.Parts))
+	delete(s.uploads, r.URL.Query().Get("uploadId"))
+	s.objects[r.URL.Path] = &object{
+		data:    data,
+		etag:    tag,
+		header:  up.header,
+		modTime: time.Now().UTC().Truncate(time.Second),
+	}
+	bucket, key := split(r.URL.Path)
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}{Location: "https://" + r.Host + r.URL.Path, Bucket: bucket, Key: key, ETag: tag})
+}
+
+type listedObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+// list implements ListObjectsV2, continuation tokens are the last key
+// listed.
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	bucket := "/" + strings.Trim(r.URL.Path, "/") + "/"
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	after := q.Get("continuation-token")
+	if after == "" {
+		after = q.Get("start-after")
+	}
+	max := 1000
+	if m := q.Get("max-keys"); m != "" {
+		n, err := strconv.Atoi(m)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "invalid max-keys")
+			return
+		}
+		max = n
+	}
+
+	s.mu.Lock()
+	objects := make(map[string]*object)
+	var keys []string
+	for path, o := range s.objects {
+		if key := strings.TrimPrefix(path, bucket); key != path && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+			objects[key] = o
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(keys)
+
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		Delimiter             string `xml:",omitempty"`
+		MaxKeys               int
+		KeyCount              int
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []listedObject
+		CommonPrefixes        []commonPrefix
+	}{
+		Name:      strings.Trim(bucket, "/"),
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		MaxKeys:   max,
+	}
+	// group returns the common prefix of key, if any.
+	group := func(key string) string {
+		if delimiter == "" {
+			return ""
+		}
+		if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+			return key[:len(prefix)+i+len(delimiter)]
+		}
+		return ""
+	}
+	// The keys of a common prefix already listed are skipped.
+	skipped := ""
+	if after != "" && strings.HasPrefix(after, prefix) {
+		skipped = group(after)
+	}
+	last := ""
+	for _, key := range keys {
+		if key <= after || (skipped != "" && strings.HasPrefix(key, skipped)) {
+			continue
+		}
+		p := group(key)
+		if p != "" && p == last {
+			continue
+		}
+		if result.KeyCount == max {
+			result.IsTruncated = true
+			break
+		}
+		result.KeyCount++
+		if p != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{p})
+			last = p
+			result.NextContinuationToken = key
+			continue
+		}
+		o := objects[key]
+		result.Contents = append(result.Contents, listedObject{
+			Key:          key,
+			LastModified: o.modTime.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         o.etag,
+			Size:         int64(len(o.data)),
+			StorageClass: "STANDARD",
+		})
+		result.NextContinuationToken = key
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+	writeXML(w, result)
+}
+
+// readBody reads the body of r, decoding aws-chunked bodies. Checksums
+// aren't verified.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Header.Get("Content-Encoding") != "aws-chunked" {
+		return ioutil.ReadAll(r.Body)
+	}
+	var body []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		// Chunks can carry a signature extension.
+		size := strings.SplitN(strings.TrimSuffix(line, "\r\n"), ";", 2)[0]
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return body, nil
+		}
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		body = append(body, chunk[:n]...)
+	}
+}
+
+// storedHeader returns the headers of h stored along an object.
+func storedHeader(h http.Header) http.Header {
+	stored := make(http.Header)
+	for k, v := range h {
+		if strings.HasPrefix(k, "X-Amz-Meta-") {
+			stored[k] = v
+		}
+	}
+	for _, k := range storedHeaders {
+		if v := h.Get(k); v != "" && !(k == "Content-Encoding" && v == "aws-chunked") {
+			stored.Set(k, v)
+		}
+	}
+	return stored
+}
+
+// split returns the bucket and the key of a path-style request path.
+func split(path string) (bucket, key string) {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+func has(q map[string][]string, k string) bool {
+	_, ok := q[k]
+	return ok
+}
+
+func etag(b []byte) string {
+	sum := md5.Sum(b)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(buf.Bytes())
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	xml.NewEncoder(&buf).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,158 @@
+package s3test_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/cyberdelia/aws/s3"
+	"github.com/cyberdelia/aws/s3/s3test"
+)
+
+func TestServerCreateOpen(t *testing.T) {
+	s := s3test.NewServer()
+	defer s.Close()
+	payload := make([]byte, 2*5*1024*1024+1024)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	h := http.Header{"Content-Type": {"application/octet-stream"}, "X-Amz-Meta-Owner": {"test"}}
+	w, err := s3.Create(s.URI("bucket", "file.bin"), h, s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+	result, err := w.Complete()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s3.IsMultipartETag(result.ETag) {
+		t.Errorf("expected a multipart ETag, got %q", result.ETag)
+	}
+	if b, ok := s.GetObject("bucket", "file.bin"); !ok || !bytes.Equal(b, payload) {
+		t.Error("unexpected stored content")
+	}
+
+	r, header, err := s3.Open(s.URI("bucket", "file.bin"), s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, payload) {
+		t.Error("unexpected content")
+	}
+	if header.Get("Content-Type") != "application/octet-stream" || header.Get("X-Amz-Meta-Owner") != "test" {
+		t.Errorf("unexpected headers %v", header)
+	}
+
+	b, info, err := s3.Peek(s.URI("bucket", "file.bin"), 16, s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, payload[:16]) || info.Size != int64(len(payload)) || info.PartCount < 1 {
+		t.Errorf("unexpected peek %q %+v", b, info)
+	}
+}
+
+func TestServerPutDelete(t *testing.T) {
+	s := s3test.NewServer()
+	defer s.Close()
+
+	if _, err := s3.Put(s.URI("bucket", "file.txt"), bytes.NewReader([]byte("hello")), nil, s.Client()); err != nil {
+		t.Fatal(err)
+	}
+	info, err := s3.Stat(s.URI("bucket", "file.txt"), s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 5 || info.ETag != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("unexpected info %+v", info)
+	}
+	_, err = s3.Put(s.URI("bucket", "file.txt"), bytes.NewReader([]byte("again")), &s3.UploadOptions{CreateIfAbsent: true}, s.Client())
+	if !s3.IsAlreadyExists(err) {
+		t.Errorf("expected an already exists error, got %v", err)
+	}
+
+	if _, err := s3.Delete(s.URI("bucket", "file.txt"), s.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s3.Stat(s.URI("bucket", "file.txt"), s.Client()); !s3.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if _, _, err := s3.Open(s.URI("bucket", "file.txt"), s.Client()); !s3.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestServerWalk(t *testing.T) {
+	s := s3test.NewServer()
+	defer s.Close()
+	for _, key := range []string{"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "e.txt"} {
+		s.PutObject("bucket", key, []byte(key))
+	}
+	s.PutObject("other", "f.txt", nil)
+
+	// Pages of a single key exercise the continuation of the listing.
+	var names []string
+	err := s3.WalkWithOptions(s.URI("bucket", ""), func(name string, info os.FileInfo) error {
+		if !info.IsDir() {
+			names = append(names, name)
+		}
+		return nil
+	}, &s3.WalkOptions{MaxKeys: 1}, s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "e.txt"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestServerRange(t *testing.T) {
+	s := s3test.NewServer()
+	defer s.Close()
+	s.PutObject("bucket", "file.txt", []byte("0123456789"))
+	s.PutObject("bucket", "empty.txt", nil)
+
+	var tests = []struct {
+		Key      string
+		Range    string
+		Status   int
+		Expected string
+	}{
+		{"file.txt", "bytes=2-4", 206, "234"},
+		{"file.txt", "bytes=7-", 206, "789"},
+		{"file.txt", "bytes=-3", 206, "789"},
+		{"file.txt", "bytes=8-100", 206, "89"},
+		{"file.txt", "bytes=10-12", 416, ""},
+		{"empty.txt", "bytes=0-9", 416, ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", s.URL+"/bucket/"+test.Key, nil)
+		req.Header.Set("Range", test.Range)
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.Status {
+			t.Errorf("%s: expected status %d, got %d", test.Range, test.Status, resp.StatusCode)
+			continue
+		}
+		if test.Status == 206 && string(b) != test.Expected {
+			t.Errorf("%s: expected %q, got %q", test.Range, test.Expected, b)
+		}
+	}
+}
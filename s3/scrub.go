@@ -0,0 +1,233 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cyberdelia/aws"
+)
+
+// ErrNoChecksum is reported by Scrub for objects without a checksum to
+// validate their content against.
+var ErrNoChecksum = errors.New("s3: object has no checksum")
+
+// ScrubOptions configures Scrub.
+type ScrubOptions struct {
+	// SampleRate is the fraction of the objects checked, between 0 and 1,
+	// objects are picked at random. It defaults to 1, every object.
+	SampleRate float64
+
+	// Verify downloads the objects and checks their content against their
+	// checksum, instead of only checking they have one. Objects without a
+	// CRC32C or SHA256 checksum are checked against their ETag, the MD5 of
+	// their content unless they're encrypted with SSE-KMS.
+	Verify bool
+
+	// Concurrency is the number of objects checked at once, it defaults to
+	// the number of CPUs.
+	Concurrency int
+}
+
+// ScrubResult describes an object checked by Scrub.
+type ScrubResult struct {
+	Key  string
+	Size int64
+
+	// Algorithm is the algorithm of Checksum, aws.ChecksumCRC32C,
+	// aws.ChecksumSHA256 or MD5 for objects checked against their ETag.
+	Algorithm string
+	Checksum  string
+
+	// Verified reports whether the content of the object was downloaded and
+	// checked against Checksum.
+	Verified bool
+
+	// Err is why the object couldn't be validated, such as ErrNoChecksum
+	// or a *ChecksumMismatchError, nil for objects which were.
+	Err error
+}
+
+// Scrub checks the integrity of the objects under the prefix at prefixURI
+// from their checksum, as returned by GetObjectAttributes, and reports the
+// objects checked.
+func Scrub(prefixURI string, c *http.Client) ([]ScrubResult, error) {
+	return ScrubWithOptions(prefixURI, nil, c)
+}
+
+// ScrubWithOptions is like Scrub but allows to sample the objects checked
+// and to verify their content.
+func ScrubWithOptions(prefixURI string, opts *ScrubOptions, c *http.Client) ([]ScrubResult, error) {
+	if opts == nil {
+		opts = &ScrubOptions{}
+	}
+	if opts.SampleRate < 0 || opts.SampleRate > 1 {
+		return nil, fmt.Errorf("s3: invalid sample rate %v", opts.SampleRate)
+	}
+	rate := opts.SampleRate
+	if rate == 0 {
+		rate = 1
+	}
+	if c == nil {
+		c = DefaultClient
+	}
+	u, err := url.Parse(prefixURI)
+	if err != nil {
+		return nil, err
+	}
+	u, prefix, err := bucketPrefix(u)
+	if err != nil {
+		return nil, err
+	}
+	w := &walker{
+		u:    u,
+		opts: &WalkOptions{SkipOwner: true},
+		c:    c,
+		flat: true,
+	}
+	n := concurrency
+	if opts.Concurrency > 0 {
+		n = opts.Concurrency
+	}
+
+	// Objects are sampled and checked as the pages are listed, rather than
+	// once the whole prefix is.
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, n)
+		checked []*ScrubResult
+	)
+	err = w.readPages(prefix, func(objects []os.FileInfo) error {
+		for _, o := range objects {
+			if o.IsDir() || rand.Float64() >= rate {
+				continue
+			}
+			r := &ScrubResult{Key: o.Name(), Size: o.Size()}
+			checked = append(checked, r)
+			obj := *u
+			obj.Path = u.Path + "/" + r.Key
+			obj.RawQuery = ""
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(r *ScrubResult, uri string) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				r.Algorithm, r.Checksum, r.Verified, r.Err = scrub(uri, opts.Verify, c)
+			}(r, obj.String())
+		}
+		return nil
+	})
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ScrubResult, len(checked))
+	for i, r := range checked {
+		results[i] = *r
+	}
+	return results, nil
+}
+
+// scrub checks the object at uri, it returns its checksum and whether its
+// content was verified.
+func scrub(uri string, verify bool, c *http.Client) (algorithm, checksum string, verified bool, err error) {
+	a, err := GetObjectAttributes(uri, c)
+	if err != nil {
+		return "", "", false, err
+	}
+	switch {
+	case a.ChecksumCRC32C != "":
+		algorithm, checksum = aws.ChecksumCRC32C, a.ChecksumCRC32C
+	case a.ChecksumSHA256 != "":
+		algorithm, checksum = aws.ChecksumSHA256, a.ChecksumSHA256
+	case !verify:
+		return "", "", false, ErrNoChecksum
+	default:
+		info, err := Stat(uri, c)
+		if err != nil {
+			return "", "", false, err
+		}
+		if info.ServerSideEncryption == "aws:kms" {
+			return "", "", false, ErrNoChecksum
+		}
+		algorithm, checksum = "MD5", a.ETag
+	}
+	if !verify {
+		return algorithm, checksum, false, nil
+	}
+	return algorithm, checksum, true, verifyContent(uri, algorithm, checksum, a.PartCount, c)
+}
+
+// verifyContent downloads the object at uri and checks its content
+// against its checksum. The checksum of multipart objects is computed from
+// the checksums of their parts, which are downloaded one by one.
+func verifyContent(uri, algorithm, expected string, parts int, c *http.Client) error {
+	newSum := func() hash.Hash {
+		if algorithm == "MD5" {
+			return md5.New()
+		}
+		return newHash(algorithm)
+	}
+	encode := func(b []byte) string {
+		if algorithm == "MD5" {
+			return hex.EncodeToString(b)
+		}
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	sumOf := func(r io.ReadCloser) ([]byte, error) {
+		defer r.Close()
+		h := newSum()
+		if _, err := io.Copy(h, r); err != nil {
+			return nil, err
+		}
+		return h.Sum(nil), nil
+	}
+
+	var actual string
+	if parts == 0 {
+		r, _, err := Open(uri, c)
+		if err != nil {
+			return err
+		}
+		sum, err := sumOf(r)
+		if err != nil {
+			return err
+		}
+		actual = encode(sum)
+	} else {
+		composite := newSum()
+		for n := 1; n <= parts; n++ {
+			r, _, err := GetPart(uri, n, c)
+			if err != nil {
+				return err
+			}
+			sum, err := sumOf(r)
+			if err != nil {
+				return err
+			}
+			composite.Write(sum)
+		}
+		actual = fmt.Sprintf("%s-%d", encode(composite.Sum(nil)), parts)
+		// S3 reports the checksums of multipart objects with or without
+		// their number of parts.
+		if !strings.Contains(expected, "-") {
+			actual = encode(composite.Sum(nil))
+		}
+	}
+	if actual != expected {
+		return &ChecksumMismatchError{Expected: expected, Actual: actual}
+	}
+	return nil
+}
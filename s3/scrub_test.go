@@ -0,0 +1,106 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cyberdelia/aws"
+)
+
+func TestScrub(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/data/a.txt", []byte("hello"))
+	f.put("/bucket/data/b.txt", []byte("world"))
+	f.meta["/bucket/data/b.txt"] = http.Header{
+		"X-Amz-Checksum-Crc32c": {checksum(aws.ChecksumCRC32C, []byte("world"))},
+	}
+	f.put("/bucket/data/c.txt", []byte("corrupted"))
+	f.meta["/bucket/data/c.txt"] = http.Header{"Etag": {etag([]byte("original"))}}
+	f.put("/bucket/other.txt", []byte("other"))
+
+	results, err := Scrub(uri(ts, "/bucket/data/"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 objects, got %d", len(results))
+	}
+	for _, r := range results {
+		switch r.Key {
+		case "data/b.txt":
+			if r.Err != nil || r.Algorithm != aws.ChecksumCRC32C || r.Verified {
+				t.Errorf("unexpected result %+v", r)
+			}
+		default:
+			if !errors.Is(r.Err, ErrNoChecksum) {
+				t.Errorf("expected no checksum for %s, got %v", r.Key, r.Err)
+			}
+		}
+	}
+
+	results, err = ScrubWithOptions(uri(ts, "/bucket/data/"), &ScrubOptions{Verify: true}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if !r.Verified {
+			t.Errorf("expected %s to be verified", r.Key)
+		}
+		var mismatch *ChecksumMismatchError
+		if corrupt := errors.As(r.Err, &mismatch); corrupt != (r.Key == "data/c.txt") {
+			t.Errorf("unexpected error for %s: %v", r.Key, r.Err)
+		}
+	}
+}
+
+func TestScrubSampleRate(t *testing.T) {
+	f, ts := newFakeS3(t)
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		f.put("/bucket/"+key, []byte(key))
+	}
+	results, err := ScrubWithOptions(uri(ts, "/bucket/"), &ScrubOptions{SampleRate: 0.01}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) >= 8 {
+		t.Errorf("expected a sample of the objects, got %d", len(results))
+	}
+	if _, err := ScrubWithOptions(uri(ts, "/bucket/"), &ScrubOptions{SampleRate: 2}, ts.Client()); err == nil {
+		t.Error("expected an invalid sample rate to fail")
+	}
+}
+
+func TestScrubStreaming(t *testing.T) {
+	f, ts := newFakeS3(t)
+	for i := 0; i < 1001; i++ {
+		f.put(fmt.Sprintf("/bucket/data/%04d", i), []byte("data"))
+	}
+	prefix, _, _, err := ParseS3URI("s3://bucket/data/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := ScrubWithOptions(prefix, &ScrubOptions{Concurrency: 1}, virtualHosted(ts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1001 || results[0].Key != "data/0000" || results[1000].Key != "data/1000" {
+		t.Fatalf("unexpected results %d", len(results))
+	}
+
+	// Objects of the first page are checked before the second is listed.
+	var lists, checked int
+	for _, r := range f.recorded() {
+		switch {
+		case strings.Contains(r.URL, "list-type"):
+			lists++
+		case lists == 1:
+			checked++
+		}
+	}
+	if lists != 2 || checked == 0 {
+		t.Errorf("expected objects to be checked while listing, got %d checked before the second of %d pages", checked, lists)
+	}
+}
@@ -0,0 +1,270 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// InputFormat describes the format of an object queried with
+// SelectObjectContent. Exactly one of CSV, JSON or Parquet must be set.
+type InputFormat struct {
+	CSV     *CSVInput     `xml:"CSV,omitempty"`
+	JSON    *JSONInput    `xml:"JSON,omitempty"`
+	Parquet *ParquetInput `xml:"Parquet,omitempty"`
+
+	// CompressionType is one of NONE, GZIP or BZIP2.
+	CompressionType string `xml:"CompressionType,omitempty"`
+}
+
+// CSVInput describes a CSV object.
+type CSVInput struct {
+	// FileHeaderInfo is one of USE, IGNORE or NONE.
+	FileHeaderInfo  string `xml:"FileHeaderInfo,omitempty"`
+	Comments        string `xml:"Comments,omitempty"`
+	FieldDelimiter  string `xml:"FieldDelimiter,omitempty"`
+	QuoteCharacter  string `xml:"QuoteCharacter,omitempty"`
+	RecordDelimiter string `xml:"RecordDelimiter,omitempty"`
+}
+
+// JSONInput describes a JSON object.
+type JSONInput struct {
+	// Type is either DOCUMENT or LINES.
+	Type string `xml:"Type"`
+}
+
+// ParquetInput describes a Parquet object.
+type ParquetInput struct{}
+
+// OutputFormat describes the format of the results returned by
+// SelectObjectContent. Exactly one of CSV or JSON must be set.
+type OutputFormat struct {
+	CSV  *CSVOutput  `xml:"CSV,omitempty"`
+	JSON *JSONOutput `xml:"JSON,omitempty"`
+}
+
+// CSVOutput describes CSV results.
+type CSVOutput struct {
+	// QuoteFields is either ALWAYS or ASNEEDED.
+	QuoteFields     string `xml:"QuoteFields,omitempty"`
+	FieldDelimiter  string `xml:"FieldDelimiter,omitempty"`
+	QuoteCharacter  string `xml:"QuoteCharacter,omitempty"`
+	RecordDelimiter string `xml:"RecordDelimiter,omitempty"`
+}
+
+// JSONOutput describes JSON results.
+type JSONOutput struct {
+	RecordDelimiter string `xml:"RecordDelimiter,omitempty"`
+}
+
+type selectRequest struct {
+	XMLName             xml.Name     `xml:"http://s3.amazonaws.com/doc/2006-03-01/ SelectObjectContentRequest"`
+	Expression          string       `xml:"Expression"`
+	ExpressionType      string       `xml:"ExpressionType"`
+	InputSerialization  InputFormat  `xml:"InputSerialization"`
+	OutputSerialization OutputFormat `xml:"OutputSerialization"`
+}
+
+// SelectObjectContent runs the given SQL expression against the object at
+// uri and returns a reader of the resulting records.
+func SelectObjectContent(uri string, sql string, in InputFormat, out OutputFormat, c *http.Client) (io.ReadCloser, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "https"
+	u.RawQuery = "select&select-type=2"
+
+	body, err := xml.Marshal(&selectRequest{
+		Expression:          sql,
+		ExpressionType:      "SQL",
+		InputSerialization:  in,
+		OutputSerialization: out,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := bytes.NewReader(body)
+	resp, err := retry(func() (*http.Response, error) {
+		if _, err := b.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		req, err := newRequest("SelectObjectContent", "POST", u.String(), b)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == 500 {
+			return nil, newResponseError(resp)
+		}
+		return resp, nil
+	}, retries)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, newResponseError(resp)
+	}
+	return &eventReader{
+		r: bufio.NewReader(resp.Body),
+		c: resp.Body,
+	}, nil
+}
+
+// eventReader decodes an event stream, returning the payload of Records
+// events.
+// https://docs.aws.amazon.com/AmazonS3/latest/API/RESTSelectObjectAppendix.html
+type eventReader struct {
+	r   *bufio.Reader
+	c   io.Closer
+	buf []byte
+	err error
+}
+
+func (e *eventReader) Read(p []byte) (int, error) {
+	for len(e.buf) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		e.buf, e.err = e.next()
+	}
+	n := copy(p, e.buf)
+	e.buf = e.buf[n:]
+	return n, nil
+}
+
+func (e *eventReader) Close() error {
+	return e.c.Close()
+}
+
+// next decodes the next message and returns the records it contains.
+func (e *eventReader) next() ([]byte, error) {
+	m, err := readMessage(e.r)
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch m.headers[":message-type"] {
+	case "error":
+		return nil, &APIError{
+			Code:    m.headers[":error-code"],
+			Message: m.headers[":error-message"],
+		}
+	case "event":
+		switch m.headers[":event-type"] {
+		case "Records":
+			return m.payload, nil
+		case "End":
+			return nil, io.EOF
+		}
+	}
+	// Stats, Progress and Cont events are ignored.
+	return nil, nil
+}
+
+type message struct {
+	headers map[string]string
+	payload []byte
+}
+
+const (
+	preludeLen = 12
+	crcLen     = 4
+)
+
+var errInvalidMessage = errors.New("s3: invalid event stream message")
+
+func readMessage(r io.Reader) (*message, error) {
+	prelude := make([]byte, preludeLen)
+	if _, err := io.ReadFull(r, prelude); err != nil {
+		return nil, err
+	}
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, fmt.Errorf("s3: mismatching event stream prelude checksum")
+	}
+	if total < preludeLen+crcLen+headersLen {
+		return nil, errInvalidMessage
+	}
+	b := make([]byte, total)
+	copy(b, prelude)
+	if _, err := io.ReadFull(r, b[preludeLen:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(b[:total-crcLen]) != binary.BigEndian.Uint32(b[total-crcLen:]) {
+		return nil, fmt.Errorf("s3: mismatching event stream message checksum")
+	}
+	headers, err := decodeHeaders(b[preludeLen : preludeLen+headersLen])
+	if err != nil {
+		return nil, err
+	}
+	return &message{
+		headers: headers,
+		payload: b[preludeLen+headersLen : total-crcLen],
+	}, nil
+}
+
+// decodeHeaders decodes the message headers, only string values are kept.
+func decodeHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		n := int(b[0])
+		if len(b) < 1+n+1 {
+			return nil, errInvalidMessage
+		}
+		name := string(b[1 : 1+n])
+		kind := b[1+n]
+		b = b[1+n+1:]
+
+		var size int
+		switch kind {
+		case 0, 1: // bool
+		case 2: // byte
+			size = 1
+		case 3: // short
+			size = 2
+		case 4: // int
+			size = 4
+		case 5, 8: // long, timestamp
+			size = 8
+		case 9: // uuid
+			size = 16
+		case 6, 7: // bytes, string
+			if len(b) < 2 {
+				return nil, errInvalidMessage
+			}
+			size = int(binary.BigEndian.Uint16(b))
+			b = b[2:]
+		default:
+			return nil, errInvalidMessage
+		}
+		if len(b) < size {
+			return nil, errInvalidMessage
+		}
+		if kind == 7 {
+			headers[name] = string(b[:size])
+		}
+		b = b[size:]
+	}
+	return headers, nil
+}
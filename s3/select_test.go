@@ -0,0 +1,126 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func encodeMessage(headers [][2]string, payload []byte) []byte {
+	var h bytes.Buffer
+	for _, kv := range headers {
+		h.WriteByte(byte(len(kv[0])))
+		h.WriteString(kv[0])
+		h.WriteByte(7)
+		binary.Write(&h, binary.BigEndian, uint16(len(kv[1])))
+		h.WriteString(kv[1])
+	}
+	total := preludeLen + h.Len() + len(payload) + crcLen
+	var m bytes.Buffer
+	binary.Write(&m, binary.BigEndian, uint32(total))
+	binary.Write(&m, binary.BigEndian, uint32(h.Len()))
+	binary.Write(&m, binary.BigEndian, crc32.ChecksumIEEE(m.Bytes()))
+	m.Write(h.Bytes())
+	m.Write(payload)
+	binary.Write(&m, binary.BigEndian, crc32.ChecksumIEEE(m.Bytes()))
+	return m.Bytes()
+}
+
+func event(kind string, payload string) []byte {
+	return encodeMessage([][2]string{
+		{":message-type", "event"},
+		{":event-type", kind},
+		{":content-type", "application/octet-stream"},
+	}, []byte(payload))
+}
+
+func TestSelectObjectContent(t *testing.T) {
+	f, ts := newFakeS3(t)
+	var body []byte
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Write(event("Records", "a,1\n"))
+		w.Write(event("Progress", "<Progress/>"))
+		w.Write(event("Records", "b,2\n"))
+		w.Write(event("Stats", "<Stats/>"))
+		w.Write(event("End", ""))
+		return true
+	}
+	in := InputFormat{CSV: &CSVInput{FileHeaderInfo: "USE"}}
+	out := OutputFormat{CSV: &CSVOutput{}}
+	r, err := SelectObjectContent(uri(ts, "/bucket/data.csv"), "SELECT * FROM S3Object", in, out, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "a,1\nb,2\n" {
+		t.Errorf("unexpected records %q", b)
+	}
+	if u := f.recorded()[0].URL; u != "/bucket/data.csv?select&select-type=2" {
+		t.Errorf("unexpected url %q", u)
+	}
+	for _, s := range []string{
+		"<Expression>SELECT * FROM S3Object</Expression>",
+		"<ExpressionType>SQL</ExpressionType>",
+		"<InputSerialization><CSV><FileHeaderInfo>USE</FileHeaderInfo></CSV></InputSerialization>",
+		"<OutputSerialization><CSV></CSV></OutputSerialization>",
+	} {
+		if !strings.Contains(string(body), s) {
+			t.Errorf("expected request to contain %q, got %q", s, body)
+		}
+	}
+}
+
+func TestEventReader(t *testing.T) {
+	corrupted := event("Records", "a,1\n")
+	corrupted[len(corrupted)-1] ^= 0xff
+	var tests = []struct {
+		Stream  []byte
+		Records string
+		Error   string
+	}{
+		{
+			Stream:  bytes.Join([][]byte{event("Records", "a,1\n"), event("End", "")}, nil),
+			Records: "a,1\n",
+		},
+		{
+			Stream:  event("Records", "a,1\n"),
+			Records: "a,1\n",
+			Error:   "unexpected EOF",
+		},
+		{
+			Stream: encodeMessage([][2]string{
+				{":message-type", "error"},
+				{":error-code", "InvalidQuery"},
+				{":error-message", "bad query"},
+			}, nil),
+			Error: "s3: unexpected error: (InvalidQuery) bad query",
+		},
+		{
+			Stream: corrupted,
+			Error:  "s3: mismatching event stream message checksum",
+		},
+	}
+	for i, test := range tests {
+		r := &eventReader{
+			r: bufio.NewReader(bytes.NewReader(test.Stream)),
+			c: ioutil.NopCloser(nil),
+		}
+		b, err := ioutil.ReadAll(r)
+		if string(b) != test.Records {
+			t.Errorf("(%d) expected records %q, got %q", i, test.Records, b)
+		}
+		if (err == nil && test.Error != "") || (err != nil && err.Error() != test.Error) {
+			t.Errorf("(%d) expected error %q, got %v", i, test.Error, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package s3
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/cyberdelia/aws"
+)
+
+// Downloader downloads objects with the same client and options, it is safe
+// for concurrent use. The package functions, like Open, use a Downloader
+// configured with their arguments.
+type Downloader struct {
+	// Client is the client used for requests, DefaultClient if nil.
+	Client *http.Client
+
+	// Options configures every download, it shouldn't be modified while
+	// downloads are in progress. It shouldn't have a TeeTo writer either,
+	// since it would be shared by concurrent downloads.
+	Options *DownloadOptions
+
+	// Limiter, if set, caps the number of requests in flight for all the
+	// downloads.
+	Limiter *aws.Limiter
+}
+
+// Open opens the object at uri, like OpenWithOptions.
+func (d *Downloader) Open(uri string) (io.ReadCloser, http.Header, error) {
+	return open(uri, d.Options, limitClient(d.Client, d.Limiter))
+}
+
+// ReadAll returns the content of the object at uri.
+func (d *Downloader) ReadAll(uri string) ([]byte, error) {
+	r, _, err := d.Open(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if d, ok := r.(*downloader); ok && d.buf != nil && d.tee == nil {
+		return d.buf, nil
+	}
+	return ioutil.ReadAll(r)
+}
+
+// DownloadFile downloads the object at uri to the file name, creating its
+// parent directories. The file is removed if the download fails.
+func (d *Downloader) DownloadFile(uri, name string) error {
+	return writeFile(name, func() (io.ReadCloser, error) {
+		r, _, err := d.Open(uri)
+		return r, err
+	})
+}
+
+// writeFile writes the content opened by open to the file name, creating
+// its parent directories. The file is removed if writing fails.
+func writeFile(name string, open func() (io.ReadCloser, error)) (err error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(name)
+		}
+	}()
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// Uploader uploads objects with the same client and options, it is safe for
+// concurrent use. The package functions, like Create, use an Uploader
+// configured with their arguments.
+type Uploader struct {
+	// Client is the client used for requests, DefaultClient if nil.
+	Client *http.Client
+
+	// Options configures every upload, it shouldn't be modified while
+	// uploads are in progress. Its ExpectedMD5, if any, is the checksum of
+	// every uploaded content.
+	Options *UploadOptions
+
+	// Limiter, if set, caps the number of requests in flight for all the
+	// uploads.
+	Limiter *aws.Limiter
+}
+
+// Create creates the object at uri, like CreateWithOptions.
+func (u *Uploader) Create(uri string) (UploadWriter, error) {
+	return create(uri, u.Options, limitClient(u.Client, u.Limiter))
+}
+
+// Put uploads body to the object at uri in a single request, like Put.
+func (u *Uploader) Put(uri string, body io.Reader) (UploadResult, error) {
+	return put(uri, body, u.Options, limitClient(u.Client, u.Limiter))
+}
+
+// UploadFile uploads the file name to the object at uri, in a single request
+// if it is smaller than a part, in parallel parts otherwise.
+func (u *Uploader) UploadFile(name, uri string) (UploadResult, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if info.Size() < minPartSize {
+		return u.Put(uri, f)
+	}
+	return UploadReaderAt(uri, f, info.Size(), u.Options, limitClient(u.Client, u.Limiter))
+}
+
+// limitClient returns a copy of c sending requests while holding a slot of
+// l, c itself if l is nil.
+func limitClient(c *http.Client, l *aws.Limiter) *http.Client {
+	if c == nil {
+		c = DefaultClient
+	}
+	if l == nil {
+		return c
+	}
+	limited := *c
+	limited.Transport = l.RoundTripper(c.Transport)
+	return &limited
+}
+
+// rampClient returns a copy of c sending requests while holding a slot of r,
+// c itself if r is nil. When the transport of c is an *aws.Transport, the
+// slots are held under it, so each of its retries is paced and throttled
+// attempts lower the limit even if a retry succeeds.
+func rampClient(c *http.Client, r *aws.Ramp) *http.Client {
+	if c == nil {
+		c = DefaultClient
+	}
+	if r == nil {
+		return c
+	}
+	ramped := *c
+	if t, ok := c.Transport.(*aws.Transport); ok {
+		inner := *t
+		inner.Transport = r.RoundTripper(t.Transport)
+		ramped.Transport = &inner
+	} else {
+		ramped.Transport = r.RoundTripper(c.Transport)
+	}
+	return &ramped
+}
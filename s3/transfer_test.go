@@ -0,0 +1,106 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cyberdelia/aws"
+)
+
+func TestDownloader(t *testing.T) {
+	f, ts := newFakeS3(t)
+	for i := 0; i < 10; i++ {
+		f.put(fmt.Sprintf("/bucket/%d.txt", i), []byte(fmt.Sprintf("object %d", i)))
+	}
+	var inflight, max int32
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+		return false
+	}
+	d := &Downloader{
+		Client:  ts.Client(),
+		Options: &DownloadOptions{SkipHead: true},
+		Limiter: aws.NewLimiter(2),
+	}
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			expected := fmt.Sprintf("object %d", i)
+			b, err := d.ReadAll(uri(ts, fmt.Sprintf("/bucket/%d.txt", i)))
+			if err != nil || string(b) != expected {
+				t.Errorf("(%d) unexpected content %q (%v)", i, b, err)
+			}
+			name := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+			if err := d.DownloadFile(uri(ts, fmt.Sprintf("/bucket/%d.txt", i)), name); err != nil {
+				t.Error(err)
+			}
+			if b, _ := ioutil.ReadFile(name); string(b) != expected {
+				t.Errorf("(%d) unexpected file content %q", i, b)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if max > 2 {
+		t.Errorf("expected at most 2 requests in flight, got %d", max)
+	}
+	for _, r := range f.recorded() {
+		if r.Method == "HEAD" {
+			t.Error("expected the options to be used")
+		}
+	}
+	if err := d.DownloadFile(uri(ts, "/bucket/missing.txt"), filepath.Join(dir, "missing.txt")); !IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestUploader(t *testing.T) {
+	f, ts := newFakeS3(t)
+	u := &Uploader{
+		Client:  ts.Client(),
+		Options: &UploadOptions{Header: http.Header{"Content-Type": {"text/plain"}}},
+	}
+	if _, err := u.Put(uri(ts, "/bucket/put.txt"), bytes.NewReader([]byte("put"))); err != nil {
+		t.Fatal(err)
+	}
+	w, err := u.Create(uri(ts, "/bucket/create.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("create"))
+	if _, err := w.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "file.txt")
+	ioutil.WriteFile(name, []byte("file"), 0644)
+	if _, err := u.UploadFile(name, uri(ts, "/bucket/file.txt")); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"put", "create", "file"} {
+		if b, _ := f.get("/bucket/" + k + ".txt"); string(b) != k {
+			t.Errorf("unexpected content of %s: %q", k, b)
+		}
+		if ct := f.meta["/bucket/"+k+".txt"].Get("Content-Type"); ct != "text/plain" {
+			t.Errorf("expected the options to be used for %s, got %q", k, ct)
+		}
+	}
+}
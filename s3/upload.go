@@ -6,33 +6,200 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/cyberdelia/aws"
 )
 
 const (
 	minPartSize = 5 * 1024 * 1024
 	maxPartSize = 5 * 1024 * 1024 * 1024
+	maxParts    = 10000
 	retries     = 3
 )
 
 var concurrency = runtime.NumCPU()
 
+var errCompleted = errors.New("s3: upload already completed")
+
+// UploadResult describes a completed upload.
+type UploadResult struct {
+	// ETag is the entity tag of the uploaded object, without quotes.
+	ETag string
+	// Location is the URL of the uploaded object as reported by S3.
+	Location string
+	// Checksum is the checksum of the object confirmed by S3 once a
+	// multipart upload with a ChecksumAlgorithm is completed, the composite
+	// checksum of its parts as reported by S3, usually suffixed with their
+	// number, such as "VcLnLw==-3". It's empty if S3 didn't report one.
+	Checksum string
+	// Unchanged reports whether the upload was skipped because the remote
+	// object already had the expected content.
+	Unchanged bool
+}
+
+// UploadOptions configures an upload.
+type UploadOptions struct {
+	// Header holds additional headers sent when creating the object, such
+	// as Content-Type or x-amz-meta-* headers. Metadata is limited to 2KB,
+	// non-ASCII values are RFC 2047 encoded.
+	Header http.Header
+
+	// ExpectedMD5 is the hex encoded MD5 of the content about to be
+	// uploaded. If the remote object already has this content, no data is
+	// uploaded and the result is reported as unchanged. The checksum is
+	// stored in the object metadata, since multipart uploads don't have a
+	// content based ETag.
+	ExpectedMD5 string
+
+	// RequesterPays acknowledges that the requester pays for the requests
+	// made to the bucket.
+	RequesterPays bool
+
+	// Retention and LegalHold lock the uploaded object, the bucket must have
+	// object lock enabled.
+	Retention *Retention
+	LegalHold bool
+
+	// ChecksumAlgorithm, either aws.ChecksumCRC32C or aws.ChecksumSHA256,
+	// has every part streamed with its checksum sent in a trailer, letting
+	// S3 validate the integrity of the data without hashing it beforehand.
+	// The checksum of the object, computed from the ones of its parts, is
+	// sent when the upload is completed so S3 also validates the assembled
+	// object.
+	ChecksumAlgorithm string
+
+	// CreateIfAbsent only creates the object if it doesn't exist yet, an
+	// *AlreadyExistsError is returned otherwise. The condition is checked
+	// atomically when the upload is completed.
+	CreateIfAbsent bool
+
+	// SpillToDisk has Put copy bodies of unknown length to a temporary
+	// file to determine their length, instead of failing with
+	// ErrUnknownLength. The file is removed once the upload is done.
+	SpillToDisk bool
+
+	// DisableContentMD5 has Put send its body without a Content-MD5, saving
+	// a pass over the body to hash it. S3 then can't reject a body
+	// corrupted in transit, and the ETag of the object isn't checked.
+	DisableContentMD5 bool
+
+	// ExpectContinue sends the object, or its parts, with an Expect:
+	// 100-continue header, so S3 can reject a request, e.g. with a 403 or a
+	// 412, before its body is sent. The transport of the client must have an
+	// ExpectContinueTimeout, like the ones of DefaultClient and of the
+	// clients returned by aws.NewClient, or the body is sent right away.
+	ExpectContinue bool
+
+	// VerifyChecksum checks the checksum of the object once the multipart
+	// upload is completed against the one computed from its parts, a
+	// *ChecksumMismatchError is returned if they differ. The checksum is
+	// the ChecksumAlgorithm one if set, otherwise the ETag is checked
+	// against the MD5 of the MD5 of the parts written.
+	VerifyChecksum bool
+
+	// Tags are set on the object when it's created, instead of with a
+	// separate request. Objects have at most 10 tags, with keys of up to 128
+	// characters and values of up to 256 characters.
+	Tags map[string]string
+
+	// Preflight, if set, checks the destination before the upload starts,
+	// so scripts fail early instead of wasting an upload.
+	Preflight *Preflight
+}
+
+// Preflight configures the checks made before an upload starts.
+type Preflight struct {
+	// Overwrite allows replacing an existing object, otherwise the
+	// destination is checked with a HEAD request and the upload fails with
+	// an *AlreadyExistsError if it exists. Unlike CreateIfAbsent, the check
+	// isn't atomic.
+	Overwrite bool
+
+	// ContentLength is the size of the content about to be uploaded and
+	// MaxSize, if positive, the size it can't exceed, the upload fails with
+	// an *ObjectTooLargeError otherwise. Put checks MaxSize against the size
+	// of its body as well.
+	ContentLength int64
+	MaxSize       int64
+}
+
+// check checks the destination of an upload to uri.
+func (p *Preflight) check(uri string, c *http.Client) error {
+	if p.MaxSize > 0 && p.ContentLength > p.MaxSize {
+		return &ObjectTooLargeError{Size: p.ContentLength, MaxSize: p.MaxSize}
+	}
+	if p.Overwrite {
+		return nil
+	}
+	_, err := Stat(uri, c)
+	switch {
+	case err == nil:
+		return &AlreadyExistsError{&APIError{
+			StatusCode: http.StatusPreconditionFailed,
+			Code:       "PreconditionFailed",
+			Message:    "At least one of the pre-conditions you specified did not hold",
+			Header:     make(http.Header),
+		}}
+	case IsNotFound(err):
+		return nil
+	default:
+		return err
+	}
+}
+
+// md5Header is the metadata header holding the checksum of an object
+// uploaded with an ExpectedMD5.
+const md5Header = "X-Amz-Meta-Content-Md5"
+
+// UploadWriter is the io.WriteCloser returned by Create.
+//
+// Complete must be called to commit the upload, Close is an idempotent
+// teardown which aborts the multipart upload if it wasn't completed.
+type UploadWriter interface {
+	io.WriteCloser
+
+	// Complete uploads any buffered data and completes the multipart upload.
+	// Calling Write after Complete returns an error.
+	Complete() (UploadResult, error)
+}
+
+// PartFlusher is implemented by the UploadWriter returned by Create, so
+// parts can end at boundaries meaningful to the application:
+//
+//	if f, ok := w.(s3.PartFlusher); ok {
+//		err = f.FlushPart()
+//	}
+type PartFlusher interface {
+	// FlushPart uploads the buffered data as a part. Parts other than the
+	// last one can't be smaller than 5MB, a smaller buffer is kept and
+	// uploaded with the next part.
+	FlushPart() error
+}
+
 type part struct {
-	PartNumber int    `xml:"PartNumber"`
-	ETag       string `xml:"ETag"`
+	PartNumber     int    `xml:"PartNumber"`
+	ETag           string `xml:"ETag"`
+	ChecksumCRC32C string `xml:"ChecksumCRC32C,omitempty"`
+	ChecksumSHA256 string `xml:"ChecksumSHA256,omitempty"`
 
 	uploadID string
+	checksum string
 	url      string
 	md5      []byte
 	client   *http.Client
+	header   http.Header
+	expect   bool
 
 	io.ReadSeeker `xml:"-"`
 }
@@ -46,16 +213,45 @@ func (p *part) Upload() error {
 		"partNumber": []string{strconv.Itoa(p.PartNumber)},
 		"uploadId":   []string{p.uploadID},
 	}
+	if p.md5 == nil {
+		// Parts read from an io.ReaderAt are only hashed when uploaded.
+		m := md5.New()
+		if _, err := p.ReadSeeker.Seek(0, 0); err != nil {
+			return err
+		}
+		if _, err := io.Copy(m, p.ReadSeeker); err != nil {
+			return err
+		}
+		p.md5 = m.Sum(nil)
+	}
+	var trailer *aws.Trailer
 	resp, err := retry(func() (*http.Response, error) {
 		_, err := p.ReadSeeker.Seek(0, 0)
 		if err != nil {
 			return nil, err
 		}
-		req, err := http.NewRequest("PUT", p.url+"?"+v.Encode(), p.ReadSeeker)
+		req, err := newRequest("UploadPart", "PUT", p.url+"?"+v.Encode(), p.ReadSeeker)
 		if err != nil {
 			return nil, err
 		}
+		if r, ok := p.ReadSeeker.(*io.SectionReader); ok && req.GetBody == nil {
+			// Make the length and the content known, so the part isn't
+			// sent chunked and its payload can be signed.
+			req.ContentLength = r.Size()
+			req.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(io.NewSectionReader(r, 0, r.Size())), nil
+			}
+		}
+		copyHeader(req.Header, p.header)
 		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(p.md5))
+		if p.expect {
+			req.Header.Set("Expect", "100-continue")
+		}
+		if p.checksum != "" {
+			if trailer, err = aws.SetUnsignedTrailer(req, p.checksum); err != nil {
+				return nil, err
+			}
+		}
 		resp, err := p.client.Do(req)
 		if err != nil {
 			return nil, err
@@ -80,6 +276,14 @@ func (p *part) Upload() error {
 	if eTag := hex.EncodeToString(p.md5); p.ETag != eTag {
 		return fmt.Errorf("s3: mismatching checksum: %q != %q", p.ETag, eTag)
 	}
+	if trailer != nil {
+		switch trailer.Algorithm {
+		case aws.ChecksumCRC32C:
+			p.ChecksumCRC32C = trailer.Checksum()
+		case aws.ChecksumSHA256:
+			p.ChecksumSHA256 = trailer.Checksum()
+		}
+	}
 	return nil
 }
 
@@ -87,75 +291,271 @@ type uploader struct {
 	XMLName string  `xml:"CompleteMultipartUpload"`
 	Parts   []*part `xml:"Part"`
 
-	buf    *bytes.Buffer
-	client *http.Client
-	md5    hash.Hash
-	parts  chan *part
-	wg     sync.WaitGroup
-	w      io.Writer
+	buf      *bytes.Buffer
+	client   *http.Client
+	header   http.Header
+	checksum string
+	absent   bool
+	verify   bool
+	expect   bool
+	md5      hash.Hash
+	parts    chan *part
+	wg       sync.WaitGroup
+	w        io.Writer
 
 	size     int
 	url      string
 	uploadID string
 	err      error
+
+	result    UploadResult
+	completed bool
+	closed    bool
 }
 
 // Create creates an S3 object at url and sends multipart upload requests as
-// data is written.
-func Create(uri string, h http.Header, c *http.Client) (io.WriteCloser, error) {
+// data is written. The object is only committed once Complete is called.
+func Create(uri string, h http.Header, c *http.Client) (UploadWriter, error) {
+	return CreateWithOptions(uri, &UploadOptions{Header: h}, c)
+}
+
+// CreateWithOptions is like Create but allows to configure the upload.
+func CreateWithOptions(uri string, opts *UploadOptions, c *http.Client) (UploadWriter, error) {
+	u := &Uploader{Client: c, Options: opts}
+	return u.Create(uri)
+}
+
+func create(uri string, opts *UploadOptions, c *http.Client) (UploadWriter, error) {
+	up, skipped, err := initiate(uri, opts, c)
+	if err != nil {
+		return nil, err
+	}
+	if skipped != nil {
+		return &skipper{result: *skipped}, nil
+	}
+
+	// Start uploading parts.
+	for i := 0; i < concurrency; i++ {
+		go up.upload()
+	}
+	return up, nil
+}
+
+// unchanged reports whether the object described by info has the given MD5.
+func unchanged(info *ObjectInfo, sum string) bool {
+	if !IsMultipartETag(info.ETag) {
+		return strings.EqualFold(info.ETag, sum)
+	}
+	// Composite ETags aren't a checksum of the content, fallback to the
+	// checksum stored at upload time, if any.
+	return strings.EqualFold(info.Header.Get(md5Header), sum)
+}
+
+// skipper is the UploadWriter returned when an upload is skipped, it
+// discards everything written to it.
+type skipper struct {
+	result    UploadResult
+	completed bool
+	closed    bool
+}
+
+func (s *skipper) Write(p []byte) (int, error) {
+	if s.completed || s.closed {
+		return 0, errCompleted
+	}
+	return len(p), nil
+}
+
+func (s *skipper) FlushPart() error {
+	if s.completed || s.closed {
+		return errCompleted
+	}
+	return nil
+}
+
+func (s *skipper) Complete() (UploadResult, error) {
+	if s.closed && !s.completed {
+		return UploadResult{}, errCompleted
+	}
+	s.completed = true
+	return s.result, nil
+}
+
+func (s *skipper) Close() error {
+	s.closed = true
+	return nil
+}
+
+// uploadHeaders returns the headers creating the object and the headers sent
+// along every request of the upload, unless the upload can be skipped in
+// which case the result of the skipped upload is returned instead.
+func uploadHeaders(uri string, opts *UploadOptions, c *http.Client) (h, common http.Header, skipped *UploadResult, err error) {
+	h = opts.Header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	if err := encodeMetadata(h); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(opts.Tags) > 0 {
+		tags, err := encodeTags(opts.Tags)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		h.Set("X-Amz-Tagging", tags)
+	}
+
+	if opts.ExpectedMD5 != "" {
+		info, err := Stat(uri, c)
+		switch {
+		case err == nil:
+			if unchanged(info, opts.ExpectedMD5) {
+				return nil, nil, &UploadResult{ETag: info.ETag, Unchanged: true}, nil
+			}
+		case !IsNotFound(err):
+			return nil, nil, nil, err
+		}
+		h.Set(md5Header, opts.ExpectedMD5)
+	}
+	if opts.Preflight != nil {
+		if err := opts.Preflight.check(uri, c); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	common = make(http.Header)
+	if opts.RequesterPays {
+		setRequestPayer(common)
+		setRequestPayer(h)
+	}
+	setObjectLock(h, opts.Retention, opts.LegalHold)
+	switch opts.ChecksumAlgorithm {
+	case "":
+	case aws.ChecksumCRC32C, aws.ChecksumSHA256:
+		h.Set("X-Amz-Checksum-Algorithm", opts.ChecksumAlgorithm)
+	default:
+		return nil, nil, nil, errors.New("s3: unsupported checksum algorithm " + opts.ChecksumAlgorithm)
+	}
+	return h, common, nil, nil
+}
+
+// initiate creates a multipart upload, unless the upload can be skipped in
+// which case the result of the skipped upload is returned instead.
+func initiate(uri string, opts *UploadOptions, c *http.Client) (*uploader, *UploadResult, error) {
 	if c == nil {
 		c = DefaultClient
 	}
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	h, common, skipped, err := uploadHeaders(uri, opts, c)
+	if err != nil || skipped != nil {
+		return nil, skipped, err
+	}
 
 	u, err := url.Parse(uri)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	u.Scheme = "https"
 
 	buf := new(bytes.Buffer)
 	m := md5.New()
 	up := &uploader{
-		client: c,
-		size:   minPartSize,
-		buf:    buf,
-		parts:  make(chan *part),
-		url:    u.String(),
-		md5:    m,
-		w:      io.MultiWriter(buf, m),
+		client:   c,
+		header:   common,
+		checksum: opts.ChecksumAlgorithm,
+		absent:   opts.CreateIfAbsent,
+		verify:   opts.VerifyChecksum,
+		expect:   opts.ExpectContinue,
+		size:     minPartSize,
+		buf:      buf,
+		parts:    make(chan *part),
+		url:      u.String(),
+		md5:      m,
+		w:        io.MultiWriter(buf, m),
 	}
 
 	// Create multi-part upload.
-	req, err := http.NewRequest("POST", u.String()+"?uploads", nil)
+	req, err := newRequest("CreateMultipartUpload", "POST", u.String()+"?uploads", nil)
 	if err != nil {
-		return nil, err
-	}
-	for k := range h {
-		for _, v := range h[k] {
-			req.Header.Add(k, v)
-		}
+		return nil, nil, err
 	}
+	copyHeader(req.Header, h)
 	resp, err := retry(retryNoBody(up.client, req), retries)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return nil, newResponseError(resp)
+		return nil, nil, newResponseError(resp)
 	}
 	var mu struct {
 		UploadID string `xml:"UploadId"`
 	}
 	if err := xml.NewDecoder(resp.Body).Decode(&mu); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	up.uploadID = mu.UploadID
+	return up, nil, nil
+}
 
-	// Start uploading parts.
+// UploadReaderAt uploads size bytes read from r to an S3 object at uri. Parts
+// are read directly from r and uploaded in parallel.
+func UploadReaderAt(uri string, r io.ReaderAt, size int64, opts *UploadOptions, c *http.Client) (UploadResult, error) {
+	up, skipped, err := initiate(uri, opts, c)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if skipped != nil {
+		return *skipped, nil
+	}
+
+	partSize := partSizeOf(size)
 	for i := 0; i < concurrency; i++ {
 		go up.upload()
 	}
-	return up, nil
+	n := (size + partSize - 1) / partSize
+	if n == 0 {
+		// Empty objects are uploaded as a single empty part.
+		n = 1
+	}
+	for i := int64(0); i < n; i++ {
+		off := i * partSize
+		p := &part{
+			PartNumber: len(up.Parts) + 1,
+			ReadSeeker: io.NewSectionReader(r, off, min64(partSize, size-off)),
+			url:        up.url,
+			client:     up.client,
+			header:     up.header,
+			checksum:   up.checksum,
+			uploadID:   up.uploadID,
+			expect:     up.expect,
+		}
+		up.Parts = append(up.Parts, p)
+		up.wg.Add(1)
+		up.parts <- p
+	}
+	up.wg.Wait()
+	close(up.parts)
+	if up.err != nil {
+		up.abort()
+		return UploadResult{}, up.err
+	}
+	result, err := up.complete()
+	if err != nil {
+		up.abort()
+	}
+	return result, err
+}
+
+// partSizeOf returns the size of the parts of an object of the given size,
+// uploaded from an io.ReaderAt.
+func partSizeOf(size int64) int64 {
+	partSize := int64(minPartSize)
+	if s := (size + maxParts - 1) / maxParts; s > partSize {
+		partSize = s
+	}
+	return partSize
 }
 
 func (u *uploader) upload() {
@@ -172,10 +572,11 @@ func (u *uploader) abort() {
 	v := url.Values{
 		"uploadId": []string{u.uploadID},
 	}
-	req, err := http.NewRequest("DELETE", u.url+"?"+v.Encode(), nil)
+	req, err := newRequest("AbortMultipartUpload", "DELETE", u.url+"?"+v.Encode(), nil)
 	if err != nil {
 		return
 	}
+	copyHeader(req.Header, u.header)
 	resp, err := retry(retryNoBody(u.client, req), retries)
 	if err != nil {
 		return
@@ -184,6 +585,9 @@ func (u *uploader) abort() {
 }
 
 func (u *uploader) Write(p []byte) (int, error) {
+	if u.completed || u.closed {
+		return 0, errCompleted
+	}
 	if u.err != nil {
 		u.abort()
 		return 0, u.err
@@ -213,6 +617,20 @@ func (u *uploader) ReadFrom(r io.Reader) (n int64, err error) {
 	}
 }
 
+func (u *uploader) FlushPart() error {
+	if u.completed || u.closed {
+		return errCompleted
+	}
+	if u.err != nil {
+		u.abort()
+		return u.err
+	}
+	if u.buf.Len() >= minPartSize {
+		u.flush()
+	}
+	return nil
+}
+
 func (u *uploader) flush() {
 	u.wg.Add(1)
 	u.size = min(u.size+u.size/1000, maxPartSize)
@@ -223,7 +641,10 @@ func (u *uploader) flush() {
 		ReadSeeker: bytes.NewReader(b),
 		url:        u.url,
 		client:     u.client,
+		header:     u.header,
+		checksum:   u.checksum,
 		uploadID:   u.uploadID,
+		expect:     u.expect,
 		md5:        c,
 	}
 	u.Parts = append(u.Parts, p)
@@ -232,10 +653,19 @@ func (u *uploader) flush() {
 	u.md5.Reset()
 }
 
-func (u *uploader) complete() error {
+func (u *uploader) complete() (UploadResult, error) {
+	var result UploadResult
 	body, err := xml.Marshal(u)
 	if err != nil {
-		return err
+		return result, err
+	}
+	// S3 validates the assembled object against the checksum computed
+	// from the checksums of the parts, if any.
+	var sum string
+	if u.checksum != "" {
+		if sum, err = u.compositeChecksum(); err != nil {
+			return result, err
+		}
 	}
 	b := bytes.NewReader(body)
 	v := url.Values{
@@ -245,10 +675,19 @@ func (u *uploader) complete() error {
 		if _, err := b.Seek(0, 0); err != nil {
 			return nil, err
 		}
-		req, err := http.NewRequest("POST", u.url+"?"+v.Encode(), b)
+		req, err := newRequest("CompleteMultipartUpload", "POST", u.url+"?"+v.Encode(), b)
 		if err != nil {
 			return nil, err
 		}
+		copyHeader(req.Header, u.header)
+		if u.absent {
+			req.Header.Set("If-None-Match", "*")
+		}
+		if sum != "" {
+			// The expected checksum is sent without the part count.
+			req.Header.Set("X-Amz-Checksum-"+u.checksum, trimPartCount(sum))
+			req.Header.Set("X-Amz-Checksum-Type", "COMPOSITE")
+		}
 		resp, err := u.client.Do(req)
 		if err != nil {
 			return nil, err
@@ -259,41 +698,152 @@ func (u *uploader) complete() error {
 		return resp, nil
 	}, retries)
 	if err != nil {
-		return err
+		return result, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPreconditionFailed && u.absent {
+		return result, &AlreadyExistsError{newResponseError(resp)}
+	}
 	if resp.StatusCode != 200 {
-		return newResponseError(resp)
+		return result, newResponseError(resp)
 	}
-	defer resp.Body.Close()
 	var e struct {
-		XMLName string `xml:"CompleteMultipartUploadResult"`
-		ETag    string `xml:"ETag"`
+		XMLName        string `xml:"CompleteMultipartUploadResult"`
+		Location       string `xml:"Location"`
+		ETag           string `xml:"ETag"`
+		ChecksumCRC32C string `xml:"ChecksumCRC32C"`
+		ChecksumSHA256 string `xml:"ChecksumSHA256"`
 	}
 	if err := xml.NewDecoder(resp.Body).Decode(&e); err != nil {
-		return err
+		return result, err
 	}
 	r := strings.Split(strings.Trim(e.ETag, "\""), "-")[0]
 	if len(r) == 0 {
-		return fmt.Errorf("s3: no checksum found")
+		return result, fmt.Errorf("s3: no checksum found")
 	}
 	u.md5.Reset()
 	for _, p := range u.Parts {
 		u.md5.Write(p.md5)
 	}
 	if hex.EncodeToString(u.md5.Sum(nil)) != r {
-		return fmt.Errorf("s3: mismatching checksum: %q", e.ETag)
+		return result, fmt.Errorf("s3: mismatching checksum: %q", e.ETag)
+	}
+	result.ETag = strings.Trim(e.ETag, "\"")
+	result.Location = e.Location
+	result.Checksum = e.ChecksumCRC32C + e.ChecksumSHA256
+	// The part count isn't always suffixed.
+	if sum != "" && result.Checksum != "" && trimPartCount(result.Checksum) != trimPartCount(sum) {
+		return UploadResult{}, &ChecksumMismatchError{Expected: sum, Actual: result.Checksum}
+	}
+	if u.verify {
+		if err := u.verifyChecksum(); err != nil {
+			return UploadResult{}, err
+		}
+	}
+	return result, nil
+}
+
+// compositeChecksum returns the checksum of the object computed from the
+// checksums of the uploaded parts, it's empty if a part has none.
+func (u *uploader) compositeChecksum() (string, error) {
+	sums := make([]string, len(u.Parts))
+	for i, p := range u.Parts {
+		if sums[i] = p.ChecksumCRC32C + p.ChecksumSHA256; sums[i] == "" {
+			return "", nil
+		}
+	}
+	return compositeChecksum(u.checksum, sums)
+}
+
+// trimPartCount returns a composite checksum without its "-N" part count
+// suffix, base64 checksums never contain a dash.
+func trimPartCount(sum string) string {
+	if i := strings.IndexByte(sum, '-'); i >= 0 {
+		return sum[:i]
+	}
+	return sum
+}
+
+// verifyChecksum checks the checksum of the completed object against the one
+// computed from the uploaded parts, their MD5 without ChecksumAlgorithm.
+func (u *uploader) verifyChecksum() error {
+	var (
+		expected string
+		actual   func(*ObjectAttributes) string
+	)
+	switch u.checksum {
+	case "":
+		m := md5.New()
+		for _, p := range u.Parts {
+			m.Write(p.md5)
+		}
+		expected = fmt.Sprintf("%s-%d", hex.EncodeToString(m.Sum(nil)), len(u.Parts))
+		actual = func(a *ObjectAttributes) string { return a.ETag }
+	default:
+		var err error
+		if expected, err = u.compositeChecksum(); err != nil {
+			return err
+		}
+		actual = func(a *ObjectAttributes) string {
+			sum := a.ChecksumCRC32C + a.ChecksumSHA256
+			if !strings.Contains(sum, "-") && a.PartCount > 0 {
+				// The part count isn't always suffixed.
+				sum += "-" + strconv.Itoa(a.PartCount)
+			}
+			return sum
+		}
+	}
+	a, err := GetObjectAttributes(u.url, u.client)
+	if err != nil {
+		return err
+	}
+	if got := actual(a); got != expected {
+		return &ChecksumMismatchError{Expected: expected, Actual: got}
 	}
 	return nil
 }
 
-func (u *uploader) Close() error {
-	u.flush()
+// Complete uploads the remaining buffered data and completes the multipart
+// upload. Subsequent calls return the same result.
+func (u *uploader) Complete() (UploadResult, error) {
+	if u.completed {
+		return u.result, nil
+	}
+	if u.closed {
+		return UploadResult{}, errCompleted
+	}
+	if u.buf.Len() > 0 || len(u.Parts) == 0 {
+		// Empty objects are uploaded as a single empty part.
+		u.flush()
+	}
 	u.wg.Wait()
 	if u.err != nil {
-		return u.err
+		return UploadResult{}, u.err
+	}
+	result, err := u.complete()
+	if err != nil {
+		return result, err
+	}
+	close(u.parts)
+	u.result = result
+	u.completed = true
+	return result, nil
+}
+
+// Close aborts the multipart upload unless it was completed. It is safe to
+// call Close multiple times.
+func (u *uploader) Close() error {
+	if u.closed {
+		return nil
+	}
+	u.closed = true
+	if u.completed {
+		return nil
 	}
-	return u.complete()
+	u.wg.Wait()
+	close(u.parts)
+	u.abort()
+	return nil
 }
 
 func min(a, b int) int {
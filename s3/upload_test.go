@@ -1,8 +1,27 @@
 package s3
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyberdelia/aws"
 )
 
 func ExampleCreate() {
@@ -11,5 +30,468 @@ func ExampleCreate() {
 	if err != nil {
 		return
 	}
-	io.Copy(w, f)
+	defer w.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return
+	}
+	if _, err := w.Complete(); err != nil {
+		return
+	}
+}
+
+func TestUploadComplete(t *testing.T) {
+	f, ts := newFakeS3(t)
+	w, err := Create(uri(ts, "/bucket/file.txt"), nil, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	result, err := w.Complete()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(result.ETag, "-1") {
+		t.Errorf("unexpected etag %q", result.ETag)
+	}
+	if !strings.HasSuffix(result.Location, "/bucket/file.txt") {
+		t.Errorf("unexpected location %q", result.Location)
+	}
+	if b, _ := f.get("/bucket/file.txt"); string(b) != "hello world" {
+		t.Errorf("unexpected content %q", b)
+	}
+	if again, err := w.Complete(); err != nil || again != result {
+		t.Errorf("expected Complete to return the same result, got %v, %v", again, err)
+	}
+	if _, err := w.Write([]byte("more")); err != errCompleted {
+		t.Errorf("expected write after complete to fail, got %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+	for _, r := range f.recorded() {
+		if r.Method == "DELETE" {
+			t.Errorf("unexpected abort after complete: %s", r.URL)
+		}
+	}
+}
+
+func TestUploadCloseAborts(t *testing.T) {
+	f, ts := newFakeS3(t)
+	w, err := Create(uri(ts, "/bucket/file.txt"), nil, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("expected Close to be idempotent, got %v", err)
+	}
+	if _, ok := f.get("/bucket/file.txt"); ok {
+		t.Error("object should not have been created")
+	}
+	var aborts int
+	for _, r := range f.recorded() {
+		if r.Method == "DELETE" && strings.Contains(r.URL, "uploadId=1") {
+			aborts++
+		}
+	}
+	if aborts != 1 {
+		t.Errorf("expected one abort request, got %d", aborts)
+	}
+	if _, err := w.Write([]byte("more")); err != errCompleted {
+		t.Errorf("expected write after close to fail, got %v", err)
+	}
+}
+
+func TestUploadExpectedMD5(t *testing.T) {
+	content := []byte("hello world")
+	sum := md5.Sum(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	var tests = []struct {
+		Name      string
+		Remote    []byte
+		Meta      http.Header
+		Unchanged bool
+	}{
+		{Name: "match", Remote: content, Unchanged: true},
+		{Name: "mismatch", Remote: []byte("goodbye world")},
+		{Name: "missing"},
+		{
+			Name:      "composite with stored checksum",
+			Remote:    content,
+			Meta:      http.Header{"Etag": {`"abc-2"`}, md5Header: {checksum}},
+			Unchanged: true,
+		},
+		{
+			Name:   "composite without stored checksum",
+			Remote: content,
+			Meta:   http.Header{"Etag": {`"abc-2"`}},
+		},
+	}
+	for _, test := range tests {
+		f, ts := newFakeS3(t)
+		if test.Remote != nil {
+			f.put("/bucket/file.txt", test.Remote)
+			f.meta["/bucket/file.txt"] = test.Meta
+		}
+		w, err := CreateWithOptions(uri(ts, "/bucket/file.txt"), &UploadOptions{ExpectedMD5: checksum}, ts.Client())
+		if err != nil {
+			t.Fatalf("%s: %v", test.Name, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			t.Fatalf("%s: %v", test.Name, err)
+		}
+		result, err := w.Complete()
+		if err != nil {
+			t.Fatalf("%s: %v", test.Name, err)
+		}
+		w.Close()
+		if result.Unchanged != test.Unchanged {
+			t.Errorf("%s: expected unchanged to be %t", test.Name, test.Unchanged)
+		}
+		var initiated bool
+		for _, r := range f.recorded() {
+			if r.Method == "POST" && strings.HasSuffix(r.URL, "?uploads") {
+				initiated = true
+				if r.Header.Get(md5Header) != checksum {
+					t.Errorf("%s: expected checksum to be stored, got %q", test.Name, r.Header.Get(md5Header))
+				}
+			}
+		}
+		if initiated == test.Unchanged {
+			t.Errorf("%s: expected upload to be skipped: %t", test.Name, test.Unchanged)
+		}
+		if b, _ := f.get("/bucket/file.txt"); !bytes.Equal(b, content) && !test.Unchanged {
+			t.Errorf("%s: unexpected content %q", test.Name, b)
+		}
+	}
+}
+
+func TestUploadReaderAt(t *testing.T) {
+	defer func(n int) { concurrency = n }(concurrency)
+	concurrency = 4
+
+	f, ts := newFakeS3(t)
+	var mu sync.Mutex
+	var order []string
+	others := make(chan bool, 2)
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		n := r.URL.Query().Get("partNumber")
+		if n == "1" {
+			// Let the other parts complete first.
+			for i := 0; i < 2; i++ {
+				select {
+				case <-others:
+				case <-time.After(5 * time.Second):
+				}
+			}
+		}
+		if n != "" {
+			mu.Lock()
+			order = append(order, n)
+			mu.Unlock()
+		}
+		if n != "" && n != "1" {
+			others <- true
+		}
+		return false
+	}
+	payload := make([]byte, 2*minPartSize+minPartSize/2)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	result, err := UploadReaderAt(uri(ts, "/bucket/file.bin"), bytes.NewReader(payload), int64(len(payload)), nil, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(result.ETag, "-3") {
+		t.Errorf("expected 3 parts, got %q", result.ETag)
+	}
+	if b, _ := f.get("/bucket/file.bin"); !bytes.Equal(b, payload) {
+		t.Error("unexpected content")
+	}
+	var sizes []int
+	for _, r := range f.recorded() {
+		if r.Method == "PUT" {
+			sizes = append(sizes, int(r.ContentLength))
+		}
+	}
+	sort.Ints(sizes)
+	if expected := []int{minPartSize / 2, minPartSize, minPartSize}; !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("expected part sizes %v, got %v", expected, sizes)
+	}
+	if len(order) != 3 || order[len(order)-1] != "1" {
+		t.Errorf("expected part 1 to complete last, got %v", order)
+	}
+}
+
+func TestUploadChecksumTrailer(t *testing.T) {
+	for _, algorithm := range []string{aws.ChecksumCRC32C, aws.ChecksumSHA256} {
+		f, ts := newFakeS3(t)
+		payload := make([]byte, minPartSize+1024)
+		rand.New(rand.NewSource(1)).Read(payload)
+
+		w, err := CreateWithOptions(uri(ts, "/bucket/file.bin"), &UploadOptions{ChecksumAlgorithm: algorithm}, ts.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		if _, err := w.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+		result, err := w.Complete()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := f.get("/bucket/file.bin"); !bytes.Equal(b, payload) {
+			t.Errorf("%s: unexpected content", algorithm)
+		}
+		// The composite checksum is computed from the parts as sent.
+		var sums []string
+		for _, r := range f.recorded() {
+			if r.Method == "PUT" {
+				u, _ := url.Parse(r.URL)
+				n, _ := strconv.Atoi(u.Query().Get("partNumber"))
+				size, _ := strconv.Atoi(r.Header.Get("X-Amz-Decoded-Content-Length"))
+				for len(sums) < n {
+					sums = append(sums, "")
+				}
+				start := (n - 1) * minPartSize
+				sums[n-1] = checksum(algorithm, payload[start:start+size])
+			}
+		}
+		h := newHash(algorithm)
+		for _, sum := range sums {
+			b, _ := base64.StdEncoding.DecodeString(sum)
+			h.Write(b)
+		}
+		expected := base64.StdEncoding.EncodeToString(h.Sum(nil))
+		// The checksum is returned as reported by S3.
+		if reported := fmt.Sprintf("%s-%d", expected, len(sums)); result.Checksum != reported {
+			t.Errorf("%s: expected checksum %q, got %q", algorithm, reported, result.Checksum)
+		}
+		for _, r := range f.recorded() {
+			switch {
+			case r.Method == "POST" && strings.HasSuffix(r.URL, "?uploads"):
+				if a := r.Header.Get("X-Amz-Checksum-Algorithm"); a != algorithm {
+					t.Errorf("%s: unexpected checksum algorithm %q", algorithm, a)
+				}
+			case r.Method == "POST":
+				// The checksum of the object is sent to be validated on
+				// completion.
+				if sum := r.Header.Get("X-Amz-Checksum-" + algorithm); sum != expected || r.Header.Get("X-Amz-Checksum-Type") != "COMPOSITE" {
+					t.Errorf("%s: unexpected completion checksum %q", algorithm, sum)
+				}
+			case r.Method == "PUT":
+				if tr := r.Header.Get("X-Amz-Trailer"); tr != "x-amz-checksum-"+strings.ToLower(algorithm) {
+					t.Errorf("%s: unexpected trailer %q", algorithm, tr)
+				}
+			}
+		}
+	}
+	if _, err := CreateWithOptions("s3://s3.amazonaws.com/bucket/file.bin", &UploadOptions{ChecksumAlgorithm: "MD5"}, nil); err == nil {
+		t.Error("expected an unsupported algorithm error")
+	}
+}
+
+func TestUploadPreflight(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.put("/bucket/file.txt", []byte("original"))
+	upload := func(p *Preflight) error {
+		w, err := CreateWithOptions(uri(ts, "/bucket/file.txt"), &UploadOptions{Preflight: p}, ts.Client())
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		if _, err := w.Write([]byte("replaced")); err != nil {
+			return err
+		}
+		_, err = w.Complete()
+		return err
+	}
+
+	err := upload(&Preflight{})
+	var exists *AlreadyExistsError
+	if !errors.As(err, &exists) {
+		t.Fatalf("expected an already exists error, got %v", err)
+	}
+	if exists.StatusCode != 412 || exists.Code != "PreconditionFailed" {
+		t.Errorf("expected a precondition failure, got %d %s", exists.StatusCode, exists.Code)
+	}
+	for _, r := range f.recorded() {
+		if r.Method != "HEAD" {
+			t.Errorf("expected the upload not to start, got %s %s", r.Method, r.URL)
+		}
+	}
+	if b, _ := f.get("/bucket/file.txt"); string(b) != "original" {
+		t.Errorf("expected the object to be kept, got %q", b)
+	}
+
+	if err := upload(&Preflight{Overwrite: true}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := f.get("/bucket/file.txt"); string(b) != "replaced" {
+		t.Errorf("expected the object to be replaced, got %q", b)
+	}
+
+	n := len(f.recorded())
+	err = upload(&Preflight{Overwrite: true, ContentLength: 1024, MaxSize: 512})
+	var e *ObjectTooLargeError
+	if !errors.As(err, &e) || e.Size != 1024 || e.MaxSize != 512 {
+		t.Errorf("expected an object too large error, got %v", err)
+	}
+	if len(f.recorded()) != n {
+		t.Error("expected no request to be sent")
+	}
+
+	// Put checks the size of its body.
+	_, err = Put(uri(ts, "/bucket/file.txt"), bytes.NewReader(make([]byte, 1024)), &UploadOptions{Preflight: &Preflight{Overwrite: true, MaxSize: 512}}, ts.Client())
+	if !errors.As(err, &e) || e.Size != 1024 || e.MaxSize != 512 {
+		t.Errorf("expected an object too large error, got %v", err)
+	}
+	if len(f.recorded()) != n {
+		t.Error("expected no request to be sent")
+	}
+}
+
+func TestUploadCreateIfAbsent(t *testing.T) {
+	f, ts := newFakeS3(t)
+	upload := func() error {
+		w, err := CreateWithOptions(uri(ts, "/bucket/lock"), &UploadOptions{CreateIfAbsent: true}, ts.Client())
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		if _, err := w.Write([]byte("owner")); err != nil {
+			return err
+		}
+		_, err = w.Complete()
+		return err
+	}
+	if err := upload(); err != nil {
+		t.Fatal(err)
+	}
+	err := upload()
+	if !IsAlreadyExists(err) {
+		t.Fatalf("expected an already exists error, got %v", err)
+	}
+	var e *APIError
+	if !errors.As(err, &e) || e.StatusCode != 412 {
+		t.Errorf("expected the API error to be wrapped, got %v", err)
+	}
+	for _, r := range f.recorded() {
+		if r.Method == "POST" && strings.Contains(r.URL, "uploadId") && r.Header.Get("If-None-Match") != "*" {
+			t.Error("expected completion to be conditional")
+		}
+	}
+}
+
+func TestUploadVerifyChecksum(t *testing.T) {
+	payload := make([]byte, minPartSize+1024)
+	rand.New(rand.NewSource(1)).Read(payload)
+	upload := func(ts *httptest.Server, algorithm string) error {
+		opts := &UploadOptions{ChecksumAlgorithm: algorithm, VerifyChecksum: true}
+		w, err := CreateWithOptions(uri(ts, "/bucket/file.bin"), opts, ts.Client())
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		if _, err := w.Write(payload); err != nil {
+			return err
+		}
+		_, err = w.Complete()
+		return err
+	}
+	for _, algorithm := range []string{"", aws.ChecksumCRC32C, aws.ChecksumSHA256} {
+		f, ts := newFakeS3(t)
+		if err := upload(ts, algorithm); err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if r := f.recorded(); !strings.HasSuffix(r[len(r)-1].URL, "?attributes") {
+			t.Errorf("%s: expected the attributes to be fetched, got %s", algorithm, r[len(r)-1].URL)
+		}
+
+		f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+			if _, ok := r.URL.Query()["attributes"]; !ok {
+				return false
+			}
+			fmt.Fprint(w, "<GetObjectAttributesResponse><ETag>d41d8cd98f00b204e9800998ecf8427e-2</ETag><Checksum><ChecksumCRC32C>AAAAAA==-2</ChecksumCRC32C><ChecksumSHA256>47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=-2</ChecksumSHA256></Checksum></GetObjectAttributesResponse>")
+			return true
+		}
+		err := upload(ts, algorithm)
+		var e *ChecksumMismatchError
+		if !errors.As(err, &e) {
+			t.Fatalf("%s: expected a checksum mismatch, got %v", algorithm, err)
+		}
+		if e.Expected == e.Actual || !strings.HasSuffix(e.Expected, "-1") {
+			t.Errorf("%s: unexpected mismatch %+v", algorithm, e)
+		}
+	}
+}
+
+func TestUploadFlushPart(t *testing.T) {
+	f, ts := newFakeS3(t)
+	uw, err := Create(uri(ts, "/bucket/records.bin"), nil, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uw.Close()
+	w, ok := uw.(interface {
+		UploadWriter
+		PartFlusher
+	})
+	if !ok {
+		t.Fatal("expected the writer to flush parts")
+	}
+	parts := func() int {
+		var n int
+		for _, r := range f.recorded() {
+			if r.Method == "PUT" {
+				n++
+			}
+		}
+		return n
+	}
+
+	small := bytes.Repeat([]byte("a"), 1024)
+	if _, err := w.Write(small); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.FlushPart(); err != nil {
+		t.Fatal(err)
+	}
+	if n := parts(); n != 0 {
+		t.Errorf("expected parts below 5MB to be buffered, got %d parts", n)
+	}
+
+	record := bytes.Repeat([]byte("b"), minPartSize)
+	if _, err := w.Write(record[:minPartSize-1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.FlushPart(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("next record")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for _, r := range f.recorded() {
+		if r.Method == "PUT" {
+			sizes = append(sizes, int(r.ContentLength))
+		}
+	}
+	sort.Ints(sizes)
+	if expected := []int{11, minPartSize + 1023}; !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("expected part sizes %v, got %v", expected, sizes)
+	}
 }
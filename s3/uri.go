@@ -0,0 +1,45 @@
+package s3
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/cyberdelia/aws"
+)
+
+// dnsBucketRegexp matches bucket names usable as a host name over TLS,
+// buckets with dots don't match the wildcard certificate of S3.
+var dnsBucketRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// ParseS3URI parses an s3://bucket/key URI, as used by the AWS CLI, and
+// returns the https URL of the object in region, along with its bucket and
+// key. The URL is virtual-hosted, unless the bucket name isn't a valid host
+// name in which case it is path-style. The key is taken as is, it must not
+// be percent-encoded, and is encoded in the URL. Region defaults to
+// us-east-1.
+func ParseS3URI(s3uri, region string) (httpsURL, bucket, key string, err error) {
+	if !strings.HasPrefix(s3uri, "s3://") {
+		return "", "", "", errors.New("s3: URI doesn't start with s3://")
+	}
+	bucket = strings.TrimPrefix(s3uri, "s3://")
+	if i := strings.Index(bucket, "/"); i >= 0 {
+		bucket, key = bucket[:i], bucket[i+1:]
+	}
+	if bucket == "" {
+		return "", "", "", errors.New("s3: URI without bucket")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	host, err := Endpoint(region, nil)
+	if err != nil {
+		return "", "", "", err
+	}
+	if dnsBucketRegexp.MatchString(bucket) {
+		httpsURL = "https://" + bucket + "." + host + "/" + aws.EscapePath(key)
+	} else {
+		httpsURL = "https://" + host + "/" + aws.EscapePath(bucket) + "/" + aws.EscapePath(key)
+	}
+	return httpsURL, bucket, key, nil
+}
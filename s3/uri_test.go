@@ -0,0 +1,67 @@
+package s3
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseS3URI(t *testing.T) {
+	var tests = []struct {
+		URI    string
+		Region string
+		URL    string
+		Bucket string
+		Key    string
+	}{
+		{"s3://bucket/key.txt", "us-west-2", "https://bucket.s3.us-west-2.amazonaws.com/key.txt", "bucket", "key.txt"},
+		{"s3://bucket/a/b/c/key.txt", "eu-west-1", "https://bucket.s3.eu-west-1.amazonaws.com/a/b/c/key.txt", "bucket", "a/b/c/key.txt"},
+		{"s3://bucket/my folder/a+b#c?.txt", "", "https://bucket.s3.us-east-1.amazonaws.com/my%20folder/a%2Bb%23c%3F.txt", "bucket", "my folder/a+b#c?.txt"},
+		{"s3://bucket/日本/café.txt", "us-east-1", "https://bucket.s3.us-east-1.amazonaws.com/%E6%97%A5%E6%9C%AC/caf%C3%A9.txt", "bucket", "日本/café.txt"},
+		{"s3://my.bucket/key.txt", "us-west-2", "https://s3.us-west-2.amazonaws.com/my.bucket/key.txt", "my.bucket", "key.txt"},
+		{"s3://bucket", "us-west-2", "https://bucket.s3.us-west-2.amazonaws.com/", "bucket", ""},
+		{"s3://bucket/", "cn-north-1", "https://bucket.s3.cn-north-1.amazonaws.com.cn/", "bucket", ""},
+	}
+	for _, test := range tests {
+		u, bucket, key, err := ParseS3URI(test.URI, test.Region)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u != test.URL || bucket != test.Bucket || key != test.Key {
+			t.Errorf("%s: expected %s %q %q, got %s %q %q", test.URI, test.URL, test.Bucket, test.Key, u, bucket, key)
+		}
+		p, err := url.Parse(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, k := splitBucket(p); k != test.Key {
+			t.Errorf("%s: expected key %q to round trip, got %q", test.URI, test.Key, k)
+		}
+	}
+	for _, test := range []struct{ URI, Region string }{
+		{"https://bucket/key", ""},
+		{"s3:///key", ""},
+		{"s3://bucket/key", "moon-1"},
+	} {
+		if _, _, _, err := ParseS3URI(test.URI, test.Region); err == nil {
+			t.Errorf("%s: expected an error", test.URI)
+		}
+	}
+}
+
+func TestSplitBucket(t *testing.T) {
+	for _, test := range []struct{ URL, Bucket, Key string }{
+		{"https://bucket.s3.us-west-2.amazonaws.com/a/b.txt", "bucket", "a/b.txt"},
+		{"https://a.s3.b.s3.amazonaws.com/key", "a.s3.b", "key"},
+		{"https://a.s3.b.s3-us-west-2.amazonaws.com/key", "a.s3.b", "key"},
+		{"https://s3.us-west-2.amazonaws.com/my.bucket/key", "my.bucket", "key"},
+		{"https://127.0.0.1:9000/bucket", "bucket", ""},
+	} {
+		u, err := url.Parse(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bucket, key := splitBucket(u); bucket != test.Bucket || key != test.Key {
+			t.Errorf("%s: expected %q %q, got %q %q", test.URL, test.Bucket, test.Key, bucket, key)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// VersionInfo describes a version of an object, or a delete marker, in a
+// versioned bucket.
+type VersionInfo struct {
+	Key            string
+	VersionID      string
+	IsLatest       bool
+	IsDeleteMarker bool
+	LastModified   time.Time
+
+	// ETag, Size and StorageClass aren't set for delete markers.
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+// WalkVersions calls fn for each version and delete marker of the objects in
+// the bucket at bucketURL. A prefix can follow the bucket name. Iteration
+// stops at the first error returned by fn.
+func WalkVersions(bucketURL string, fn func(VersionInfo) error, c *http.Client) error {
+	if c == nil {
+		c = DefaultClient
+	}
+
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return err
+	}
+	u, prefix, err := bucketPrefix(u)
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{
+		"versions": []string{""},
+	}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	for {
+		u.RawQuery = q.Encode()
+		req, err := newRequest("ListObjectVersions", "GET", u.String(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := retry(retryNoBody(c, req), retries)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != 200 {
+			err := newResponseError(resp)
+			resp.Body.Close()
+			return err
+		}
+		var l struct {
+			Truncated           bool   `xml:"IsTruncated"`
+			NextKeyMarker       string `xml:"NextKeyMarker"`
+			NextVersionIDMarker string `xml:"NextVersionIdMarker"`
+			// Versions and delete markers are interleaved, keep their
+			// order.
+			Entries []struct {
+				XMLName      xml.Name
+				Key          string
+				VersionID    string `xml:"VersionId"`
+				IsLatest     bool
+				LastModified string
+				ETag         string
+				Size         int64
+				StorageClass string
+			} `xml:",any"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&l)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, e := range l.Entries {
+			if e.XMLName.Local != "Version" && e.XMLName.Local != "DeleteMarker" {
+				continue
+			}
+			modTime, _ := time.Parse(time.RFC3339Nano, e.LastModified)
+			v := VersionInfo{
+				Key:            e.Key,
+				VersionID:      e.VersionID,
+				IsLatest:       e.IsLatest,
+				IsDeleteMarker: e.XMLName.Local == "DeleteMarker",
+				LastModified:   modTime,
+				ETag:           strings.Trim(e.ETag, `"`),
+				Size:           e.Size,
+				StorageClass:   e.StorageClass,
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		if !l.Truncated {
+			return nil
+		}
+		q.Set("key-marker", l.NextKeyMarker)
+		q.Set("version-id-marker", l.NextVersionIDMarker)
+	}
+}
+
+// PurgeOptions configures PurgeVersions.
+type PurgeOptions struct {
+	// DryRun only counts the versions and delete markers which would be
+	// deleted.
+	DryRun bool
+}
+
+// PurgeVersions deletes every version and delete marker of the objects under
+// the prefix at prefixURI, batching them in multi-object delete requests.
+// It returns the number of versions deleted, the versions which couldn't be
+// deleted are reported in a *BatchError once every batch was attempted.
+func PurgeVersions(prefixURI string, c *http.Client) (deleted int, err error) {
+	return PurgeVersionsWithOptions(prefixURI, nil, c)
+}
+
+// PurgeVersionsWithOptions is like PurgeVersions but allows to configure the
+// purge.
+func PurgeVersionsWithOptions(prefixURI string, opts *PurgeOptions, c *http.Client) (deleted int, err error) {
+	if opts == nil {
+		opts = &PurgeOptions{}
+	}
+	u, err := url.Parse(prefixURI)
+	if err != nil {
+		return 0, err
+	}
+	b, _, err := bucketPrefix(u)
+	if err != nil {
+		return 0, err
+	}
+	bucket := b.String()
+
+	var (
+		batch  []ObjectIdentifier
+		failed BatchError
+	)
+	flush := func() error {
+		if opts.DryRun {
+			deleted += len(batch)
+			batch = batch[:0]
+			return nil
+		}
+		errs, err := DeleteObjects(bucket, batch, c)
+		if err != nil {
+			return err
+		}
+		deleted += len(batch) - len(errs)
+		for i := range errs {
+			failed.Errors = append(failed.Errors, &BatchItemError{Key: errs[i].Key, Err: &errs[i]})
+		}
+		batch = batch[:0]
+		return nil
+	}
+	err = WalkVersions(prefixURI, func(v VersionInfo) error {
+		batch = append(batch, ObjectIdentifier{Key: v.Key, VersionID: v.VersionID})
+		if len(batch) == maxDeleteObjects {
+			return flush()
+		}
+		return nil
+	}, c)
+	if err != nil {
+		return deleted, err
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return deleted, err
+		}
+	}
+	if len(failed.Errors) > 0 {
+		failed.sort()
+		return deleted, &failed
+	}
+	return deleted, nil
+}
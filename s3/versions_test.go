@@ -0,0 +1,197 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWalkVersions(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		q := r.URL.Query()
+		if q.Get("key-marker") == "" {
+			w.Write([]byte(`<ListVersionsResult>
+				<Name>bucket</Name>
+				<Prefix>logs/</Prefix>
+				<IsTruncated>true</IsTruncated>
+				<NextKeyMarker>logs/a.txt</NextKeyMarker>
+				<NextVersionIdMarker>v2</NextVersionIdMarker>
+				<DeleteMarker>
+					<Key>logs/a.txt</Key><VersionId>v3</VersionId><IsLatest>true</IsLatest>
+					<LastModified>2009-10-12T17:50:30.000Z</LastModified>
+				</DeleteMarker>
+				<Version>
+					<Key>logs/a.txt</Key><VersionId>v2</VersionId><IsLatest>false</IsLatest>
+					<LastModified>2009-10-11T17:50:30.000Z</LastModified>
+					<ETag>&quot;abc&quot;</ETag><Size>10</Size><StorageClass>STANDARD</StorageClass>
+				</Version>
+			</ListVersionsResult>`))
+			return true
+		}
+		if q.Get("version-id-marker") != "v2" {
+			writeError(w, 400, "InvalidArgument")
+			return true
+		}
+		w.Write([]byte(`<ListVersionsResult>
+			<IsTruncated>false</IsTruncated>
+			<Version>
+				<Key>logs/b.txt</Key><VersionId>v1</VersionId><IsLatest>true</IsLatest>
+				<LastModified>2009-10-10T17:50:30.000Z</LastModified>
+				<ETag>&quot;def&quot;</ETag><Size>20</Size><StorageClass>STANDARD</StorageClass>
+			</Version>
+		</ListVersionsResult>`))
+		return true
+	}
+
+	var versions []VersionInfo
+	err := WalkVersions(uri(ts, "/bucket/logs/"), func(v VersionInfo) error {
+		versions = append(versions, v)
+		return nil
+	}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []VersionInfo{
+		{Key: "logs/a.txt", VersionID: "v3", IsLatest: true, IsDeleteMarker: true, LastModified: time.Date(2009, 10, 12, 17, 50, 30, 0, time.UTC)},
+		{Key: "logs/a.txt", VersionID: "v2", LastModified: time.Date(2009, 10, 11, 17, 50, 30, 0, time.UTC), ETag: "abc", Size: 10, StorageClass: "STANDARD"},
+		{Key: "logs/b.txt", VersionID: "v1", IsLatest: true, LastModified: time.Date(2009, 10, 10, 17, 50, 30, 0, time.UTC), ETag: "def", Size: 20, StorageClass: "STANDARD"},
+	}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected versions %+v, got %+v", expected, versions)
+	}
+	requests := f.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 listing requests, got %d", len(requests))
+	}
+	if u := requests[0].URL; u != "/bucket?prefix=logs%2F&versions=" {
+		t.Errorf("unexpected url %q", u)
+	}
+
+	stop := errors.New("stop")
+	err = WalkVersions(uri(ts, "/bucket/logs/"), func(v VersionInfo) error {
+		return stop
+	}, ts.Client())
+	if err != stop {
+		t.Errorf("expected walk to stop, got %v", err)
+	}
+}
+
+func TestPurgeVersions(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if !has(r.URL.Query(), "versions") {
+			return false
+		}
+		var buf bytes.Buffer
+		buf.WriteString("<ListVersionsResult><IsTruncated>false</IsTruncated>")
+		for i := 0; i < 1500; i++ {
+			if i%3 == 0 {
+				fmt.Fprintf(&buf, "<DeleteMarker><Key>logs/%d.txt</Key><VersionId>v%d</VersionId></DeleteMarker>", i/3, i)
+			} else {
+				fmt.Fprintf(&buf, "<Version><Key>logs/%d.txt</Key><VersionId>v%d</VersionId></Version>", i/3, i)
+			}
+		}
+		buf.WriteString("</ListVersionsResult>")
+		w.Write(buf.Bytes())
+		return true
+	}
+
+	n, err := PurgeVersionsWithOptions(uri(ts, "/bucket/logs/"), &PurgeOptions{DryRun: true}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1500 {
+		t.Errorf("expected 1500 versions to be counted, got %d", n)
+	}
+	for _, r := range f.recorded() {
+		if r.Method == "POST" {
+			t.Fatal("expected a dry run not to delete anything")
+		}
+	}
+
+	n, err = PurgeVersions(uri(ts, "/bucket/logs/"), ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1500 {
+		t.Errorf("expected 1500 versions to be deleted, got %d", n)
+	}
+	var batches []int
+	for _, r := range f.recorded() {
+		if r.Method != "POST" {
+			continue
+		}
+		if r.URL != "/bucket?delete" {
+			t.Errorf("unexpected url %q", r.URL)
+		}
+		var d struct {
+			Objects []ObjectIdentifier `xml:"Object"`
+		}
+		if err := xml.Unmarshal(r.Body, &d); err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range d.Objects {
+			if o.VersionID == "" {
+				t.Errorf("expected a version id for %s", o.Key)
+			}
+		}
+		batches = append(batches, len(d.Objects))
+	}
+	if !reflect.DeepEqual(batches, []int{1000, 500}) {
+		t.Errorf("unexpected batches %v", batches)
+	}
+}
+
+func TestPurgeVersionsPartialFailure(t *testing.T) {
+	f, ts := newFakeS3(t)
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		q := r.URL.Query()
+		switch {
+		case has(q, "versions"):
+			var buf bytes.Buffer
+			buf.WriteString("<ListVersionsResult><IsTruncated>false</IsTruncated>")
+			for i := 0; i < 1500; i++ {
+				fmt.Fprintf(&buf, "<Version><Key>logs/%d.txt</Key><VersionId>v%d</VersionId></Version>", i, i)
+			}
+			buf.WriteString("</ListVersionsResult>")
+			w.Write(buf.Bytes())
+			return true
+		case has(q, "delete"):
+			// Fail one version of each batch.
+			var d struct {
+				Objects []ObjectIdentifier `xml:"Object"`
+			}
+			xml.NewDecoder(r.Body).Decode(&d)
+			o := d.Objects[len(d.Objects)-1]
+			fmt.Fprintf(w, "<DeleteResult><Error><Key>%s</Key><VersionId>%s</VersionId><Code>AccessDenied</Code><Message>denied</Message></Error></DeleteResult>", o.Key, o.VersionID)
+			return true
+		}
+		return false
+	}
+
+	n, err := PurgeVersions(uri(ts, "/bucket/logs/"), ts.Client())
+	if n != 1498 {
+		t.Errorf("expected 1498 versions to be deleted, got %d", n)
+	}
+	var e *BatchError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected a batch error, got %v", err)
+	}
+	var keys []string
+	for _, item := range e.Errors {
+		keys = append(keys, item.Key)
+	}
+	if expected := []string{"logs/1499.txt", "logs/999.txt"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected failures %v, got %v", expected, keys)
+	}
+	var d *DeleteError
+	if !errors.As(err, &d) || d.Code != "AccessDenied" || d.VersionID != "v1499" {
+		t.Errorf("expected the delete errors to be wrapped, got %v", err)
+	}
+}
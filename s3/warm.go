@@ -0,0 +1,72 @@
+package s3
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// KeepWarm sends a HEAD request to the bucket of uri every interval, in the
+// background, so an idle connection stays established and sporadic requests
+// don't pay for a new TLS handshake. The interval must be shorter than the
+// idle timeout of the transport, 90 seconds for http.DefaultTransport.
+// Failed requests are ignored. The returned function stops the pings.
+func KeepWarm(uri string, interval time.Duration, c *http.Client) (stop func(), err error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("s3: invalid keep warm interval %s", interval)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	u, _, err = bucketPrefix(u)
+	if err != nil {
+		return nil, err
+	}
+
+	ticks, stopTicker := tick(interval)
+	done := make(chan struct{})
+	go func() {
+		defer stopTicker()
+		for {
+			select {
+			case <-ticks:
+				ping(u.String(), c)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+// tick returns the channel KeepWarm pings on every interval and the function
+// stopping it.
+var tick = func(interval time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(interval)
+	return t.C, t.Stop
+}
+
+// ping sends a HeadBucket request, the response body is drained so the
+// connection can be reused.
+func ping(url string, c *http.Client) {
+	req, err := newRequest("HeadBucket", "HEAD", url, nil)
+	if err != nil {
+		return
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
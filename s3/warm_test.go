@@ -0,0 +1,72 @@
+package s3
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepWarm(t *testing.T) {
+	ticks := make(chan time.Time)
+	stopped := make(chan struct{})
+	defer func(fn func(time.Duration) (<-chan time.Time, func())) { tick = fn }(tick)
+	tick = func(time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() { close(stopped) }
+	}
+
+	f := newFake()
+	f.put("/bucket/file.txt", []byte("hello"))
+	var conns int32
+	ts := httptest.NewUnstartedServer(f)
+	ts.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.StartTLS()
+	defer ts.Close()
+	transport := ts.Client().Transport.(*http.Transport).Clone()
+	// Pings and requests sent at the same time must share the connection.
+	transport.MaxConnsPerHost = 1
+	c := &http.Client{Transport: transport}
+
+	stop, err := KeepWarm(uri(ts, "/bucket/file.txt"), time.Minute, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		ticks <- time.Now()
+		if _, err := Stat(uri(ts, "/bucket/file.txt"), c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop()
+	stop()
+	<-stopped
+
+	var pings int
+	for _, r := range f.recorded() {
+		switch {
+		case r.Method == "HEAD" && r.URL == "/bucket":
+			pings++
+		case r.Method == "HEAD" && r.URL == "/bucket/file.txt":
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}
+	if pings != 3 {
+		t.Errorf("expected 3 pings, got %d", pings)
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("expected the connection to be reused, got %d connections", n)
+	}
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := KeepWarm(uri(ts, "/bucket"), interval, c); err == nil {
+			t.Errorf("expected interval %s to be rejected", interval)
+		}
+	}
+}
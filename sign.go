@@ -1,13 +1,16 @@
 package aws
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -25,6 +28,9 @@ var ignoredHeaders = map[string]bool{
 	"Content-Type":   true,
 	"Content-Length": true,
 	"User-Agent":     true,
+	// Expect is a hop-by-hop header proxies may remove, which would break
+	// the signature.
+	"Expect": true,
 }
 
 // Signer allows to sign a request.
@@ -32,6 +38,13 @@ type Signer interface {
 	Sign(*http.Request)
 }
 
+// AnonymousSigner leaves requests unsigned, allowing to access public
+// resources without credentials.
+type AnonymousSigner struct{}
+
+// Sign implements the Signer interface.
+func (AnonymousSigner) Sign(*http.Request) {}
+
 // V4Signer allows to sign a request following AWS V4 signature requirements.
 type V4Signer struct {
 	Region        string
@@ -40,6 +53,15 @@ type V4Signer struct {
 	SecurityToken string
 	Service       string
 
+	// Credentials, if set, provides the keys signing requests instead of
+	// AccessKey, SecretKey and SecurityToken.
+	Credentials Credentials
+
+	// AdditionalSignedHeaders lists headers which are signed even if they
+	// are usually left out of the signature, e.g. Content-Type or
+	// Content-Length, as required by some policies and proxies.
+	AdditionalSignedHeaders []string
+
 	Clock func() time.Time
 }
 
@@ -50,8 +72,24 @@ func (s *V4Signer) Transport() http.RoundTripper {
 	}
 }
 
-// Sign signs the given http.Request.
+// Sign signs the given http.Request. Requests are left unsigned when no
+// access key is set, which allows to access public resources anonymously.
+// Failing to retrieve the keys from Credentials leaves the request unsigned
+// as well, use SignRequest, as Transport does, to get the error.
 func (s *V4Signer) Sign(r *http.Request) {
+	s.SignRequest(r)
+}
+
+// SignRequest is like Sign but reports the error of retrieving the keys from
+// Credentials, it is used by Transport.
+func (s *V4Signer) SignRequest(r *http.Request) error {
+	keys, err := s.keys(r.Context())
+	if err != nil {
+		return err
+	}
+	if keys.AccessKey == "" {
+		return nil
+	}
 	clock := s.Clock
 	if clock == nil {
 		clock = time.Now
@@ -61,8 +99,8 @@ func (s *V4Signer) Sign(r *http.Request) {
 	now := clock().UTC()
 
 	// Set STS token if present.
-	if s.SecurityToken != "" {
-		r.Header.Set("X-Amz-Security-Token", s.SecurityToken)
+	if keys.SecurityToken != "" {
+		r.Header.Set("X-Amz-Security-Token", keys.SecurityToken)
 	}
 
 	// Set time
@@ -91,9 +129,19 @@ func (s *V4Signer) Sign(r *http.Request) {
 	}, "/")
 
 	// Compute signed headers
+	additional := make(map[string]bool, len(s.AdditionalSignedHeaders))
+	for _, k := range s.AdditionalSignedHeaders {
+		if k = http.CanonicalHeaderKey(k); k != "Authorization" {
+			additional[k] = true
+		}
+	}
+	if additional["Content-Length"] && r.Header.Get("Content-Length") == "" && r.ContentLength > 0 {
+		r.Header.Set("Content-Length", strconv.FormatInt(r.ContentLength, 10))
+	}
 	headers := []string{"host"}
 	for k := range r.Header {
-		if _, ok := ignoredHeaders[http.CanonicalHeaderKey(k)]; ok {
+		k = http.CanonicalHeaderKey(k)
+		if ignoredHeaders[k] && !additional[k] {
 			continue
 		}
 		headers = append(headers, strings.ToLower(k))
@@ -113,16 +161,12 @@ func (s *V4Signer) Sign(r *http.Request) {
 	}
 	canonicalHeaders := strings.Join(headerValues, "\n")
 
-	r.URL.RawQuery = strings.Replace(r.URL.Query().Encode(), "+", "%20", -1)
-	uri := uriEncode(r.URL.Path)
-	if uri == "" {
-		uri = "/"
-	}
+	r.URL.RawQuery = canonicalQuery(r.URL.Query())
 
 	// Compute canonical string
 	canonical := strings.Join([]string{
 		r.Method,
-		uri,
+		canonicalURI(r.URL.Path),
 		r.URL.RawQuery,
 		canonicalHeaders + "\n",
 		signedHeaders,
@@ -137,19 +181,102 @@ func (s *V4Signer) Sign(r *http.Request) {
 		hex.EncodeToString(sha([]byte(canonical))),
 	}, "\n")
 
-	dateHMAC := sign([]byte("AWS4"+s.SecretKey), []byte(now.Format(shortFormat)))
-	regionHMAC := sign(dateHMAC, []byte(region))
-	serviceHMAC := sign(regionHMAC, []byte(s.Service))
-	credentialsHMAC := sign(serviceHMAC, []byte("aws4_request"))
-	signature := hex.EncodeToString(sign(credentialsHMAC, []byte(stringToSign)))
-
 	// Compose
 	parts := []string{
-		prefix + " Credential=" + s.AccessKey + "/" + credential,
+		prefix + " Credential=" + keys.AccessKey + "/" + credential,
 		"SignedHeaders=" + signedHeaders,
-		"Signature=" + signature,
+		"Signature=" + signature(keys.SecretKey, s.Service, now, region, stringToSign),
 	}
 	r.Header.Set("Authorization", strings.Join(parts, ","))
+	return nil
+}
+
+func (s *V4Signer) keys(ctx context.Context) (Keys, error) {
+	if s.Credentials != nil {
+		return s.Credentials.Retrieve(ctx)
+	}
+	return Keys{
+		AccessKey:     s.AccessKey,
+		SecretKey:     s.SecretKey,
+		SecurityToken: s.SecurityToken,
+	}, nil
+}
+
+// Presign signs the given http.Request in its query string, the resulting
+// URL can then be used without credentials until expires elapses. Query
+// parameters already set on the request are part of the signature.
+func (s *V4Signer) Presign(r *http.Request, expires time.Duration) error {
+	keys, err := s.keys(r.Context())
+	if err != nil {
+		return err
+	}
+	if keys.AccessKey == "" {
+		return ErrNoCredentials
+	}
+	clock := s.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+
+	region := s.region(r.URL.Host)
+	now := clock().UTC()
+
+	credential := strings.Join([]string{
+		now.Format(shortFormat),
+		region,
+		s.Service,
+		"aws4_request",
+	}, "/")
+
+	q := r.URL.Query()
+	q.Set("X-Amz-Algorithm", prefix)
+	q.Set("X-Amz-Credential", keys.AccessKey+"/"+credential)
+	q.Set("X-Amz-Date", now.Format(isoFormat))
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	q.Set("X-Amz-SignedHeaders", "host")
+	if keys.SecurityToken != "" {
+		q.Set("X-Amz-Security-Token", keys.SecurityToken)
+	}
+	q.Del("X-Amz-Signature")
+	query := canonicalQuery(q)
+
+	canonical := strings.Join([]string{
+		r.Method,
+		canonicalURI(r.URL.Path),
+		query,
+		"host:" + r.URL.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		prefix,
+		now.Format(isoFormat),
+		credential,
+		hex.EncodeToString(sha([]byte(canonical))),
+	}, "\n")
+
+	r.URL.RawQuery = query + "&X-Amz-Signature=" + signature(keys.SecretKey, s.Service, now, region, stringToSign)
+	return nil
+}
+
+func signature(secretKey, service string, now time.Time, region, stringToSign string) string {
+	dateHMAC := sign([]byte("AWS4"+secretKey), []byte(now.Format(shortFormat)))
+	regionHMAC := sign(dateHMAC, []byte(region))
+	serviceHMAC := sign(regionHMAC, []byte(service))
+	credentialsHMAC := sign(serviceHMAC, []byte("aws4_request"))
+	return hex.EncodeToString(sign(credentialsHMAC, []byte(stringToSign)))
+}
+
+func canonicalURI(path string) string {
+	if uri := EscapePath(path); uri != "" {
+		return uri
+	}
+	return "/"
+}
+
+func canonicalQuery(q url.Values) string {
+	return strings.Replace(q.Encode(), "+", "%20", -1)
 }
 
 func (s *V4Signer) region(host string) string {
@@ -178,20 +305,18 @@ func sha(data []byte) []byte {
 	return hash.Sum(nil)
 }
 
-func uriEncode(s string) string {
-	spaceCount, hexCount := 0, 0
+// EscapePath percent-encodes path the way AWS canonicalizes request paths:
+// everything but unreserved characters and slashes is encoded, spaces
+// included.
+func EscapePath(s string) string {
+	hexCount := 0
 	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if shouldEscape(c) {
-			if c == ' ' {
-				spaceCount++
-			} else {
-				hexCount++
-			}
+		if shouldEscape(s[i]) {
+			hexCount++
 		}
 	}
 
-	if spaceCount == 0 && hexCount == 0 {
+	if hexCount == 0 {
 		return s
 	}
 
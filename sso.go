@@ -0,0 +1,212 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SSOProvider provides the credentials of a role through AWS IAM Identity
+// Center, using the token cached by `aws sso login`. The role credentials
+// are cached until shortly before they expire, then requested again with the
+// cached token, which must not have expired in the meantime.
+type SSOProvider struct {
+	// StartURL, Region, AccountID and RoleName, when not set, are read from
+	// the sso_start_url, sso_region, sso_account_id and sso_role_name keys
+	// of Profile, sso_start_url and sso_region can come from the
+	// referenced sso-session.
+	StartURL  string
+	Region    string
+	AccountID string
+	RoleName  string
+
+	// Profile is the profile of the shared config file, it defaults to
+	// AWS_PROFILE or to default.
+	Profile string
+
+	// ConfigFile is the shared config file, it defaults to AWS_CONFIG_FILE
+	// or to ~/.aws/config.
+	ConfigFile string
+
+	// CacheDir is the directory of the cached tokens, it defaults to
+	// ~/.aws/sso/cache.
+	CacheDir string
+
+	// Endpoint is the SSO portal endpoint, it defaults to the one of
+	// Region.
+	Endpoint string
+
+	// Client is the client used to reach SSO, it defaults to
+	// http.DefaultClient.
+	Client *http.Client
+
+	// Clock returns the current time against which the expiry of the token
+	// and of the keys is checked, it defaults to time.Now.
+	Clock func() time.Time
+
+	cache keyCache
+}
+
+type ssoConfig struct {
+	startURL, region, accountID, roleName string
+	// session is the name of the sso-session, if any.
+	session string
+}
+
+func (p *SSOProvider) config() (*ssoConfig, error) {
+	c := &ssoConfig{
+		startURL:  p.StartURL,
+		region:    p.Region,
+		accountID: p.AccountID,
+		roleName:  p.RoleName,
+	}
+	if c.startURL != "" && c.region != "" && c.accountID != "" && c.roleName != "" {
+		return c, nil
+	}
+	profile, err := loadProfile(p.ConfigFile, p.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if c.session = profile["sso_session"]; c.session != "" {
+		session, err := loadSection(configFile(p.ConfigFile), "sso-session "+c.session)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range session {
+			if _, ok := profile[k]; !ok {
+				profile[k] = v
+			}
+		}
+	}
+	for _, f := range []struct {
+		v   *string
+		key string
+	}{
+		{&c.startURL, "sso_start_url"},
+		{&c.region, "sso_region"},
+		{&c.accountID, "sso_account_id"},
+		{&c.roleName, "sso_role_name"},
+	} {
+		if *f.v == "" {
+			*f.v = profile[f.key]
+		}
+		if *f.v == "" {
+			return nil, fmt.Errorf("aws: missing %s in profile %s", f.key, profileName(p.Profile))
+		}
+	}
+	return c, nil
+}
+
+// token returns the cached SSO access token.
+func (p *SSOProvider) token(c *ssoConfig) (string, error) {
+	dir := p.CacheDir
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".aws", "sso", "cache")
+	}
+	// Tokens of sso-sessions are cached by session name, legacy ones by
+	// start URL.
+	key := c.startURL
+	if c.session != "" {
+		key = c.session
+	}
+	sum := sha1.Sum([]byte(key))
+	b, err := ioutil.ReadFile(filepath.Join(dir, hex.EncodeToString(sum[:])+".json"))
+	if err != nil {
+		return "", fmt.Errorf("aws: no cached SSO token, run aws sso login: %v", err)
+	}
+	var t struct {
+		AccessToken string    `json:"accessToken"`
+		ExpiresAt   time.Time `json:"expiresAt"`
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return "", fmt.Errorf("aws: malformed cached SSO token: %v", err)
+	}
+	now := time.Now
+	if p.Clock != nil {
+		now = p.Clock
+	}
+	if t.AccessToken == "" || !now().Before(t.ExpiresAt) {
+		return "", errors.New("aws: cached SSO token expired, run aws sso login")
+	}
+	return t.AccessToken, nil
+}
+
+// Retrieve implements the Credentials interface.
+func (p *SSOProvider) Retrieve(ctx context.Context) (Keys, error) {
+	return p.cache.retrieve(ctx, func(keys Keys) bool {
+		return expired(keys, p.Clock, 0)
+	}, p.fetch)
+}
+
+func (p *SSOProvider) fetch(ctx context.Context) (Keys, error) {
+	c, err := p.config()
+	if err != nil {
+		return Keys{}, err
+	}
+	token, err := p.token(c)
+	if err != nil {
+		return Keys{}, err
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://portal.sso." + c.region + ".amazonaws.com"
+	}
+	q := url.Values{
+		"account_id": {c.accountID},
+		"role_name":  {c.roleName},
+	}
+	req, err := http.NewRequest("GET", endpoint+"/federation/credentials?"+q.Encode(), nil)
+	if err != nil {
+		return Keys{}, err
+	}
+	req = req.WithContext(WithOperation(ctx, "GetRoleCredentials"))
+	req.Header.Set("X-Amz-Sso_bearer_token", token)
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Keys{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return Keys{}, fmt.Errorf("aws: unexpected SSO response: (%d)", resp.StatusCode)
+	}
+	var v struct {
+		RoleCredentials struct {
+			AccessKeyID     string `json:"accessKeyId"`
+			SecretAccessKey string `json:"secretAccessKey"`
+			SessionToken    string `json:"sessionToken"`
+			Expiration      int64  `json:"expiration"`
+		} `json:"roleCredentials"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return Keys{}, fmt.Errorf("aws: malformed SSO credentials: %v", err)
+	}
+	rc := v.RoleCredentials
+	if rc.AccessKeyID == "" || rc.SecretAccessKey == "" {
+		return Keys{}, errors.New("aws: malformed SSO credentials: missing keys")
+	}
+	return Keys{
+		AccessKey:     rc.AccessKeyID,
+		SecretKey:     rc.SecretAccessKey,
+		SecurityToken: rc.SessionToken,
+		// The expiration is in milliseconds.
+		Expires: time.Unix(0, rc.Expiration*int64(time.Millisecond)).UTC(),
+	}, nil
+}
@@ -0,0 +1,91 @@
+package aws
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultSTSEndpoint is the global endpoint of STS.
+const DefaultSTSEndpoint = "https://sts.amazonaws.com"
+
+// stsEndpoint returns the given endpoint, or the regional STS endpoint of
+// AWS_REGION if any.
+func stsEndpoint(endpoint string) string {
+	if endpoint != "" {
+		return endpoint
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return "https://sts." + region + ".amazonaws.com"
+	}
+	return DefaultSTSEndpoint
+}
+
+// STSError is returned when STS responds with an error.
+type STSError struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Error>Code"`
+	Message    string `xml:"Error>Message"`
+}
+
+func (e *STSError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("aws: sts error: (%s) %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("aws: sts error: (%d)", e.StatusCode)
+}
+
+// assumeRole calls the given STS action returning temporary credentials.
+func assumeRole(ctx context.Context, c *http.Client, endpoint, action string, params url.Values) (Keys, error) {
+	params.Set("Action", action)
+	params.Set("Version", "2011-06-15")
+	req, err := http.NewRequest("POST", stsEndpoint(endpoint), strings.NewReader(params.Encode()))
+	if err != nil {
+		return Keys{}, err
+	}
+	req = req.WithContext(WithOperation(ctx, action))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return Keys{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		e := &STSError{StatusCode: resp.StatusCode}
+		xml.NewDecoder(resp.Body).Decode(e)
+		return Keys{}, e
+	}
+	var v struct {
+		// The result element is named after the action.
+		Result struct {
+			Credentials struct {
+				AccessKeyID     string    `xml:"AccessKeyId"`
+				SecretAccessKey string    `xml:"SecretAccessKey"`
+				SessionToken    string    `xml:"SessionToken"`
+				Expiration      time.Time `xml:"Expiration"`
+			} `xml:"Credentials"`
+		} `xml:",any"`
+		Metadata struct{} `xml:"ResponseMetadata"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return Keys{}, err
+	}
+	creds := v.Result.Credentials
+	if creds.AccessKeyID == "" {
+		return Keys{}, fmt.Errorf("aws: no credentials in %s response", action)
+	}
+	return Keys{
+		AccessKey:     creds.AccessKeyID,
+		SecretKey:     creds.SecretAccessKey,
+		SecurityToken: creds.SessionToken,
+		Expires:       creds.Expiration,
+	}, nil
+}
@@ -0,0 +1,155 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// UnsignedPayloadTrailer is the payload digest of aws-chunked requests whose
+// checksum is sent in an unsigned trailer.
+const UnsignedPayloadTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+// Checksum algorithms supported in trailers.
+const (
+	ChecksumCRC32C = "CRC32C"
+	ChecksumSHA256 = "SHA256"
+)
+
+// trailerChunkSize is the size of the chunks of aws-chunked bodies.
+var trailerChunkSize = 64 * 1024
+
+// Trailer holds the checksum sent after the body of a request.
+type Trailer struct {
+	Algorithm string
+
+	mu  sync.Mutex
+	sum string
+}
+
+// Header returns the name of the trailer header.
+func (t *Trailer) Header() string {
+	return "x-amz-checksum-" + strings.ToLower(t.Algorithm)
+}
+
+// Checksum returns the base64 encoded checksum of the body, it's empty
+// until the body has been entirely sent.
+func (t *Trailer) Checksum() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sum
+}
+
+func (t *Trailer) setChecksum(sum string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sum = sum
+}
+
+func (t *Trailer) hash() hash.Hash {
+	if t.Algorithm == ChecksumSHA256 {
+		return sha256.New()
+	}
+	return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+}
+
+// SetUnsignedTrailer encodes the body of r as aws-chunked, computing its
+// checksum with the given algorithm as it is sent and appending it in a
+// trailer. The payload doesn't need to be hashed before being sent, the
+// length of the body must be known.
+func SetUnsignedTrailer(r *http.Request, algorithm string) (*Trailer, error) {
+	if algorithm != ChecksumCRC32C && algorithm != ChecksumSHA256 {
+		return nil, errors.New("aws: unsupported checksum algorithm " + algorithm)
+	}
+	if r.Body == nil || r.ContentLength < 0 {
+		return nil, errors.New("aws: trailers require a body of known length")
+	}
+	t := &Trailer{Algorithm: algorithm}
+	size := r.ContentLength
+
+	r.Header.Set("X-Amz-Content-Sha256", UnsignedPayloadTrailer)
+	r.Header.Set("Content-Encoding", "aws-chunked")
+	r.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(size, 10))
+	r.Header.Set("X-Amz-Trailer", t.Header())
+	r.ContentLength = chunkedLength(size, t)
+	r.Body = newChunkedReader(r.Body, t)
+	if getBody := r.GetBody; getBody != nil {
+		r.GetBody = func() (io.ReadCloser, error) {
+			b, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return newChunkedReader(b, t), nil
+		}
+	}
+	return t, nil
+}
+
+// chunkedLength returns the length of an aws-chunked body of the given
+// decoded size.
+func chunkedLength(size int64, t *Trailer) int64 {
+	chunk := func(n int64) int64 {
+		return int64(len(strconv.FormatInt(n, 16))) + 2 + n + 2
+	}
+	c := int64(trailerChunkSize)
+	n := (size / c) * chunk(c)
+	if r := size % c; r > 0 {
+		n += chunk(r)
+	}
+	sum := base64.StdEncoding.EncodedLen(t.hash().Size())
+	return n + int64(len("0\r\n")+len(t.Header())+1+sum+len("\r\n\r\n"))
+}
+
+type chunkedReader struct {
+	r       io.ReadCloser
+	h       hash.Hash
+	trailer *Trailer
+	chunk   []byte
+	buf     bytes.Buffer
+	done    bool
+}
+
+func newChunkedReader(r io.ReadCloser, t *Trailer) *chunkedReader {
+	return &chunkedReader{
+		r:       r,
+		h:       t.hash(),
+		trailer: t,
+		chunk:   make([]byte, trailerChunkSize),
+	}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 && !c.done {
+		n, err := io.ReadFull(c.r, c.chunk)
+		if n > 0 {
+			c.h.Write(c.chunk[:n])
+			fmt.Fprintf(&c.buf, "%x\r\n", n)
+			c.buf.Write(c.chunk[:n])
+			c.buf.WriteString("\r\n")
+		}
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			sum := base64.StdEncoding.EncodeToString(c.h.Sum(nil))
+			fmt.Fprintf(&c.buf, "0\r\n%s:%s\r\n\r\n", c.trailer.Header(), sum)
+			c.trailer.setChecksum(sum)
+			c.done = true
+		default:
+			return 0, err
+		}
+	}
+	return c.buf.Read(p)
+}
+
+func (c *chunkedReader) Close() error {
+	return c.r.Close()
+}
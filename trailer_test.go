@@ -0,0 +1,72 @@
+package aws
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSetUnsignedTrailer(t *testing.T) {
+	defer func(n int) { trailerChunkSize = n }(trailerChunkSize)
+	trailerChunkSize = 4
+
+	req, _ := http.NewRequest("PUT", "https://examplebucket.s3.amazonaws.com/test.txt", strings.NewReader("hello world"))
+	trailer, err := SetUnsignedTrailer(req, ChecksumCRC32C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"X-Amz-Content-Sha256":         "STREAMING-UNSIGNED-PAYLOAD-TRAILER",
+		"Content-Encoding":             "aws-chunked",
+		"X-Amz-Decoded-Content-Length": "11",
+		"X-Amz-Trailer":                "x-amz-checksum-crc32c",
+	} {
+		if req.Header.Get(k) != v {
+			t.Errorf("expected %s to be %q, got %q", k, v, req.Header.Get(k))
+		}
+	}
+
+	expected := "4\r\nhell\r\n4\r\no wo\r\n3\r\nrld\r\n0\r\nx-amz-checksum-crc32c:yZRlqg==\r\n\r\n"
+	b, _ := ioutil.ReadAll(req.Body)
+	if string(b) != expected {
+		t.Errorf("expected body %q, got %q", expected, b)
+	}
+	if req.ContentLength != int64(len(expected)) {
+		t.Errorf("expected content length %d, got %d", len(expected), req.ContentLength)
+	}
+	if trailer.Checksum() != "yZRlqg==" {
+		t.Errorf("unexpected checksum %q", trailer.Checksum())
+	}
+
+	// Replayed bodies are encoded too.
+	body, _ := req.GetBody()
+	if b, _ := ioutil.ReadAll(body); string(b) != expected {
+		t.Errorf("expected replayed body %q, got %q", expected, b)
+	}
+}
+
+func TestSetUnsignedTrailerSigned(t *testing.T) {
+	req, _ := http.NewRequest("PUT", "https://examplebucket.s3.amazonaws.com/test.txt", strings.NewReader("hello world"))
+	if _, err := SetUnsignedTrailer(req, ChecksumSHA256); err != nil {
+		t.Fatal(err)
+	}
+	testSigner.Sign(req)
+	if d := req.Header.Get("X-Amz-Content-Sha256"); d != UnsignedPayloadTrailer {
+		t.Errorf("unexpected payload digest %q", d)
+	}
+	if a := req.Header.Get("Authorization"); !strings.Contains(a, "x-amz-trailer") {
+		t.Errorf("expected trailer header to be signed, got %q", a)
+	}
+}
+
+func TestSetUnsignedTrailerInvalid(t *testing.T) {
+	req, _ := http.NewRequest("PUT", "https://examplebucket.s3.amazonaws.com/test.txt", strings.NewReader("hello world"))
+	if _, err := SetUnsignedTrailer(req, "MD5"); err == nil {
+		t.Error("expected an unsupported algorithm error")
+	}
+	req, _ = http.NewRequest("PUT", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	if _, err := SetUnsignedTrailer(req, ChecksumSHA256); err == nil {
+		t.Error("expected a missing body error")
+	}
+}
@@ -2,29 +2,219 @@ package aws
 
 import (
 	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 // Transport allows making signed calls to AWS endpoints.
 type Transport struct {
-	// Signer is the underlying request signer used when making requests.
+	// Signer is the underlying request signer used when making requests,
+	// unless the context of the request carries one set with WithSigner.
 	Signer Signer
 
+	// Buckets, if set, provides the credentials of the S3 buckets the
+	// requests are sent to, so a single client can access buckets of
+	// several accounts. Requests to buckets it has credentials for are
+	// signed by a copy of Signer using them when Signer is a *V4Signer, its
+	// Region and Clock included, by an S3 V4Signer inferring the region
+	// from the host otherwise. Requests to other buckets are signed by
+	// Signer. A signer set with WithSigner takes precedence.
+	Buckets BucketCredentialResolver
+
 	// Transport is the underlying HTTP transport to use when making requests.
 	// It will default to http.DefaultTransport if nil.
 	Transport http.RoundTripper
+
+	// RetryPolicy, if set, retries failed requests. Every attempt is signed
+	// again and request bodies are replayed using GetBody, requests with a
+	// body that can't be replayed are only attempted once.
+	RetryPolicy *RetryPolicy
+
+	// OnTransfer, if set, is called after each request with the number of
+	// bytes exchanged, it allows to estimate the cost of operations.
+	OnTransfer func(Transfer)
+
+	// Limiter, if set, caps the number of requests in flight. A request
+	// holds its slot until its response body is closed.
+	Limiter *Limiter
+
+	// Breaker, if set, short-circuits requests with a *CircuitOpenError
+	// while the endpoint is failing.
+	Breaker *CircuitBreaker
+
+	// Collector, if set, observes every request sent, retries included.
+	Collector Collector
+
+	// UserAgent, if set, is appended to the User-Agent header of every
+	// request, e.g. "myapp/1.2", which identifies the traffic in S3 server
+	// access logs. It is set before signing, so it is covered by the
+	// signature when User-Agent is one of the signed headers.
+	UserAgent string
+}
+
+// requestSigner is implemented by signers which can fail to sign requests.
+type requestSigner interface {
+	SignRequest(*http.Request) error
+}
+
+// SignRequest signs r with s, reporting the error of signers which can fail
+// to, like a V4Signer retrieving its keys from Credentials.
+func SignRequest(s Signer, r *http.Request) error {
+	if rs, ok := s.(requestSigner); ok {
+		return rs.SignRequest(r)
+	}
+	s.Sign(r)
+	return nil
+}
+
+// Transfer describes the bytes exchanged by a request, as approximated from
+// the Content-Length of the request and of the response.
+type Transfer struct {
+	// Operation is the API operation of the request, as set by
+	// WithOperation.
+	Operation     string
+	Method        string
+	URL           string
+	StatusCode    int
+	RequestBytes  int64
+	ResponseBytes int64
+
+	// RequestID is the request id set with WithRequestID.
+	RequestID string
+	// AmzRequestID is the request id assigned by AWS, as found in the
+	// x-amz-request-id header of the response.
+	AmzRequestID string
 }
 
 // RoundTrip implements the RoundTripper interface.
 func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.signer(r) == nil {
+		return nil, errors.New("aws: no signer set")
+	}
+	if t.RetryPolicy == nil {
+		return t.roundTrip(r)
+	}
+
+	p := t.RetryPolicy
+	replayable := r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+	for attempt := 1; ; attempt++ {
+		req := r
+		if attempt > 1 && r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = cloneRequest(r)
+			req.Body = body
+		}
+		resp, err := t.roundTrip(req)
+		var open *CircuitOpenError
+		if errors.As(err, &open) {
+			return nil, err
+		}
+		if !replayable || attempt >= p.Attempts() || !p.Retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(p.Backoff(attempt, resp)):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+}
+
+func (t *Transport) roundTrip(r *http.Request) (*http.Response, error) {
 	r = cloneRequest(r)
+	if t.UserAgent != "" {
+		if ua := r.Header.Get("User-Agent"); ua != "" {
+			r.Header.Set("User-Agent", ua+" "+t.UserAgent)
+		} else {
+			r.Header.Set("User-Agent", t.UserAgent)
+		}
+	}
+	if err := SignRequest(t.signer(r), r); err != nil {
+		return nil, err
+	}
+	if t.Limiter != nil {
+		return holdSlot(t.Limiter, r, t.send)
+	}
+	return t.send(r)
+}
 
-	if t.Signer == nil {
-		return nil, errors.New("aws: no signer set")
+// send sends the signed request r, once the circuit breaker allows it.
+func (t *Transport) send(r *http.Request) (*http.Response, error) {
+	if t.Breaker != nil {
+		if err := t.Breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	resp, err := t.transport().RoundTrip(r)
+	if t.Collector != nil {
+		tr := newTransfer(r, resp)
+		t.Collector.ObserveRequest(tr.Operation, tr.StatusCode, time.Since(start), tr.RequestBytes+tr.ResponseBytes)
+	}
+	if t.Breaker != nil {
+		t.Breaker.record(resp, err)
+	}
+	if t.OnTransfer != nil {
+		t.OnTransfer(newTransfer(r, resp))
+	}
+	return resp, err
+}
+
+func newTransfer(r *http.Request, resp *http.Response) Transfer {
+	t := Transfer{
+		Operation: Operation(r.Context()),
+		RequestID: RequestID(r.Context()),
+		Method:    r.Method,
+		URL:       r.URL.String(),
+	}
+	if r.ContentLength > 0 {
+		t.RequestBytes = r.ContentLength
+	}
+	if resp != nil {
+		t.StatusCode = resp.StatusCode
+		t.AmzRequestID = amzRequestID(resp.Header)
+		if resp.ContentLength > 0 {
+			t.ResponseBytes = resp.ContentLength
+		}
+	}
+	return t
+}
+
+// amzRequestID returns the request id of an AWS response, S3 uses its own
+// header.
+func amzRequestID(h http.Header) string {
+	if id := h.Get("X-Amz-Request-Id"); id != "" {
+		return id
 	}
-	t.Signer.Sign(r)
+	return h.Get("X-Amzn-Requestid")
+}
 
-	return t.transport().RoundTrip(r)
+// signer returns the signer of r, the one carried by its context if any,
+// then the one of its bucket.
+func (t *Transport) signer(r *http.Request) Signer {
+	if s := contextSigner(r.Context()); s != nil {
+		return s
+	}
+	if t.Buckets != nil {
+		if creds := t.Buckets.BucketCredentials(bucketName(r.URL)); creds != nil {
+			s := &V4Signer{Service: "s3"}
+			if v4, ok := t.Signer.(*V4Signer); ok {
+				*s = *v4
+			}
+			s.Credentials = creds
+			return s
+		}
+	}
+	return t.Signer
 }
 
 func (t *Transport) transport() http.RoundTripper {
@@ -37,6 +227,9 @@ func (t *Transport) transport() http.RoundTripper {
 func cloneRequest(r *http.Request) *http.Request {
 	c := new(http.Request)
 	*c = *r
+	// Signing rewrites the query, so the URL must not be shared.
+	u := *r.URL
+	c.URL = &u
 	c.Header = make(http.Header, len(r.Header))
 	for k, s := range r.Header {
 		c.Header[k] = append([]string(nil), s...)
@@ -0,0 +1,86 @@
+package aws
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebIdentityProvider provides the credentials of a role assumed with an
+// OpenID Connect token, like the service account tokens of EKS pods. The
+// keys are cached until shortly before the Expiration returned by STS, then
+// the role is assumed again with the current token.
+type WebIdentityProvider struct {
+	// RoleARN is the role to assume, it defaults to AWS_ROLE_ARN.
+	RoleARN string
+
+	// TokenFile is the file holding the token, it defaults to
+	// AWS_WEB_IDENTITY_TOKEN_FILE. It is read again on every refresh, as
+	// tokens are rotated.
+	TokenFile string
+
+	// SessionName identifies the session, it defaults to
+	// AWS_ROLE_SESSION_NAME or to a generated name.
+	SessionName string
+
+	// Duration is how long the credentials are valid, STS defaults to one
+	// hour.
+	Duration time.Duration
+
+	// Endpoint is the STS endpoint, it defaults to the regional endpoint of
+	// AWS_REGION or to DefaultSTSEndpoint.
+	Endpoint string
+
+	// Client is the client used to reach STS, it defaults to
+	// http.DefaultClient.
+	Client *http.Client
+
+	cache keyCache
+}
+
+// Retrieve implements the Credentials interface.
+func (p *WebIdentityProvider) Retrieve(ctx context.Context) (Keys, error) {
+	return p.cache.retrieve(ctx, func(keys Keys) bool {
+		return expired(keys, nil, 0)
+	}, p.fetch)
+}
+
+func (p *WebIdentityProvider) fetch(ctx context.Context) (Keys, error) {
+	role := orEnv(p.RoleARN, "AWS_ROLE_ARN")
+	name := orEnv(p.TokenFile, "AWS_WEB_IDENTITY_TOKEN_FILE")
+	if role == "" || name == "" {
+		return Keys{}, ErrNoCredentials
+	}
+	token, err := ioutil.ReadFile(name)
+	if err != nil {
+		return Keys{}, err
+	}
+	params := url.Values{
+		"RoleArn":          {role},
+		"RoleSessionName":  {sessionName(p.SessionName)},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	if p.Duration > 0 {
+		params.Set("DurationSeconds", strconv.Itoa(int(p.Duration/time.Second)))
+	}
+	return assumeRole(ctx, p.Client, p.Endpoint, "AssumeRoleWithWebIdentity", params)
+}
+
+func orEnv(v, k string) string {
+	if v != "" {
+		return v
+	}
+	return os.Getenv(k)
+}
+
+func sessionName(name string) string {
+	if name = orEnv(name, "AWS_ROLE_SESSION_NAME"); name != "" {
+		return name
+	}
+	return "aws-go-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}